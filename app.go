@@ -21,7 +21,7 @@ func NewApp(conn *app.Connections) *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-
+	a.conn.SetContext(ctx)
 }
 
 // domReady is called after front-end resources have been loaded
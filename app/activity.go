@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Poll interval of the activity monitor when none is given
+const defaultActivityInterval = 2 * time.Second
+
+// loadActivity reads the backends of the server, other than the one reading them, and builds the
+// blocking chains between them. Only the backends of the current database are read unless
+// allDatabases is set.
+func loadActivity(ctx context.Context, q querier, allDatabases bool) (*model.ActivitySnapshot, error) {
+	query := `
+		SELECT
+			a.pid,
+			COALESCE(a.datname::text, ''),
+			COALESCE(a.usename::text, ''),
+			COALESCE(a.application_name, ''),
+			COALESCE(host(a.client_addr), ''),
+			a.client_port,
+			COALESCE(a.backend_type, ''),
+			COALESCE(a.state, ''),
+			COALESCE(a.wait_event_type, ''),
+			COALESCE(a.wait_event, ''),
+			COALESCE(a.query, ''),
+			a.backend_start,
+			a.xact_start,
+			a.query_start,
+			a.state_change,
+			(EXTRACT(EPOCH FROM now() - a.query_start) * 1000)::bigint,
+			(EXTRACT(EPOCH FROM now() - a.xact_start) * 1000)::bigint,
+			pg_blocking_pids(a.pid),
+			COALESCE(l.locktype, ''),
+			COALESCE(l.mode, ''),
+			COALESCE(l.relation::regclass::text, '')
+		FROM pg_stat_activity a
+		LEFT JOIN LATERAL (
+			SELECT locktype, mode, relation
+			FROM pg_locks
+			WHERE pid = a.pid AND NOT granted
+			LIMIT 1
+		) l ON true
+		WHERE a.pid <> pg_backend_pid()
+		  AND ($1 OR a.datname = current_database())
+		ORDER BY a.backend_start, a.pid;
+	`
+	rows, err := q.Query(ctx, query, allDatabases)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot := &model.ActivitySnapshot{Sessions: []model.ActivitySession{}, TakenAt: time.Now()}
+	for rows.Next() {
+		var s model.ActivitySession
+		err := rows.Scan(
+			&s.PID, &s.Database, &s.User, &s.ApplicationName, &s.ClientAddr, &s.ClientPort, &s.BackendType,
+			&s.State, &s.WaitEventType, &s.WaitEvent, &s.Query,
+			&s.BackendStart, &s.XactStart, &s.QueryStart, &s.StateChange, &s.QueryDuration, &s.XactDuration,
+			&s.BlockedBy, &s.LockType, &s.LockMode, &s.LockRelation,
+		)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Sessions = append(snapshot.Sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	snapshot.LockTree = buildLockTree(snapshot.Sessions)
+	return snapshot, nil
+}
+
+// buildLockTree roots the blocking chains at the backends which block others without waiting
+// themselves. A backend blocked by several others appears under each of them. Backends which
+// only block each other, a deadlock about to be detected, are rooted at their lowest pid.
+func buildLockTree(sessions []model.ActivitySession) []model.LockNode {
+	byPID := make(map[int32]model.ActivitySession, len(sessions))
+	blocking := make(map[int32][]int32)
+	for _, s := range sessions {
+		byPID[s.PID] = s
+		for _, blocker := range s.BlockedBy {
+			blocking[blocker] = append(blocking[blocker], s.PID)
+		}
+	}
+	if len(blocking) == 0 {
+		return []model.LockNode{}
+	}
+
+	blockers := make([]int32, 0, len(blocking))
+	for pid := range blocking {
+		blockers = append(blockers, pid)
+	}
+	slices.Sort(blockers)
+
+	var build func(pid int32, path []int32) (model.LockNode, []int32)
+	build = func(pid int32, path []int32) (model.LockNode, []int32) {
+		session, ok := byPID[pid]
+		if !ok {
+			// Blockers of another database or prepared transactions have no session
+			session = model.ActivitySession{PID: pid}
+		}
+		node := model.LockNode{Session: session, Blocking: []model.LockNode{}}
+		blocked := []int32{}
+		path = append(path, pid)
+		for _, child := range blocking[pid] {
+			if slices.Contains(path, child) {
+				continue
+			}
+			childNode, descendants := build(child, path)
+			node.Blocking = append(node.Blocking, childNode)
+			blocked = append(blocked, child)
+			blocked = append(blocked, descendants...)
+		}
+		slices.Sort(blocked)
+		blocked = slices.Compact(blocked)
+		node.BlockedCount = len(blocked)
+		return node, blocked
+	}
+
+	tree := []model.LockNode{}
+	visited := make(map[int32]bool)
+	addRoot := func(pid int32) {
+		node, blocked := build(pid, nil)
+		visited[pid] = true
+		for _, child := range blocked {
+			visited[child] = true
+		}
+		tree = append(tree, node)
+	}
+	for _, pid := range blockers {
+		if len(byPID[pid].BlockedBy) == 0 {
+			addRoot(pid)
+		}
+	}
+	for _, pid := range blockers {
+		if !visited[pid] {
+			addRoot(pid)
+		}
+	}
+
+	return tree
+}
+
+// GetActivity returns the sessions and blocking chains of the server of a pool
+func (c *Connections) GetActivity(activePoolID uuid.UUID, allDatabases bool) (*model.ActivitySnapshot, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	return loadActivity(context.Background(), pool, allDatabases)
+}
+
+// StartActivityMonitor polls the activity of the server of a pool every interval seconds and
+// emits each snapshot as an activitySnapshot event with the pool id. Failed polls emit an
+// activityError event and polling goes on. A running monitor of the pool is replaced.
+func (c *Connections) StartActivityMonitor(activePoolID uuid.UUID, intervalSeconds int, allDatabases bool) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+
+	interval := defaultActivityInterval
+	if intervalSeconds > 0 {
+		interval = time.Duration(intervalSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.monitorMu.Lock()
+	if stop, isRunning := c.activityMonitors[activePoolID]; isRunning {
+		stop()
+	}
+	c.activityMonitors[activePoolID] = cancel
+	c.monitorMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// A poll never outlives its interval, so a stuck server doesn't pile up polls
+			pollCtx, cancelPoll := context.WithTimeout(ctx, interval)
+			snapshot, err := loadActivity(pollCtx, pool, allDatabases)
+			cancelPoll()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				c.emit("activityError", activePoolID.String(), err.Error())
+			} else {
+				c.emit("activitySnapshot", activePoolID.String(), snapshot)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// StopActivityMonitor stops polling the activity of the server of a pool
+func (c *Connections) StopActivityMonitor(activePoolID uuid.UUID) {
+	c.monitorMu.Lock()
+	defer c.monitorMu.Unlock()
+
+	if cancel, isRunning := c.activityMonitors[activePoolID]; isRunning {
+		cancel()
+		delete(c.activityMonitors, activePoolID)
+	}
+}
+
+// CancelBackend cancels the running query of a backend. On production the pid has to be passed
+// as confirmation.
+func (c *Connections) CancelBackend(activePoolID uuid.UUID, pid int32, confirmation string) error {
+	return c.signalBackend(activePoolID, pid, confirmation, "pg_cancel_backend", "cancelling the query of backend")
+}
+
+// TerminateBackend ends the session of a backend and rolls back its transaction. On production
+// the pid has to be passed as confirmation.
+func (c *Connections) TerminateBackend(activePoolID uuid.UUID, pid int32, confirmation string) error {
+	return c.signalBackend(activePoolID, pid, confirmation, "pg_terminate_backend", "terminating backend")
+}
+
+func (c *Connections) signalBackend(activePoolID uuid.UUID, pid int32, confirmation, function, action string) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+
+	expected := strconv.Itoa(int(pid))
+	if err := c.checkEnvSafety(activePoolID, fmt.Sprintf("%s %d", action, pid), expected, confirmation); err != nil {
+		return err
+	}
+
+	var signalled bool
+	if err := pool.QueryRow(context.Background(), "SELECT "+function+"($1)", pid).Scan(&signalled); err != nil {
+		return err
+	}
+	if !signalled {
+		return fmt.Errorf("backend %d wasn't signalled, it may have exited already", pid)
+	}
+
+	return nil
+}
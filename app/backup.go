@@ -0,0 +1,849 @@
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"dbmx/model"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Layout version of backup files, other versions can't be restored
+	backupFormatVersion = 1
+	backupManifestFile  = "manifest.json"
+)
+
+// catalogObject identifies a database object by its catalog and oid
+type catalogObject struct {
+	catalog string
+	oid     uint32
+}
+
+// backupPlan collects the entries of a backup
+type backupPlan struct {
+	entries []model.BackupEntry
+	// Entry creating each dumped object, to resolve the dependencies between objects
+	objects map[catalogObject]int
+	// Entry creating each schema
+	schemas map[string]int
+	// Owners and grants, restored last
+	ownerships []model.BackupEntry
+}
+
+// add appends an entry, every entry depends on the creation of its schema
+func (p *backupPlan) add(entry model.BackupEntry, dependsOn ...int) int {
+	entry.ID = len(p.entries) + 1
+	entry.DependsOn = []int{}
+	if id, ok := p.schemas[entry.Schema]; ok && entry.Kind != model.BackupEntrySchema {
+		entry.DependsOn = append(entry.DependsOn, id)
+	}
+	for _, id := range dependsOn {
+		if id != 0 && !slices.Contains(entry.DependsOn, id) {
+			entry.DependsOn = append(entry.DependsOn, id)
+		}
+	}
+	p.entries = append(p.entries, entry)
+	return entry.ID
+}
+
+// addObject appends the entry creating an object and keeps its owner and grants for the end
+func (p *backupPlan) addObject(key catalogObject, entry model.BackupEntry, ownership string) int {
+	id := p.add(entry)
+	p.objects[key] = id
+	if ownership != "" {
+		p.ownerships = append(p.ownerships, model.BackupEntry{
+			Kind:      model.BackupEntryOwnership,
+			Section:   model.BackupSectionPostData,
+			Schema:    entry.Schema,
+			Name:      entry.Name,
+			SQL:       ownership,
+			DependsOn: []int{id},
+		})
+	}
+	return id
+}
+
+func backupEntryLabel(entry model.BackupEntry) string {
+	if entry.Kind == model.BackupEntrySchema {
+		return "schema " + entry.Name
+	}
+	return strings.ReplaceAll(entry.Kind, "_", " ") + " " + entry.Schema + "." + entry.Name
+}
+
+// Name of an object in the backup entries, functions are told apart by their arguments
+func backupObjectName(object model.DatabaseObject) string {
+	switch object.Kind {
+	case model.ObjectKindFunction, model.ObjectKindProcedure:
+		return object.Name + "(" + object.Arguments + ")"
+	case model.ObjectKindTrigger:
+		return object.Name + " on " + object.TableName
+	}
+	return object.Name
+}
+
+// Load the definitions of the selected tables and of the partitions of the selected partitioned
+// tables, parents before their partitions
+func loadSelectedTableDefs(ctx context.Context, q querier, tables []model.TableRef) ([]*model.TableDef, error) {
+	selected := make([]uint32, 0, len(tables))
+	for _, table := range tables {
+		oid, err := lookupTableOID(ctx, q, table.Schema, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, oid)
+	}
+
+	query := `
+		WITH RECURSIVE tables AS (
+			SELECT unnest($1::oid[]) AS oid, 0 AS depth
+			UNION
+			SELECT i.inhrelid, t.depth + 1
+			FROM tables t
+			JOIN pg_inherits i ON i.inhparent = t.oid
+			JOIN pg_class c    ON c.oid = i.inhrelid
+			WHERE c.relispartition
+		)
+		SELECT oid FROM tables GROUP BY oid ORDER BY MIN(depth);
+	`
+	rows, err := q.Query(ctx, query, selected)
+	if err != nil {
+		return nil, err
+	}
+	oids, err := pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]*model.TableDef, 0, len(oids))
+	for _, oid := range oids {
+		def, err := loadTableDefByOID(ctx, q, oid)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+
+	return defs, nil
+}
+
+// Load the sequences owned by the columns of tables and the triggers of tables
+func loadTableObjects(ctx context.Context, q querier, oids []uint32) ([]model.DatabaseObject, error) {
+	query := `
+		SELECT 'sequence', s.oid, n.nspname::text, s.relname::text, ''
+		FROM pg_depend d
+		JOIN pg_class s     ON s.oid = d.objid
+		JOIN pg_namespace n ON n.oid = s.relnamespace
+		WHERE d.classid = 'pg_class'::regclass
+		  AND d.refclassid = 'pg_class'::regclass
+		  AND d.refobjid = ANY($1)
+		  AND d.deptype = 'a'
+		  AND s.relkind = 'S'
+
+		UNION ALL
+
+		SELECT 'trigger', tg.oid, n.nspname::text, tg.tgname::text, c.relname::text
+		FROM pg_trigger tg
+		JOIN pg_class c     ON c.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE tg.tgrelid = ANY($1)
+		  AND NOT tg.tgisinternal
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_trigger'::regclass AND d.objid = tg.oid AND d.deptype IN ('P', 'S')
+		  )
+		ORDER BY 1, 3, 4;
+	`
+	rows, err := q.Query(ctx, query, oids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []model.DatabaseObject
+	for rows.Next() {
+		var object model.DatabaseObject
+		if err := rows.Scan(&object.Kind, &object.OID, &object.Schema, &object.Name, &object.TableName); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+// Render the statements restoring the values of the dumped sequences and of the identity
+// sequences of the dumped tables
+func sequenceValuesSQL(ctx context.Context, q querier, sequences, tables []uint32) ([]model.BackupEntry, error) {
+	query := `
+		SELECT
+			s.oid,
+			n.nspname::text,
+			s.relname::text,
+			COALESCE((
+				SELECT format('pg_get_serial_sequence(%L, %L)', format('%I.%I', tn.nspname, t.relname), a.attname)
+				FROM pg_depend d
+				JOIN pg_class t      ON t.oid = d.refobjid
+				JOIN pg_namespace tn ON tn.oid = t.relnamespace
+				JOIN pg_attribute a  ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+				WHERE d.classid = 'pg_class'::regclass AND d.objid = s.oid AND d.refclassid = 'pg_class'::regclass AND d.deptype = 'i'
+			), quote_literal(format('%I.%I', n.nspname, s.relname)))
+		FROM pg_class s
+		JOIN pg_namespace n ON n.oid = s.relnamespace
+		WHERE s.relkind = 'S'
+		  AND (s.oid = ANY($1) OR EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = s.oid AND d.refclassid = 'pg_class'::regclass
+			  AND d.deptype = 'i' AND d.refobjid = ANY($2)
+		  ))
+		ORDER BY 2, 3;
+	`
+	rows, err := q.Query(ctx, query, sequences, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	type sequence struct {
+		oid          uint32
+		schema, name string
+		target       string
+	}
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (sequence, error) {
+		var s sequence
+		err := row.Scan(&s.oid, &s.schema, &s.name, &s.target)
+		return s, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]model.BackupEntry, 0, len(found))
+	for _, s := range found {
+		var value int64
+		var isCalled bool
+		if err := q.QueryRow(ctx, "SELECT last_value, is_called FROM "+quoteQualified(s.schema, s.name)).Scan(&value, &isCalled); err != nil {
+			return nil, err
+		}
+		entries = append(entries, model.BackupEntry{
+			Kind:    model.BackupEntrySequenceValue,
+			Section: model.BackupSectionData,
+			Schema:  s.schema,
+			Name:    s.name,
+			SQL:     fmt.Sprintf("SELECT pg_catalog.setval(%s, %d, %t);\n", s.target, value, isCalled),
+		})
+	}
+
+	return entries, nil
+}
+
+// addObjectDependencies makes every entry depend on the entries creating the objects it depends
+// on according to pg_depend
+func addObjectDependencies(ctx context.Context, q querier, plan *backupPlan) error {
+	objects := make([]catalogObject, 0, len(plan.objects))
+	for object := range plan.objects {
+		objects = append(objects, object)
+	}
+
+	dependencies, err := loadObjectDependencies(ctx, q, objects)
+	if err != nil {
+		return err
+	}
+
+	for object, refs := range dependencies {
+		id := plan.objects[object]
+		entry := &plan.entries[id-1]
+		for _, dependency := range refs {
+			if ref := plan.objects[dependency]; id != ref && !slices.Contains(entry.DependsOn, ref) {
+				entry.DependsOn = append(entry.DependsOn, ref)
+			}
+		}
+	}
+
+	for i := range plan.entries {
+		slices.Sort(plan.entries[i].DependsOn)
+	}
+	return nil
+}
+
+// planBackup reads the DDL of the selected schemas and tables into backup entries. The data
+// entries only name the tables and columns to copy.
+func planBackup(ctx context.Context, q querier, opts model.BackupOptions) (*model.BackupManifest, *backupPlan, error) {
+	manifest := &model.BackupManifest{
+		Version:    backupFormatVersion,
+		CreatedAt:  time.Now(),
+		Schemas:    []string{},
+		Tables:     []model.TableRef{},
+		SchemaOnly: opts.SchemaOnly,
+	}
+	manifest.Schemas = append(manifest.Schemas, opts.Schemas...)
+	manifest.Tables = append(manifest.Tables, opts.Tables...)
+
+	err := q.QueryRow(ctx, "SELECT current_database()::text, current_setting('server_version')").Scan(&manifest.Database, &manifest.ServerVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &backupPlan{objects: make(map[catalogObject]int), schemas: make(map[string]int)}
+
+	var tables []*model.TableDef
+	var objects []model.DatabaseObject
+	seen := make(map[catalogObject]bool)
+	addTables := func(defs []*model.TableDef) {
+		for _, def := range defs {
+			key := catalogObject{"pg_class", def.OID}
+			if !seen[key] {
+				seen[key] = true
+				tables = append(tables, def)
+			}
+		}
+	}
+	addObjects := func(found []model.DatabaseObject) {
+		for _, object := range found {
+			key := catalogObject{objectKindDDL[object.Kind].catalog, object.OID}
+			if !seen[key] {
+				seen[key] = true
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	// Whole schemas with their owner, comment and grants
+	for _, schema := range opts.Schemas {
+		if _, ok := plan.schemas[schema]; ok {
+			continue
+		}
+
+		var schemaOID uint32
+		var schemaComment string
+		err := q.QueryRow(ctx, "SELECT oid, COALESCE(obj_description(oid, 'pg_namespace'), '') FROM pg_namespace WHERE nspname = $1", schema).Scan(&schemaOID, &schemaComment)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, nil, fmt.Errorf("schema %s does not exist", schema)
+			}
+			return nil, nil, err
+		}
+		owner, grants, err := loadObjectGrants(ctx, q, "pg_namespace", schemaOID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		quotedSchema := quoteIdent(schema)
+		plan.schemas[schema] = plan.addObject(catalogObject{"pg_namespace", schemaOID}, model.BackupEntry{
+			Kind:    model.BackupEntrySchema,
+			Section: model.BackupSectionPreData,
+			Schema:  schema,
+			Name:    schema,
+			SQL:     "CREATE SCHEMA IF NOT EXISTS " + quotedSchema + ";\n" + commentSQL("SCHEMA", quotedSchema, schemaComment),
+		}, ownerSQL("SCHEMA", quotedSchema, owner)+grantsSQL("SCHEMA", quotedSchema, grants))
+
+		defs, err := loadSchemaTableDefs(ctx, q, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		addTables(defs)
+
+		schemaObjects, err := listDatabaseObjects(ctx, q, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		addObjects(schemaObjects)
+	}
+
+	// Single tables with their partitions, owned sequences and triggers
+	if len(opts.Tables) > 0 {
+		defs, err := loadSelectedTableDefs(ctx, q, opts.Tables)
+		if err != nil {
+			return nil, nil, err
+		}
+		addTables(defs)
+
+		oids := make([]uint32, len(defs))
+		for i, def := range defs {
+			oids[i] = def.OID
+			if _, ok := plan.schemas[def.Schema]; !ok {
+				plan.schemas[def.Schema] = plan.add(model.BackupEntry{
+					Kind:    model.BackupEntrySchema,
+					Section: model.BackupSectionPreData,
+					Schema:  def.Schema,
+					Name:    def.Schema,
+					SQL:     "CREATE SCHEMA IF NOT EXISTS " + quoteIdent(def.Schema) + ";\n",
+				})
+			}
+		}
+
+		tableObjects, err := loadTableObjects(ctx, q, oids)
+		if err != nil {
+			return nil, nil, err
+		}
+		addObjects(tableObjects)
+	}
+
+	objectsOfKind := func(kinds ...string) []model.DatabaseObject {
+		var matched []model.DatabaseObject
+		for _, object := range objects {
+			if containsString(kinds, object.Kind) {
+				matched = append(matched, object)
+			}
+		}
+		return matched
+	}
+	planObjects := func(section string, objects []model.DatabaseObject) error {
+		for _, object := range objects {
+			ddl, ownership, err := objectDDLParts(ctx, q, object.Kind, object.OID)
+			if err != nil {
+				return err
+			}
+			key := catalogObject{objectKindDDL[object.Kind].catalog, object.OID}
+			entry := model.BackupEntry{Kind: object.Kind, Section: section, Schema: object.Schema, Name: backupObjectName(object), SQL: ddl}
+			plan.addObject(key, entry, ownership)
+		}
+		return nil
+	}
+
+	// Pre data, in the order of a schema script. Restores order the entries by their dependencies.
+	sequences := objectsOfKind(model.ObjectKindSequence)
+	preData := [][]model.DatabaseObject{
+		objectsOfKind(model.ObjectKindExtension),
+		objectsOfKind(model.ObjectKindEnum),
+		objectsOfKind(model.ObjectKindDomain),
+		sequences,
+		objectsOfKind(model.ObjectKindFunction, model.ObjectKindProcedure),
+	}
+	for _, kindObjects := range preData {
+		if err := planObjects(model.BackupSectionPreData, kindObjects); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tableEntries := make(map[uint32]int, len(tables))
+	for _, def := range tables {
+		tableEntries[def.OID] = plan.addObject(catalogObject{"pg_class", def.OID}, model.BackupEntry{
+			Kind:    model.ObjectKindTable,
+			Section: model.BackupSectionPreData,
+			Schema:  def.Schema,
+			Name:    def.Name,
+			SQL:     createTableSQL(def, false),
+		}, tableOwnershipSQL(def))
+	}
+	if err := planObjects(model.BackupSectionPreData, objectsOfKind(model.ObjectKindForeignTable)); err != nil {
+		return nil, nil, err
+	}
+
+	// Data, tables are loaded after the tables they reference so that existing foreign keys
+	// hold when only the data is restored. Partitioned tables hold no rows of their own.
+	if !opts.SchemaOnly {
+		dataEntries := make(map[string]int, len(tables))
+		for _, def := range tables {
+			if def.PartitionBy != "" {
+				continue
+			}
+			var columns []string
+			for _, column := range def.Columns {
+				if column.Generated == "" {
+					columns = append(columns, column.Name)
+				}
+			}
+			if len(columns) == 0 {
+				continue
+			}
+
+			id := plan.add(model.BackupEntry{
+				Kind:    model.BackupEntryData,
+				Section: model.BackupSectionData,
+				Schema:  def.Schema,
+				Name:    def.Name,
+				Columns: columns,
+			}, tableEntries[def.OID])
+			plan.entries[id-1].File = fmt.Sprintf("data/%d.copy", id)
+			dataEntries[quoteQualified(def.Schema, def.Name)] = id
+		}
+		for _, def := range tables {
+			id, ok := dataEntries[quoteQualified(def.Schema, def.Name)]
+			if !ok {
+				continue
+			}
+			entry := &plan.entries[id-1]
+			for _, constraint := range def.Constraints {
+				ref, ok := dataEntries[constraint.References]
+				if constraint.Type == model.ConstraintForeignKey && ok && ref != id && !slices.Contains(entry.DependsOn, ref) {
+					entry.DependsOn = append(entry.DependsOn, ref)
+				}
+			}
+		}
+
+		sequenceOIDs := make([]uint32, len(sequences))
+		for i, sequence := range sequences {
+			sequenceOIDs[i] = sequence.OID
+		}
+		tableOIDs := make([]uint32, len(tables))
+		for i, def := range tables {
+			tableOIDs[i] = def.OID
+		}
+		values, err := sequenceValuesSQL(ctx, q, sequenceOIDs, tableOIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, value := range values {
+			plan.add(value)
+		}
+	}
+
+	// Post data, indexes and foreign keys once the rows are loaded, then views so that
+	// materialized views are populated from the restored rows
+	for _, def := range tables {
+		if sql := tableDetailsSQL(def); sql != "" {
+			plan.add(model.BackupEntry{
+				Kind:    model.BackupEntryTableDetails,
+				Section: model.BackupSectionPostData,
+				Schema:  def.Schema,
+				Name:    def.Name,
+				SQL:     sql,
+			}, tableEntries[def.OID])
+		}
+	}
+	for _, def := range tables {
+		if sql := foreignKeysSQL(def); sql != "" {
+			plan.add(model.BackupEntry{
+				Kind:    model.BackupEntryForeignKeys,
+				Section: model.BackupSectionPostData,
+				Schema:  def.Schema,
+				Name:    def.Name,
+				SQL:     sql,
+			}, tableEntries[def.OID])
+		}
+	}
+
+	views, err := orderViewsByDependencies(ctx, q, objectsOfKind(model.ObjectKindView, model.ObjectKindMaterializedView))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := planObjects(model.BackupSectionPostData, views); err != nil {
+		return nil, nil, err
+	}
+
+	for _, sequence := range sequences {
+		sql, err := sequenceOwnedBySQL(ctx, q, sequence.OID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sql != "" {
+			plan.add(model.BackupEntry{
+				Kind:    model.BackupEntrySequenceOwner,
+				Section: model.BackupSectionPostData,
+				Schema:  sequence.Schema,
+				Name:    sequence.Name,
+				SQL:     sql,
+			}, plan.objects[catalogObject{"pg_class", sequence.OID}])
+		}
+	}
+
+	if err := planObjects(model.BackupSectionPostData, objectsOfKind(model.ObjectKindTrigger)); err != nil {
+		return nil, nil, err
+	}
+
+	if err := addObjectDependencies(ctx, q, plan); err != nil {
+		return nil, nil, err
+	}
+
+	for _, ownership := range plan.ownerships {
+		plan.add(ownership, ownership.DependsOn...)
+	}
+
+	return manifest, plan, nil
+}
+
+// StartBackup dumps the DDL and data of schemas and tables of a pool into a single zip file.
+// The data of each table is copied with COPY TO in text format and a manifest lists the entries
+// with their dependencies. Everything is read within one snapshot. The backup runs as a
+// background job which is returned right away.
+func (c *Connections) StartBackup(activePoolID uuid.UUID, opts model.BackupOptions) (*model.Job, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+	if strings.TrimSpace(opts.Path) == "" {
+		return nil, errors.New("backup path is required")
+	}
+	if len(opts.Schemas) == 0 && len(opts.Tables) == 0 {
+		return nil, errors.New("at least one schema or table is required")
+	}
+
+	j, ctx := c.startJob(model.JobKindBackup, "Backup to "+filepath.Base(opts.Path), activePoolID)
+	info := j.info
+
+	go func() {
+		message, err := c.backup(ctx, j, pool, opts)
+		c.finishJob(ctx, j, message, err)
+	}()
+
+	return &info, nil
+}
+
+func (c *Connections) backup(ctx context.Context, j *job, pool *pgxpool.Pool, opts model.BackupOptions) (string, error) {
+	j.step("Reading definitions", 0, 0)
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", err
+	}
+	// The snapshot is only read, the context may be cancelled already
+	defer tx.Rollback(context.Background())
+
+	manifest, plan, err := planBackup(ctx, tx, opts)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Create(opts.Path)
+	if err != nil {
+		return "", err
+	}
+	written := false
+	defer func() {
+		if !written {
+			file.Close()
+			os.Remove(opts.Path)
+		}
+	}()
+	archive := zip.NewWriter(file)
+
+	var total, done int
+	for _, entry := range plan.entries {
+		if entry.Kind == model.BackupEntryData {
+			total++
+		}
+	}
+
+	var rows int64
+	for i := range plan.entries {
+		entry := &plan.entries[i]
+		if entry.Kind != model.BackupEntryData {
+			continue
+		}
+		j.step(backupEntryLabel(*entry), done, total)
+
+		w, err := archive.Create(entry.File)
+		if err != nil {
+			return "", err
+		}
+		counter := &progressWriter{w: w, job: j}
+		query := fmt.Sprintf("COPY %s (%s) TO STDOUT", quoteQualified(entry.Schema, entry.Name), quoteColumns(entry.Columns))
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, counter, query)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to copy %s.%s", entry.Schema, entry.Name)
+		}
+
+		entry.Rows = tag.RowsAffected()
+		entry.Bytes = counter.n
+		rows += entry.Rows
+		j.addProgress(entry.Rows, 0)
+		done++
+	}
+
+	manifest.Entries = plan.entries
+	w, err := archive.Create(backupManifestFile)
+	if err != nil {
+		return "", err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return "", err
+	}
+	if err := archive.Close(); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	written = true
+
+	j.step("Done", total, total)
+	return fmt.Sprintf("Backed up %d entries with %d rows to %s", len(plan.entries), rows, opts.Path), nil
+}
+
+func readBackupManifest(archive *zip.Reader) (*model.BackupManifest, error) {
+	f, err := archive.Open(backupManifestFile)
+	if err != nil {
+		return nil, errors.New("not a backup file, the manifest is missing")
+	}
+	defer f.Close()
+
+	var manifest model.BackupManifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to read the backup manifest")
+	}
+	if manifest.Version != backupFormatVersion {
+		return nil, fmt.Errorf("backup format version %d isn't supported", manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// ReadBackupManifest returns the manifest of a backup file to preview what a restore creates
+func (c *Connections) ReadBackupManifest(path string) (*model.BackupManifest, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	return readBackupManifest(&archive.Reader)
+}
+
+// orderBackupEntries keeps the entries of the sections, section by section with every entry after
+// the entries it depends on
+func orderBackupEntries(entries []model.BackupEntry, sections []string) []model.BackupEntry {
+	byID := make(map[int]model.BackupEntry, len(entries))
+	dependencies := make(map[int][]int, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+		dependencies[entry.ID] = entry.DependsOn
+	}
+
+	var ordered []model.BackupEntry
+	for _, section := range sections {
+		var ids []int
+		for _, entry := range entries {
+			if entry.Section == section {
+				ids = append(ids, entry.ID)
+			}
+		}
+		for _, id := range orderByDependencies(ids, dependencies) {
+			ordered = append(ordered, byID[id])
+		}
+	}
+
+	return ordered
+}
+
+// StartRestore runs a backup file against the database of a pool within a single transaction.
+// Entries are restored section by section in dependency order, the data of each table with
+// COPY FROM. On production the name of the database has to be passed as confirmation. The
+// restore runs as a background job which is returned right away.
+func (c *Connections) StartRestore(activePoolID uuid.UUID, opts model.RestoreOptions) (*model.Job, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+	if opts.DataOnly && opts.SchemaOnly {
+		return nil, errors.New("data only and schema only can't be used together")
+	}
+
+	info, _ := c.PM.GetPoolInfo(activePoolID)
+	if err := c.checkEnvSafety(activePoolID, "restoring "+filepath.Base(opts.Path), info.DBName, opts.Confirmation); err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.OpenReader(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readBackupManifest(&archive.Reader)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+
+	j, ctx := c.startJob(model.JobKindRestore, "Restore of "+filepath.Base(opts.Path), activePoolID)
+	jobInfo := j.info
+
+	go func() {
+		defer archive.Close()
+		message, err := c.restore(ctx, j, pool, &archive.Reader, manifest, opts)
+		c.finishJob(ctx, j, message, err)
+	}()
+
+	return &jobInfo, nil
+}
+
+func (c *Connections) restore(ctx context.Context, j *job, pool *pgxpool.Pool, archive *zip.Reader, manifest *model.BackupManifest, opts model.RestoreOptions) (string, error) {
+	sections := []string{model.BackupSectionPreData, model.BackupSectionData, model.BackupSectionPostData}
+	if opts.DataOnly {
+		sections = []string{model.BackupSectionData}
+	}
+	if opts.SchemaOnly {
+		sections = []string{model.BackupSectionPreData, model.BackupSectionPostData}
+	}
+
+	entries := orderBackupEntries(manifest.Entries, sections)
+	if opts.SkipOwnership {
+		entries = slices.DeleteFunc(entries, func(entry model.BackupEntry) bool {
+			return entry.Kind == model.BackupEntryOwnership
+		})
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(context.Background())
+
+	// Function bodies may use objects restored after them
+	if _, err := tx.Exec(ctx, "SET LOCAL check_function_bodies = false"); err != nil {
+		return "", err
+	}
+
+	var rows int64
+	for i, entry := range entries {
+		label := backupEntryLabel(entry)
+		j.step(label, i, len(entries))
+
+		if entry.Kind != model.BackupEntryData {
+			if _, err := tx.Exec(ctx, entry.SQL); err != nil {
+				return "", errors.Wrapf(err, "failed to restore %s", label)
+			}
+			continue
+		}
+
+		copied, err := restoreTableData(ctx, tx, j, files[entry.File], entry)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to restore %s", label)
+		}
+		rows += copied
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	j.step("Done", len(entries), len(entries))
+	return fmt.Sprintf("Restored %d entries with %d rows from %s", len(entries), rows, filepath.Base(opts.Path)), nil
+}
+
+// Copy the rows of a data entry into its table
+func restoreTableData(ctx context.Context, tx pgx.Tx, j *job, f *zip.File, entry model.BackupEntry) (int64, error) {
+	if f == nil {
+		return 0, fmt.Errorf("data file %s is missing from the backup", entry.File)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", quoteQualified(entry.Schema, entry.Name), quoteColumns(entry.Columns))
+	tag, err := tx.Conn().PgConn().CopyFrom(ctx, &progressReader{r: r, job: j}, query)
+	if err != nil {
+		return 0, err
+	}
+
+	j.addProgress(tag.RowsAffected(), 0)
+	return tag.RowsAffected(), nil
+}
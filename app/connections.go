@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"dbmx/model"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -22,10 +23,19 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Schema qualified name of a table
+type tableRef struct {
+	Schema string
+	Name   string
+}
+
 type Connections struct {
 	DB *sql.DB
 	PM *PoolManager
 
+	// Wails application context, required to emit events to the frontend
+	ctx context.Context
+
 	// Track active queries per tab
 	mu            sync.Mutex
 	activeQueries map[int64]context.CancelFunc
@@ -34,18 +44,48 @@ type Connections struct {
 	// Table Oid uniquely identifies a teble within a database. But it can repeat for a different database.
 	// Hence use a nested map with connection uuid and table oid as key to store table name
 	tableMu         sync.RWMutex
-	tableOidNameMap map[uuid.UUID]map[uint32]string
+	tableOidNameMap map[uuid.UUID]map[uint32]tableRef
+
+	// Exact row counts running in the background per tab
+	countMu     sync.Mutex
+	exactCounts map[int64]context.CancelFunc
+
+	// Activity monitors polling per pool
+	monitorMu        sync.Mutex
+	activityMonitors map[uuid.UUID]context.CancelFunc
+
+	// LISTEN connections per pool
+	listenMu  sync.Mutex
+	listeners map[uuid.UUID]*notificationListener
+
+	// Watched queries re-running per tab
+	watchMu sync.Mutex
+	watches map[int64]*tabWatch
+
+	// Background jobs by id
+	jobMu sync.Mutex
+	jobs  map[string]*job
 }
 
 func NewConnections(db *sql.DB, pm *PoolManager) *Connections {
 	return &Connections{
-		DB:              db,
-		PM:              pm,
-		activeQueries:   make(map[int64]context.CancelFunc),
-		tableOidNameMap: make(map[uuid.UUID]map[uint32]string),
+		DB:               db,
+		PM:               pm,
+		activeQueries:    make(map[int64]context.CancelFunc),
+		tableOidNameMap:  make(map[uuid.UUID]map[uint32]tableRef),
+		exactCounts:      make(map[int64]context.CancelFunc),
+		activityMonitors: make(map[uuid.UUID]context.CancelFunc),
+		listeners:        make(map[uuid.UUID]*notificationListener),
+		watches:          make(map[int64]*tabWatch),
+		jobs:             make(map[string]*job),
 	}
 }
 
+// SetContext saves the wails application context, it's called on startup
+func (c *Connections) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
 func (c *Connections) TypeConnectionTable() *model.ConnectionTable {
 	return &model.ConnectionTable{}
 }
@@ -396,19 +436,27 @@ func (c *Connections) RefreshPostgresDatabase(id int64, dbID, dbName, poolID str
 		return nil, err
 	}
 
-	// Get all tables
-	tables, err := c.GetAllPostgresTables(poolIDUUID)
+	// Get all schemas and their tables
+	schemas, err := c.GetAllPostgresSchemas(poolIDUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	searchPath, err := c.GetSearchPath(poolIDUUID)
 	if err != nil {
 		return nil, err
 	}
 
 	return &model.Database{
-		ID:           dbID,
-		Name:         dbName,
-		ConnectionID: id,
-		PoolID:       poolID,
-		IsActive:     true,
-		Tables:       tables,
+		ID:               dbID,
+		Name:             dbName,
+		ConnectionID:     id,
+		PoolID:           poolID,
+		IsActive:         true,
+		Tables:           schemaTables(schemas, defaultSchema),
+		Schemas:          schemas,
+		SearchPath:       searchPath,
+		SuggestionTables: suggestionTables(schemas, searchPath),
 	}, nil
 }
 
@@ -461,8 +509,13 @@ func (c *Connections) EstablishPostgresDatabaseConnection(id int64, dbName strin
 		return nil, err
 	}
 
-	// Get all table names for suggestions
-	tables, err := c.GetAllPostgresTables(activePoolID)
+	// Get all schemas and table names for suggestions
+	schemas, err := c.GetAllPostgresSchemas(activePoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	searchPath, err := c.GetSearchPath(activePoolID)
 	if err != nil {
 		return nil, err
 	}
@@ -484,20 +537,25 @@ func (c *Connections) EstablishPostgresDatabaseConnection(id int64, dbName strin
 	// In case of table rows, find all the rows with type table where
 	// active_db_id is null and postgres_connection_id and database matches
 	// set the active pool id and active db properties in such tabs
-	_, err = c.DB.Exec("UPDATE tabs SET active_db_id = ?, active_db = ?, active_db_color = ? WHERE active_db_id IS NULL AND type = 'table' AND connection_id = ? AND db_name = ?", activePoolID.String(), activeDB, conn.Color, id, dbName)
+	_, err = c.DB.Exec("UPDATE tabs SET active_db_id = ?, active_db = ?, active_db_color = ? WHERE active_db_id IS NULL AND type IN ('table', 'erd') AND connection_id = ? AND db_name = ?", activePoolID.String(), activeDB, conn.Color, id, dbName)
 	if err != nil {
 		return nil, err
 	}
 
+	c.snapshotOnConnect(activePoolID, id, dbName)
+
 	return &model.Database{
-		Name:           dbName,
-		ConnectionID:   id,
-		ConnectionName: conn.Name,
-		Color:          conn.Color,
-		PoolID:         activePoolID.String(),
-		IsActive:       true,
-		Tables:         tables,
-		Columns:        columns,
+		Name:             dbName,
+		ConnectionID:     id,
+		ConnectionName:   conn.Name,
+		Color:            conn.Color,
+		PoolID:           activePoolID.String(),
+		IsActive:         true,
+		Tables:           schemaTables(schemas, defaultSchema),
+		Columns:          columns,
+		Schemas:          schemas,
+		SearchPath:       searchPath,
+		SuggestionTables: suggestionTables(schemas, searchPath),
 	}, nil
 }
 
@@ -557,11 +615,13 @@ func (c *Connections) EstablishPostgresConnection(id int64) ([]model.Database, e
 	// In case of table rows, find all the rows with type table where
 	// active_db_id is null and postgres_connection_id and database matches
 	// set the active pool id and active db properties in such tabs
-	_, err = c.DB.Exec("UPDATE tabs SET active_db_id = ?, active_db = ?, active_db_color = ? WHERE active_db_id IS NULL AND type = 'table' AND connection_id = ? AND db_name = ?", activePoolID.String(), activeDB, conn.Color, id, conn.Database)
+	_, err = c.DB.Exec("UPDATE tabs SET active_db_id = ?, active_db = ?, active_db_color = ? WHERE active_db_id IS NULL AND type IN ('table', 'erd') AND connection_id = ? AND db_name = ?", activePoolID.String(), activeDB, conn.Color, id, conn.Database)
 	if err != nil {
 		return nil, err
 	}
 
+	c.snapshotOnConnect(activePoolID, id, conn.Database)
+
 	return c.GetPostgresServerDatabases(id, activePoolID, conn.Database, conn.Name, conn.Color)
 }
 
@@ -572,8 +632,13 @@ func (c *Connections) GetPostgresServerDatabases(connectionID int64, activePoolI
 		return nil, errors.New("pool doesn't exist")
 	}
 
-	// Get Tables of active database
-	tables, err := c.GetAllPostgresTables(activePoolID)
+	// Get schemas and tables of active database
+	schemas, err := c.GetAllPostgresSchemas(activePoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	searchPath, err := c.GetSearchPath(activePoolID)
 	if err != nil {
 		return nil, err
 	}
@@ -608,8 +673,11 @@ func (c *Connections) GetPostgresServerDatabases(connectionID int64, activePoolI
 		if database.Name == activeDatabase {
 			database.PoolID = activePoolID.String()
 			database.IsActive = true
-			database.Tables = tables
+			database.Tables = schemaTables(schemas, defaultSchema)
 			database.Columns = columns
+			database.Schemas = schemas
+			database.SearchPath = searchPath
+			database.SuggestionTables = suggestionTables(schemas, searchPath)
 		}
 
 		databases = append(databases, database)
@@ -623,24 +691,38 @@ func (c *Connections) GetPostgresServerDatabases(connectionID int64, activePoolI
 	return databases, nil
 }
 
+// Get the tables of the public schema
 func (c *Connections) GetAllPostgresTables(activePoolID uuid.UUID) ([]string, error) {
+	schemas, err := c.GetAllPostgresSchemas(activePoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	return schemaTables(schemas, defaultSchema), nil
+}
+
+// Get all user schemas of the active database with their tables. System schemas are skipped.
+func (c *Connections) GetAllPostgresSchemas(activePoolID uuid.UUID) ([]model.Schema, error) {
 	pool, exists := c.PM.GetPool(activePoolID)
 	if !exists {
 		return nil, errors.New("pool doesn't exist")
 	}
 
-	// Get all tables
+	// Schemas without tables are listed too
 	query := `
-		SELECT 
-			c.oid AS table_oid, 
-			c.relname AS tablename
-		FROM 
-			pg_class c
-		JOIN 
-			pg_namespace n ON n.oid = c.relnamespace
-		WHERE 
-			n.nspname = 'public' 
-			AND c.relkind IN ('r', 'p');
+		SELECT
+			n.nspname AS schema_name,
+			COALESCE(c.oid, 0) AS table_oid,
+			COALESCE(c.relname, '') AS tablename
+		FROM
+			pg_namespace n
+		LEFT JOIN
+			pg_class c ON c.relnamespace = n.oid AND c.relkind IN ('r', 'p')
+		WHERE
+			n.nspname !~ '^pg_'
+			AND n.nspname <> 'information_schema'
+		ORDER BY
+			n.nspname, c.relname;
 	`
 	rows, err := pool.Query(context.TODO(), query)
 	if err != nil {
@@ -648,29 +730,92 @@ func (c *Connections) GetAllPostgresTables(activePoolID uuid.UUID) ([]string, er
 	}
 	defer rows.Close()
 
-	// Slice to hold results
-	var tables []string
+	var schemas []model.Schema
 
-	// Iterate through the rows
 	for rows.Next() {
+		var schemaName, table string
 		var tableOID uint32
-		var table string
-		err := rows.Scan(&tableOID, &table)
+		err := rows.Scan(&schemaName, &tableOID, &table)
 		if err != nil {
 			return nil, err
 		}
 
-		tables = append(tables, table)
+		if len(schemas) == 0 || schemas[len(schemas)-1].Name != schemaName {
+			schemas = append(schemas, model.Schema{Name: schemaName})
+		}
+		if table == "" {
+			continue
+		}
+
+		schema := &schemas[len(schemas)-1]
+		schema.Tables = append(schema.Tables, table)
 
-		c.setTableOidNameMap(activePoolID, tableOID, table)
+		c.setTableOidNameMap(activePoolID, tableOID, schemaName, table)
 	}
 
-	// Check for any error encountered during iteration
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return tables, nil
+	return schemas, nil
+}
+
+// Get the schemas of the effective search_path of the active database, in resolution order
+func (c *Connections) GetSearchPath(activePoolID uuid.UUID) ([]string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	var searchPath []string
+	err := pool.QueryRow(context.TODO(), "SELECT current_schemas(false)").Scan(&searchPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchPath, nil
+}
+
+// Get the tables of a schema
+func schemaTables(schemas []model.Schema, name string) []string {
+	for _, schema := range schemas {
+		if schema.Name == name {
+			return schema.Tables
+		}
+	}
+	return nil
+}
+
+// Build the table suggestions of the editor. Names resolved through the search_path are
+// unqualified, any other table is schema qualified.
+func suggestionTables(schemas []model.Schema, searchPath []string) []string {
+	var tables []string
+	resolved := make(map[string]struct{})
+	inSearchPath := make(map[string]struct{}, len(searchPath))
+
+	for _, name := range searchPath {
+		inSearchPath[name] = struct{}{}
+		for _, table := range schemaTables(schemas, name) {
+			if _, ok := resolved[table]; ok {
+				// Shadowed by a schema earlier in the search_path
+				tables = append(tables, name+"."+table)
+				continue
+			}
+			resolved[table] = struct{}{}
+			tables = append(tables, table)
+		}
+	}
+
+	for _, schema := range schemas {
+		if _, ok := inSearchPath[schema.Name]; ok {
+			continue
+		}
+		for _, table := range schema.Tables {
+			tables = append(tables, schema.Name+"."+table)
+		}
+	}
+
+	return tables
 }
 
 // Get all columns of the active database across all tables
@@ -721,6 +866,11 @@ func (c *Connections) TerminatePostgresDatabaseConnection(activePoolID string, i
 	if err != nil {
 		return false, err
 	}
+	// The listener connection and the connections of jobs have to go back to the pool before
+	// it's closed
+	c.stopNotificationListener(activePoolIDUUID)
+	c.stopPoolJobs(activePoolIDUUID)
+
 	// Remove the db pool from active pools
 	err = c.PM.DeletePool(activePoolIDUUID, id)
 	if err != nil {
@@ -728,6 +878,7 @@ func (c *Connections) TerminatePostgresDatabaseConnection(activePoolID string, i
 	}
 
 	c.deleteTableOidNameMap(activePoolIDUUID)
+	c.StopActivityMonitor(activePoolIDUUID)
 
 	// Remove the pool from all the tabs in which it's saved
 	_, err = c.DB.Exec("UPDATE tabs SET active_db_id = NULL, active_db = NULL, active_db_color = NULL WHERE active_db_id = ?", activePoolID)
@@ -746,10 +897,14 @@ func (c *Connections) TerminateAllDatabaseConnections() error {
 
 	for id, pool := range c.PM.Pools {
 		activeDBIds = append(activeDBIds, id.String())
+		c.stopNotificationListener(id)
+		c.stopPoolJobs(id)
 		pool.Close()
 		delete(c.PM.Pools, id)
+		delete(c.PM.PoolInfos, id)
 
 		c.deleteTableOidNameMap(id)
+		c.StopActivityMonitor(id)
 	}
 
 	// Build placeholders (?, ?, ?)
@@ -796,41 +951,50 @@ func isWriteOperation(query string) bool {
 }
 
 func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID int64, isExplain bool) model.QueryResult {
-	if isExplain {
-		query = "EXPLAIN " + query
+	return c.executeQuery(activePoolID, query, tabID, isExplain, nil, true)
+}
+
+// ExecuteQueryWithParams executes a query with positional $1 and named :name parameters.
+// The values are sent as bind parameters, they are never interpolated into the query.
+func (c *Connections) ExecuteQueryWithParams(activePoolID uuid.UUID, query string, tabID int64, isExplain bool, params map[string]model.QueryParam) model.QueryResult {
+	boundQuery, args, err := bindQueryParams(query, params)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
 	}
 
-	pool, exists := c.PM.GetPool(activePoolID)
-	if !exists {
+	return c.executeQuery(activePoolID, boundQuery, tabID, isExplain, args, true)
+}
+
+// executeQuery runs a query of a tab. Successful queries are saved to the history when recordHistory is set.
+func (c *Connections) executeQuery(activePoolID uuid.UUID, query string, tabID int64, isExplain bool, args []any, recordHistory bool) model.QueryResult {
+	if _, exists := c.PM.GetPool(activePoolID); !exists {
 		return model.QueryResult{OK: false, Message: "pool doesn't exist"}
 	}
 
 	// --- 1. CONCURRENCY CONTROL & TIMEOUT SETUP ---
-	c.mu.Lock()
-	if c.activeQueries == nil {
-		c.activeQueries = make(map[int64]context.CancelFunc)
-	}
-
-	// Prevent running if this tab is already executing a query
-	if _, isRunning := c.activeQueries[tabID]; isRunning {
-		c.mu.Unlock()
-		return model.QueryResult{OK: false, Message: "A query is already running on this tab"}
+	ctx, cancel, err := c.startTabQuery(tabID, queryTimeout)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
 	}
 
-	// Set a timeout (e.g., 30 seconds). You can adjust this duration.
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	c.activeQueries[tabID] = cancel
-	c.mu.Unlock()
-
 	// Ensure the tab is freed up when the function returns
-	defer func() {
-		cancel() // Free context resources
-		c.mu.Lock()
-		delete(c.activeQueries, tabID)
-		c.mu.Unlock()
-	}()
+	defer c.finishTabQuery(tabID, cancel)
 	// ----------------------------------------------
 
+	return c.runQuery(ctx, cancel, activePoolID, query, isExplain, args, recordHistory)
+}
+
+// runQuery runs a query until ctx is done, cancel stops the query once enough rows were read
+func (c *Connections) runQuery(ctx context.Context, cancel context.CancelFunc, activePoolID uuid.UUID, query string, isExplain bool, args []any, recordHistory bool) model.QueryResult {
+	if isExplain {
+		query = "EXPLAIN " + query
+	}
+
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return model.QueryResult{OK: false, Message: "pool doesn't exist"}
+	}
+
 	response := model.QueryResult{OK: true}
 	normalizedQuery := strings.ToLower(strings.TrimSpace(query))
 	isWrite := isWriteOperation(normalizedQuery)
@@ -838,7 +1002,7 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 	startTime := time.Now()
 
 	if isWrite {
-		tag, err := pool.Exec(ctx, query)
+		tag, err := pool.Exec(ctx, query, args...)
 		if err != nil {
 			return c.handleQueryError(err)
 		}
@@ -846,7 +1010,7 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 		response.Columns = []string{"Rows Affected"}
 		response.Rows = [][]model.Cell{{model.Cell{Column: "Rows Affected", Value: fmt.Sprintf("%d", response.RowsAffected)}}}
 	} else {
-		resultRows, err := pool.Query(ctx, query)
+		resultRows, err := pool.Query(ctx, query, args...)
 		if err != nil {
 			return c.handleQueryError(err)
 		}
@@ -854,7 +1018,6 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 
 		// Table oid set
 		tableOidSet := make(map[uint32]struct{})
-		idExists := false
 
 		columns := resultRows.FieldDescriptions()
 		columnNames := make([]string, len(columns))
@@ -862,20 +1025,33 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 			columnName := string(column.Name)
 			columnNames[i] = columnName
 			tableOidSet[column.TableOID] = struct{}{}
-			if columnName == "id" {
-				idExists = true
-			}
 		}
 		response.Columns = columnNames
 
-		// Set response table name if query output contains only one table data and has an id column
-		if len(tableOidSet) == 1 && idExists {
+		// Set response table name if query output contains only one table data and has the key columns of the table
+		var keys *rowKeys
+		if len(tableOidSet) == 1 {
 			for oid := range tableOidSet {
-				response.TableName = c.getTableOidNameMap(activePoolID, oid)
+				table := c.getTableOidNameMap(activePoolID, oid)
+				if table.Name == "" {
+					continue
+				}
+				var reason string
+				keys, reason, err = newRowKeys(ctx, pool, table.Schema, table.Name, resultRows)
+				if err != nil {
+					return model.QueryResult{OK: false, Message: err.Error()}
+				}
+				if keys != nil {
+					response.TableSchema = table.Schema
+					response.TableName = table.Name
+					response.KeyColumns = keys.columns
+				}
+				response.ReadOnlyReason = reason
 			}
 		}
 
 		var rows [][]model.Cell
+		var rowKeys []model.RowKey
 
 		// Define your memory limit (e.g., 5 Megabytes)
 		const maxAllowedBytes = 5 * 1024 * 1024
@@ -888,6 +1064,8 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 				// Return partial results collected so far
 				cancel()
 				response.Rows = rows
+				response.RowKeys = rowKeys
+				response.Partial = true
 				response.Message = "Query timed out after 30 seconds. Partial results returned."
 				response.ExecutionTime = time.Since(startTime).Milliseconds()
 				return response
@@ -900,6 +1078,14 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 				return model.QueryResult{OK: false, Message: err.Error()}
 			}
 
+			if keys != nil {
+				key, err := keys.key(row)
+				if err != nil {
+					return model.QueryResult{OK: false, Message: err.Error()}
+				}
+				rowKeys = append(rowKeys, key)
+			}
+
 			cells := make([]model.Cell, 0, len(row))
 			for i, cell := range row {
 				newCell := model.Cell{Column: columnNames[i]}
@@ -939,6 +1125,8 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 				// Call cancel() to tell PostgreSQL to stop sending data over the network
 				cancel()
 				response.Rows = rows
+				response.RowKeys = rowKeys
+				response.Partial = true
 				response.Message = "Result set exceeded 5MB limit. Partial results returned. Please add a LIMIT clause to your query."
 				response.ExecutionTime = time.Since(startTime).Milliseconds()
 				return response
@@ -950,6 +1138,8 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 			// return the partial results with a warning instead of failing
 			if (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) && len(rows) > 0 {
 				response.Rows = rows
+				response.RowKeys = rowKeys
+				response.Partial = true
 				response.Message = "Query timed out. Partial results returned."
 				response.ExecutionTime = time.Since(startTime).Milliseconds()
 				return response
@@ -958,17 +1148,51 @@ func (c *Connections) ExecuteQuery(activePoolID uuid.UUID, query string, tabID i
 		}
 
 		response.Rows = rows
+		response.RowKeys = rowKeys
 	}
 
 	// Save successful query to history
-	if _, err := c.DB.Exec(`INSERT INTO query_history (query) VALUES (?)`, query); err != nil {
-		log.Printf("failed to save query to history: %v", err)
+	if recordHistory {
+		if _, err := c.DB.Exec(`INSERT INTO query_history (query) VALUES (?)`, query); err != nil {
+			log.Printf("failed to save query to history: %v", err)
+		}
 	}
 
 	response.ExecutionTime = time.Since(startTime).Milliseconds()
 	return response
 }
 
+// Time a query of a tab may run
+const queryTimeout = 30 * time.Second
+
+// Register a running query on the tab. A tab can only run one query at a time.
+func (c *Connections) startTabQuery(tabID int64, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.activeQueries == nil {
+		c.activeQueries = make(map[int64]context.CancelFunc)
+	}
+
+	// Prevent running if this tab is already executing a query
+	if _, isRunning := c.activeQueries[tabID]; isRunning {
+		return nil, nil, errors.New("A query is already running on this tab")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	c.activeQueries[tabID] = cancel
+
+	return ctx, cancel, nil
+}
+
+// Free the tab for the next query
+func (c *Connections) finishTabQuery(tabID int64, cancel context.CancelFunc) {
+	cancel() // Free context resources
+	c.mu.Lock()
+	delete(c.activeQueries, tabID)
+	c.mu.Unlock()
+}
+
 // Helper to handle standard vs timeout errors consistently
 func (c *Connections) handleQueryError(err error) model.QueryResult {
 	// Check if the error was caused by our context timing out or being canceled
@@ -985,11 +1209,26 @@ func (c *Connections) handleQueryError(err error) model.QueryResult {
 		Message:      err.Error(),
 		RowsAffected: 0,
 		Columns:      []string{"Error"},
+		Failed:       true,
 		Rows:         [][]model.Cell{{model.Cell{Column: "Error", Value: err.Error()}}},
 	}
 }
 
 func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableName, selectQuery, limit, offset, where, orderBy, groupBy string, isPageData bool) model.QueryResult {
+	filter := model.TableFilter{
+		Mode:       model.FilterModeRaw,
+		RawSelect:  selectQuery,
+		RawWhere:   where,
+		RawOrderBy: orderBy,
+		RawGroupBy: groupBy,
+	}
+
+	return c.GetFilteredTableData(activePoolID, tabID, defaultSchema, tableName, filter, limit, offset, isPageData)
+}
+
+// GetFilteredTableData returns a page of table rows. Structured filters are compiled with quoted
+// identifiers and bind parameters, raw filters are used as written.
+func (c *Connections) GetFilteredTableData(activePoolID uuid.UUID, tabID int64, schema, tableName string, filter model.TableFilter, limit, offset string, isPageData bool) model.QueryResult {
 	pool, exists := c.PM.GetPool(activePoolID)
 	if !exists {
 		return model.QueryResult{OK: false, Message: "pool doesn't exist"}
@@ -999,7 +1238,7 @@ func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableNam
 
 	response := model.QueryResult{OK: true}
 
-	setLimit := strconv.Itoa(20)
+	setLimit := 20
 	if strings.TrimSpace(limit) != "" {
 		limitInt, err := strconv.Atoi(strings.TrimSpace(limit))
 		if err != nil {
@@ -1008,68 +1247,75 @@ func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableNam
 		if limitInt > 100 {
 			return model.QueryResult{OK: false, Message: "limit cannot be greater than 100"}
 		}
-		setLimit = strings.TrimSpace(limit)
+		setLimit = limitInt
 	}
 
-	if strings.TrimSpace(selectQuery) == "" {
-		selectQuery = "*"
+	setOffset := 0
+	if strings.TrimSpace(offset) != "" {
+		offsetInt, err := strconv.Atoi(strings.TrimSpace(offset))
+		if err != nil || offsetInt < 0 {
+			return model.QueryResult{OK: false, Message: "offset is not a valid number"}
+		}
+		setOffset = offsetInt
 	}
 
-	query := fmt.Sprintf("SELECT %s FROM %s", selectQuery, tableName)
-	if strings.TrimSpace(where) != "" {
-		query += fmt.Sprintf(" WHERE %s", strings.TrimSpace(where))
-	}
-	if strings.TrimSpace(groupBy) != "" {
-		query += fmt.Sprintf(" GROUP BY %s", strings.TrimSpace(groupBy))
+	// Structured filters are validated against the columns of the table
+	var tableColumns []model.ColumnInfo
+	if filter.Mode != model.FilterModeRaw {
+		var err error
+		tableColumns, err = getTableColumns(ctx, pool, schema, tableName)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
 	}
-	if strings.TrimSpace(orderBy) != "" {
-		query += fmt.Sprintf(" ORDER BY %s", strings.TrimSpace(orderBy))
-	} else {
-		query += " ORDER BY 1"
+
+	tableQuery, err := compileTableFilter(schema, tableName, tableColumns, filter)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
 	}
 
 	if !isPageData {
-		// Get total rows count
-		totalRowsQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)
-		if strings.TrimSpace(where) != "" {
-			totalRowsQuery += fmt.Sprintf(" WHERE %s", strings.TrimSpace(where))
-		}
-		if strings.TrimSpace(groupBy) != "" {
-			totalRowsQuery += fmt.Sprintf(" GROUP BY %s", strings.TrimSpace(groupBy))
-		}
-
-		// Get total rows count
-		var totalRows int64
-		err := pool.QueryRow(ctx, totalRowsQuery).Scan(&totalRows)
+		// Get total rows count, estimated for big tables. StartExactCount counts them exactly.
+		totalRows, estimated, err := countTableRows(ctx, pool, tableQuery)
 		if err != nil {
 			return model.QueryResult{
 				OK:           true,
 				Message:      err.Error(),
 				RowsAffected: int64(0),
 				Columns:      []string{"Error"},
+				Failed:       true,
 				Rows:         [][]model.Cell{{model.Cell{Column: "Error", Value: err.Error()}}},
 			}
 		}
 		response.TotalRows = totalRows
+		response.TotalRowsEstimated = estimated
+	}
+	if setLimit > 0 {
+		response.CurrentPage = int64(setOffset/setLimit) + 1
 	}
 
-	// Set limit
-	query += fmt.Sprintf(" LIMIT %s", setLimit)
-
-	if strings.TrimSpace(offset) != "" {
-		query += fmt.Sprintf(" OFFSET %s", strings.TrimSpace(offset))
+	// xmin of the rows guards their edits against concurrent changes
+	versioned := false
+	if filter.Mode != model.FilterModeRaw {
+		versioned, err = tableQuery.withRowVersion(ctx, pool)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
 	}
 
+	query := tableQuery.rowsSQL(setLimit, setOffset)
+
 	start := time.Now()
 
 	// Use Query for read operations
-	resultRows, err := pool.Query(ctx, query)
+	resultRows, err := pool.Query(ctx, query, tableQuery.args...)
 	if err != nil {
 		return model.QueryResult{
 			OK:           true,
 			Message:      err.Error(),
 			RowsAffected: int64(0),
 			Columns:      []string{"Error"},
+			Failed:       true,
 			Rows:         [][]model.Cell{{model.Cell{Column: "Error", Value: err.Error()}}},
 		}
 	}
@@ -1080,8 +1326,22 @@ func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableNam
 	for i, column := range columns {
 		columnNames[i] = string(column.Name)
 	}
+	if versioned {
+		columnNames = columnNames[:len(columnNames)-1]
+	}
 	response.Columns = columnNames
 
+	keys, reason, err := newRowKeys(ctx, pool, schema, tableName, resultRows)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
+	}
+	if keys != nil {
+		response.TableSchema = schemaOrDefault(schema)
+		response.TableName = tableName
+		response.KeyColumns = keys.columns
+	}
+	response.ReadOnlyReason = reason
+
 	var rows [][]model.Cell
 
 	for resultRows.Next() {
@@ -1090,6 +1350,20 @@ func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableNam
 			return model.QueryResult{OK: false, Message: err.Error()}
 		}
 
+		if versioned {
+			var version string
+			row, version = splitRowVersion(row)
+			response.RowVersions = append(response.RowVersions, version)
+		}
+
+		if keys != nil {
+			key, err := keys.key(row)
+			if err != nil {
+				return model.QueryResult{OK: false, Message: err.Error()}
+			}
+			response.RowKeys = append(response.RowKeys, key)
+		}
+
 		cells := []model.Cell{}
 		for i, cell := range row {
 			newCell := model.Cell{
@@ -1124,10 +1398,19 @@ func (c *Connections) GetTableData(activePoolID uuid.UUID, tabID int64, tableNam
 	response.Rows = rows
 	response.ExecutionTime = time.Since(start).Milliseconds()
 
+	c.saveTabPagination(tabID, response, !isPageData)
+
 	return response
 }
 
 func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*model.TableInfo, error) {
+	return c.GetSchemaTableInfo(activePoolID, defaultSchema, tableName)
+}
+
+// GetSchemaTableInfo returns the structure, indexes and rules of a table of the given schema
+func (c *Connections) GetSchemaTableInfo(activePoolID uuid.UUID, schema, tableName string) (*model.TableInfo, error) {
+	schema = schemaOrDefault(schema)
+
 	pool, exists := c.PM.GetPool(activePoolID)
 	if !exists {
 		return nil, errors.New("pool doesn't exist")
@@ -1142,14 +1425,19 @@ func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*m
 				kcu.table_schema,
 				kcu.table_name,
 				kcu.column_name,
-				string_agg(ccu.table_name || '.' || ccu.column_name, ', ') AS foreign_keys
+				-- referenced tables of another schema are schema qualified
+				string_agg(
+					CASE WHEN ccu.table_schema = kcu.table_schema THEN '' ELSE ccu.table_schema || '.' END
+						|| ccu.table_name || '.' || ccu.column_name,
+					', '
+				) AS foreign_keys
 			FROM information_schema.table_constraints tc
 			JOIN information_schema.key_column_usage kcu
 				ON tc.constraint_name = kcu.constraint_name
 			AND tc.table_schema = kcu.table_schema
 			JOIN information_schema.constraint_column_usage ccu
 				ON ccu.constraint_name = tc.constraint_name
-			AND ccu.table_schema = tc.table_schema
+			AND ccu.constraint_schema = tc.constraint_schema
 			WHERE tc.constraint_type = 'FOREIGN KEY'
 			GROUP BY kcu.table_schema, kcu.table_name, kcu.column_name
 		),
@@ -1196,10 +1484,10 @@ func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*m
 			ON pgd.objoid = st.relid
 		AND pgd.objsubid = c.ordinal_position
 		WHERE c.table_name = $1
-		AND c.table_schema = 'public'
+		AND c.table_schema = $2
 		ORDER BY c.ordinal_position;
 	`
-	resultRows, err := pool.Query(ctx, query, tableName)
+	resultRows, err := pool.Query(ctx, query, tableName, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -1266,16 +1554,25 @@ func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*m
 			pg_get_expr(idx.indpred, idx.indrelid)     AS condition,
 			-- included (non-key) columns, if present (v11+); otherwise NULL
 			substring(pg_get_indexdef(idx.indexrelid) from 'INCLUDE \(([^)]*)\)') AS include,
+			idx.indisvalid                             AS is_valid,
+			COALESCE(s.idx_scan, 0)                    AS scans,
+			-- last_idx_scan exists from v16, NULL before
+			to_jsonb(s) ->> 'last_idx_scan'            AS last_used,
+			pg_size_pretty(pg_relation_size(i.oid))    AS size,
+			COALESCE(io.idx_blks_read, 0)              AS blocks_read,
+			round(100.0 * io.idx_blks_hit / NULLIF(io.idx_blks_hit + io.idx_blks_read, 0), 2)::text AS cache_hit_ratio,
 			obj_description(i.oid, 'pg_class')         AS comment
 		FROM pg_class t
 		JOIN pg_index idx ON t.oid = idx.indrelid
 		JOIN pg_class i   ON i.oid = idx.indexrelid
 		JOIN pg_am am     ON i.relam = am.oid
+		LEFT JOIN pg_stat_user_indexes s    ON s.indexrelid = idx.indexrelid
+		LEFT JOIN pg_statio_user_indexes io ON io.indexrelid = idx.indexrelid
 		WHERE t.relname = $1
-		AND t.relnamespace = 'public'::regnamespace  -- adjust schema if needed
+		AND t.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = $2)
 		ORDER BY i.relname DESC;
 	`
-	resultRows, err = pool.Query(ctx, query, tableName)
+	resultRows, err = pool.Query(ctx, query, tableName, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -1348,10 +1645,10 @@ func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*m
 		JOIN pg_class rel   ON rel.oid = con.conrelid
 		JOIN pg_namespace n ON n.oid = rel.relnamespace
 		WHERE rel.relname = $1
-		AND n.nspname = 'public'   -- adjust schema if needed
+		AND n.nspname = $2
 		ORDER BY con.contype ASC;
 	`
-	resultRows, err = pool.Query(ctx, query, tableName)
+	resultRows, err = pool.Query(ctx, query, tableName, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -1408,61 +1705,75 @@ func (c *Connections) GetTableInfo(activePoolID uuid.UUID, tableName string) (*m
 	return &model.TableInfo{Structure: structure, Indexes: indexes, Rules: rules}, nil
 }
 
+// UpdateCells saves edited cells in one transaction through the row edit path
 func (c *Connections) UpdateCells(activePoolID uuid.UUID, updateCells []model.UpdateCell) (bool, error) {
-	pool, exists := c.PM.GetPool(activePoolID)
-	if !exists {
-		return false, errors.New("pool doesn't exist")
-	}
-
-	// 1. Initialize a new batch
-	batch := &pgx.Batch{}
-
-	for _, u := range updateCells {
-		// 2. SAFELY construct the query using pgx.Identifier for table/column names.
-		// This translates "my_table" to `"my_table"` and prevents SQL injection.
-		safeTable := pgx.Identifier{u.TableName}.Sanitize()
-		safeColumn := pgx.Identifier{u.ColumnName}.Sanitize()
+	edits := make([]model.RowEdit, len(updateCells))
+	for i, u := range updateCells {
+		key := u.Key
+		if len(key) == 0 && u.RowID != 0 {
+			key = model.RowKey{"id": strconv.FormatInt(u.RowID, 10)}
+		}
 
-		// Construct the final query string
-		query := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2", safeTable, safeColumn)
+		// Values arrive decoded from JSON
+		var value *string
+		switch v := u.Value.(type) {
+		case nil:
+		case string:
+			value = &v
+		case float64:
+			text := strconv.FormatFloat(v, 'f', -1, 64)
+			value = &text
+		case bool:
+			text := strconv.FormatBool(v)
+			value = &text
+		case map[string]any, []any:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode the value of cell %s: %w", u.CellID, err)
+			}
+			text := string(data)
+			value = &text
+		default:
+			return false, fmt.Errorf("unsupported value of cell %s: %T", u.CellID, v)
+		}
 
-		// 3. Queue the query with the actual parameterized values
-		batch.Queue(query, u.Value, u.RowID)
+		edits[i] = model.RowEdit{
+			Kind:     model.RowEditUpdate,
+			Schema:   u.SchemaName,
+			Table:    u.TableName,
+			Key:      key,
+			Values:   map[string]*string{u.ColumnName: value},
+			Original: u.Original,
+			XMin:     u.XMin,
+		}
 	}
 
-	// 4. Send the batch to the database
-	br := pool.SendBatch(context.Background(), batch)
-
-	// 5. CRITICAL: You must ensure the batch results are closed to release the connection
-	defer br.Close()
-
-	// 6. Verify the results. You must call Exec() (or QueryRow) for EVERY item you queued.
-	for i := 0; i < len(updateCells); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			// If one fails, the whole batch transaction rolls back automatically
-			return false, fmt.Errorf("failed to update cell %s (table: %s, row: %d): %w",
-				updateCells[i].CellID, updateCells[i].TableName, updateCells[i].RowID, err)
-		}
+	result, err := c.ApplyRowEdits(activePoolID, edits, false)
+	if err != nil {
+		return false, err
+	}
+	if len(result.Conflicts) > 0 {
+		conflict := result.Conflicts[0]
+		return false, fmt.Errorf("failed to update cell %s (table: %s): %s", updateCells[conflict.Edit].CellID, updateCells[conflict.Edit].TableName, conflict.Message)
 	}
 
 	return true, nil
 }
 
-func (c *Connections) setTableOidNameMap(activePoolID uuid.UUID, tableOid uint32, tableName string) {
+func (c *Connections) setTableOidNameMap(activePoolID uuid.UUID, tableOid uint32, schema, tableName string) {
 	c.tableMu.Lock()
 	defer c.tableMu.Unlock()
 	if c.tableOidNameMap[activePoolID] == nil {
-		c.tableOidNameMap[activePoolID] = make(map[uint32]string)
+		c.tableOidNameMap[activePoolID] = make(map[uint32]tableRef)
 	}
-	c.tableOidNameMap[activePoolID][tableOid] = tableName
+	c.tableOidNameMap[activePoolID][tableOid] = tableRef{Schema: schema, Name: tableName}
 }
 
-func (c *Connections) getTableOidNameMap(activePoolID uuid.UUID, tableOid uint32) string {
+func (c *Connections) getTableOidNameMap(activePoolID uuid.UUID, tableOid uint32) tableRef {
 	c.tableMu.RLock()
 	defer c.tableMu.RUnlock()
 	if c.tableOidNameMap[activePoolID] == nil {
-		return ""
+		return tableRef{}
 	}
 	return c.tableOidNameMap[activePoolID][tableOid]
 }
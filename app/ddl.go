@@ -0,0 +1,981 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// Keywords which can't be used as identifiers without quotes, same as quote_ident
+var quotedKeywords = map[string]struct{}{}
+
+func init() {
+	for _, keyword := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric authorization between bigint binary bit
+		boolean both case cast char character check coalesce collate collation column concurrently
+		constraint create cross current_catalog current_date current_role current_schema current_time
+		current_timestamp current_user dec decimal default deferrable desc distinct do else end except
+		exists extract false fetch float for foreign freeze from full grant greatest group grouping
+		having ilike in initially inner inout int integer intersect interval into is isnull join json
+		json_array json_arrayagg json_exists json_object json_objectagg json_query json_scalar
+		json_serialize json_table json_value lateral leading least left like limit localtime
+		localtimestamp merge_action national natural nchar none normalize not notnull null nullif
+		numeric offset on only or order out outer overlaps overlay placing position precision primary
+		real references returning right row select session_user setof similar smallint some substring
+		symmetric system_user table tablesample then time timestamp to trailing treat trim true union
+		unique user using values varchar variadic verbose when where window with xmlattributes
+		xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse xmlpi xmlroot xmlserialize
+		xmltable
+	`) {
+		quotedKeywords[keyword] = struct{}{}
+	}
+}
+
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// quoteIdent quotes an identifier only when required, like quote_ident. Generated DDL stays readable.
+func quoteIdent(name string) string {
+	if _, ok := quotedKeywords[name]; !ok && plainIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteQualified(schema, name string) string {
+	return quoteIdent(schema) + "." + quoteIdent(name)
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Owner and acl columns of the catalogs whose objects have owners and grants
+var catalogACLColumns = map[string][2]string{
+	"pg_class":     {"relowner", "relacl"},
+	"pg_proc":      {"proowner", "proacl"},
+	"pg_type":      {"typowner", "typacl"},
+	"pg_namespace": {"nspowner", "nspacl"},
+}
+
+// Load the owner and the privileges granted to other roles on an object. Objects with default
+// privileges have no grants.
+func loadObjectGrants(ctx context.Context, q querier, catalog string, oid uint32) (string, []model.PrivilegeGrant, error) {
+	columns, ok := catalogACLColumns[catalog]
+	if !ok {
+		return "", nil, fmt.Errorf("objects of %s have no owner", catalog)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT pg_get_userbyid(o.%[1]s)::text, a.grantee, a.privilege_type, a.is_grantable
+		FROM %[3]s o
+		LEFT JOIN LATERAL (
+			SELECT
+				CASE WHEN x.grantee = 0 THEN 'PUBLIC' ELSE pg_get_userbyid(x.grantee)::text END AS grantee,
+				x.privilege_type,
+				x.is_grantable
+			FROM aclexplode(o.%[2]s) x
+			WHERE x.grantee <> o.%[1]s
+		) a ON true
+		WHERE o.oid = $1
+		ORDER BY a.grantee, a.is_grantable, a.privilege_type;
+	`, columns[0], columns[1], catalog)
+	rows, err := q.Query(ctx, query, oid)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var owner string
+	var grants []model.PrivilegeGrant
+	for rows.Next() {
+		var grantee, privilege *string
+		var grantable *bool
+		if err := rows.Scan(&owner, &grantee, &privilege, &grantable); err != nil {
+			return "", nil, err
+		}
+		if grantee == nil {
+			continue
+		}
+
+		// Privileges of a grantee are grouped by grant option
+		last := len(grants) - 1
+		if last < 0 || grants[last].Grantee != *grantee || grants[last].WithGrantOption != *grantable {
+			grants = append(grants, model.PrivilegeGrant{Grantee: *grantee, WithGrantOption: *grantable})
+			last++
+		}
+		grants[last].Privileges = append(grants[last].Privileges, *privilege)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+
+	return owner, grants, nil
+}
+
+// Look up the oid of an ordinary or partitioned table
+func lookupTableOID(ctx context.Context, q querier, schema, tableName string) (uint32, error) {
+	query := `
+		SELECT c.oid
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p');
+	`
+	var oid uint32
+	err := q.QueryRow(ctx, query, schemaOrDefault(schema), tableName).Scan(&oid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("table %s.%s does not exist", schemaOrDefault(schema), tableName)
+		}
+		return 0, err
+	}
+
+	return oid, nil
+}
+
+// loadTableDef reads the definition of a table from the catalogs
+func loadTableDef(ctx context.Context, q querier, schema, tableName string) (*model.TableDef, error) {
+	oid, err := lookupTableOID(ctx, q, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadTableDefByOID(ctx, q, oid)
+}
+
+func loadTableDefByOID(ctx context.Context, q querier, oid uint32) (*model.TableDef, error) {
+	def := &model.TableDef{OID: oid}
+
+	query := `
+		SELECT
+			n.nspname::text,
+			c.relname::text,
+			c.relpersistence = 'u',
+			CASE WHEN c.relkind = 'p' THEN pg_get_partkeydef(c.oid) ELSE '' END,
+			COALESCE((
+				SELECT format('%I.%I', pn.nspname, p.relname)
+				FROM pg_inherits i
+				JOIN pg_class p      ON p.oid = i.inhparent
+				JOIN pg_namespace pn ON pn.oid = p.relnamespace
+				WHERE i.inhrelid = c.oid AND c.relispartition
+			), ''),
+			CASE WHEN c.relispartition THEN pg_get_expr(c.relpartbound, c.oid) ELSE '' END,
+			ARRAY(
+				SELECT format('%I.%I', pn.nspname, p.relname)
+				FROM pg_inherits i
+				JOIN pg_class p      ON p.oid = i.inhparent
+				JOIN pg_namespace pn ON pn.oid = p.relnamespace
+				WHERE i.inhrelid = c.oid AND NOT c.relispartition
+				ORDER BY i.inhseqno
+			),
+			COALESCE(c.reloptions, '{}'),
+			COALESCE(obj_description(c.oid, 'pg_class'), '')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1 AND c.relkind IN ('r', 'p');
+	`
+	err := q.QueryRow(ctx, query, oid).Scan(&def.Schema, &def.Name, &def.Unlogged, &def.PartitionBy, &def.PartitionOf, &def.PartitionBound, &def.Inherits, &def.Options, &def.Comment)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("table with oid %d does not exist", oid)
+		}
+		return nil, err
+	}
+
+	// Columns
+	query = `
+		SELECT
+			a.attname::text,
+			format_type(a.atttypid, a.atttypmod),
+			a.attnotnull,
+			CASE WHEN a.attgenerated = '' THEN COALESCE(pg_get_expr(d.adbin, d.adrelid), '') ELSE '' END,
+			CASE a.attidentity WHEN 'a' THEN 'ALWAYS' WHEN 'd' THEN 'BY DEFAULT' ELSE '' END,
+			CASE WHEN a.attgenerated <> '' THEN pg_get_expr(d.adbin, d.adrelid) ELSE '' END,
+			COALESCE((
+				SELECT format('%I.%I', cn.nspname, co.collname)
+				FROM pg_collation co
+				JOIN pg_namespace cn ON cn.oid = co.collnamespace
+				JOIN pg_type t       ON t.oid = a.atttypid
+				WHERE co.oid = a.attcollation AND a.attcollation <> t.typcollation
+			), ''),
+			COALESCE(col_description(a.attrelid, a.attnum), ''),
+			NOT a.attislocal
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum;
+	`
+	rows, err := q.Query(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column model.ColumnDef
+		err := rows.Scan(&column.Name, &column.Type, &column.NotNull, &column.Default, &column.Identity, &column.Generated, &column.Collation, &column.Comment, &column.Inherited)
+		if err != nil {
+			return nil, err
+		}
+		def.Columns = append(def.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Constraints defined on the table itself, inherited ones are created with the parent
+	query = `
+		SELECT
+			con.conname::text,
+			con.contype::text,
+			pg_get_constraintdef(con.oid, true),
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			COALESCE((
+				SELECT format('%I.%I', fn.nspname, f.relname)
+				FROM pg_class f
+				JOIN pg_namespace fn ON fn.oid = f.relnamespace
+				WHERE f.oid = con.confrelid
+			), ''),
+			COALESCE(obj_description(con.oid, 'pg_constraint'), '')
+		FROM pg_constraint con
+		WHERE con.conrelid = $1
+		  AND con.conislocal
+		  AND con.contype IN ('p', 'u', 'c', 'x', 'f')
+		ORDER BY array_position(ARRAY['p', 'u', 'c', 'x', 'f'], con.contype::text), con.conname;
+	`
+	rows, err = q.Query(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var constraint model.ConstraintDef
+		err := rows.Scan(&constraint.Name, &constraint.Type, &constraint.Definition, &constraint.Columns, &constraint.References, &constraint.Comment)
+		if err != nil {
+			return nil, err
+		}
+		def.Constraints = append(def.Constraints, constraint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Indexes which don't back a constraint and aren't attached to an index of the parent
+	query = `
+		SELECT
+			i.relname::text,
+			pg_get_indexdef(idx.indexrelid),
+			am.amname::text,
+			idx.indisunique,
+			ARRAY(
+				SELECT pg_get_indexdef(idx.indexrelid, k.ord, true)
+				FROM generate_series(1, idx.indnkeyatts::int) AS k(ord)
+				ORDER BY k.ord
+			),
+			COALESCE(obj_description(i.oid, 'pg_class'), '')
+		FROM pg_index idx
+		JOIN pg_class i ON i.oid = idx.indexrelid
+		JOIN pg_am am   ON am.oid = i.relam
+		WHERE idx.indrelid = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint con
+			WHERE con.conindid = idx.indexrelid AND con.conrelid = idx.indrelid AND con.contype IN ('p', 'u', 'x')
+		  )
+		  AND NOT EXISTS (SELECT 1 FROM pg_inherits inh WHERE inh.inhrelid = idx.indexrelid)
+		ORDER BY i.relname;
+	`
+	rows, err = q.Query(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index model.IndexDef
+		err := rows.Scan(&index.Name, &index.Definition, &index.Method, &index.IsUnique, &index.Columns, &index.Comment)
+		if err != nil {
+			return nil, err
+		}
+		def.Indexes = append(def.Indexes, index)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	def.Owner, def.Grants, err = loadObjectGrants(ctx, q, "pg_class", oid)
+	if err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+func columnSQL(column model.ColumnDef) string {
+	parts := []string{quoteIdent(column.Name), column.Type}
+	if column.Collation != "" {
+		parts = append(parts, "COLLATE "+column.Collation)
+	}
+	switch {
+	case column.Generated != "":
+		parts = append(parts, "GENERATED ALWAYS AS ("+column.Generated+") STORED")
+	case column.Identity != "":
+		parts = append(parts, "GENERATED "+column.Identity+" AS IDENTITY")
+	case column.Default != "":
+		parts = append(parts, "DEFAULT "+column.Default)
+	}
+	if column.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	return strings.Join(parts, " ")
+}
+
+func addConstraintSQL(def *model.TableDef, constraint model.ConstraintDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", quoteQualified(def.Schema, def.Name), quoteIdent(constraint.Name), constraint.Definition)
+}
+
+// createTableSQL renders the CREATE TABLE statement of a table. Foreign keys can be left out to be
+// added once all tables of a script exist.
+func createTableSQL(def *model.TableDef, withForeignKeys bool) string {
+	var b strings.Builder
+
+	b.WriteString("CREATE ")
+	if def.Unlogged {
+		b.WriteString("UNLOGGED ")
+	}
+	b.WriteString("TABLE " + quoteQualified(def.Schema, def.Name))
+
+	if def.PartitionOf != "" {
+		// Partitions get their columns from the parent
+		b.WriteString(" PARTITION OF " + def.PartitionOf + "\n" + def.PartitionBound)
+	} else {
+		var lines []string
+		for _, column := range def.Columns {
+			if !column.Inherited {
+				lines = append(lines, "    "+columnSQL(column))
+			}
+		}
+		for _, constraint := range def.Constraints {
+			if constraint.Type == model.ConstraintForeignKey && !withForeignKeys {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("    CONSTRAINT %s %s", quoteIdent(constraint.Name), constraint.Definition))
+		}
+		b.WriteString(" (\n" + strings.Join(lines, ",\n") + "\n)")
+		if len(def.Inherits) > 0 {
+			b.WriteString("\nINHERITS (" + strings.Join(def.Inherits, ", ") + ")")
+		}
+	}
+
+	if def.PartitionBy != "" {
+		b.WriteString("\nPARTITION BY " + def.PartitionBy)
+	}
+	if len(def.Options) > 0 {
+		b.WriteString("\nWITH (" + strings.Join(def.Options, ", ") + ")")
+	}
+	b.WriteString(";\n")
+
+	// Constraints of a partition can't be declared inline
+	if def.PartitionOf != "" {
+		for _, constraint := range def.Constraints {
+			if constraint.Type == model.ConstraintForeignKey && !withForeignKeys {
+				continue
+			}
+			b.WriteString(addConstraintSQL(def, constraint))
+		}
+	}
+
+	return b.String()
+}
+
+// Render the foreign keys of a table as ALTER TABLE statements
+func foreignKeysSQL(def *model.TableDef) string {
+	var b strings.Builder
+	for _, constraint := range def.Constraints {
+		if constraint.Type == model.ConstraintForeignKey {
+			b.WriteString(addConstraintSQL(def, constraint))
+		}
+	}
+	return b.String()
+}
+
+func ownerSQL(objectType, name, owner string) string {
+	if owner == "" {
+		return ""
+	}
+	return fmt.Sprintf("ALTER %s %s OWNER TO %s;\n", objectType, name, quoteIdent(owner))
+}
+
+func commentSQL(objectType, name, comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return fmt.Sprintf("COMMENT ON %s %s IS %s;\n", objectType, name, quoteLiteral(comment))
+}
+
+func grantsSQL(objectType, name string, grants []model.PrivilegeGrant) string {
+	var b strings.Builder
+	for _, grant := range grants {
+		grantee := grant.Grantee
+		if grantee != "PUBLIC" {
+			grantee = quoteIdent(grantee)
+		}
+		b.WriteString(fmt.Sprintf("GRANT %s ON %s %s TO %s", strings.Join(grant.Privileges, ", "), objectType, name, grantee))
+		if grant.WithGrantOption {
+			b.WriteString(" WITH GRANT OPTION")
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// Render the indexes, comments, owner and grants of a table
+func tableExtrasSQL(def *model.TableDef) string {
+	return tableDetailsSQL(def) + tableOwnershipSQL(def)
+}
+
+// Render the indexes and comments of a table
+func tableDetailsSQL(def *model.TableDef) string {
+	var b strings.Builder
+	name := quoteQualified(def.Schema, def.Name)
+
+	for _, index := range def.Indexes {
+		b.WriteString(index.Definition + ";\n")
+	}
+
+	b.WriteString(commentSQL("TABLE", name, def.Comment))
+	for _, column := range def.Columns {
+		b.WriteString(commentSQL("COLUMN", name+"."+quoteIdent(column.Name), column.Comment))
+	}
+	for _, constraint := range def.Constraints {
+		b.WriteString(commentSQL("CONSTRAINT", quoteIdent(constraint.Name)+" ON "+name, constraint.Comment))
+	}
+	for _, index := range def.Indexes {
+		b.WriteString(commentSQL("INDEX", quoteQualified(def.Schema, index.Name), index.Comment))
+	}
+
+	return b.String()
+}
+
+// Render the owner and grants of a table
+func tableOwnershipSQL(def *model.TableDef) string {
+	name := quoteQualified(def.Schema, def.Name)
+	return ownerSQL("TABLE", name, def.Owner) + grantsSQL("TABLE", name, def.Grants)
+}
+
+// Catalog and SQL keywords of the object kinds
+var objectKindDDL = map[string]struct {
+	catalog string
+	keyword string
+	grantOn string
+}{
+	model.ObjectKindView:             {"pg_class", "VIEW", "TABLE"},
+	model.ObjectKindMaterializedView: {"pg_class", "MATERIALIZED VIEW", "TABLE"},
+	model.ObjectKindForeignTable:     {"pg_class", "FOREIGN TABLE", "TABLE"},
+	model.ObjectKindSequence:         {"pg_class", "SEQUENCE", "SEQUENCE"},
+	model.ObjectKindFunction:         {"pg_proc", "FUNCTION", "FUNCTION"},
+	model.ObjectKindProcedure:        {"pg_proc", "PROCEDURE", "PROCEDURE"},
+	model.ObjectKindEnum:             {"pg_type", "TYPE", "TYPE"},
+	model.ObjectKindDomain:           {"pg_type", "DOMAIN", "DOMAIN"},
+	model.ObjectKindTrigger:          {"pg_trigger", "TRIGGER", ""},
+	model.ObjectKindExtension:        {"pg_extension", "EXTENSION", ""},
+}
+
+// objectDDL renders the definition, comment, owner and grants of an object other than a table
+func objectDDL(ctx context.Context, q querier, kind string, oid uint32) (string, error) {
+	ddl, ownership, err := objectDDLParts(ctx, q, kind, oid)
+	if err != nil {
+		return "", err
+	}
+	return ddl + ownership, nil
+}
+
+// objectDDLParts renders the definition and comment of an object other than a table apart from
+// its owner and grants
+func objectDDLParts(ctx context.Context, q querier, kind string, oid uint32) (ddl string, ownership string, err error) {
+	info, ok := objectKindDDL[kind]
+	if !ok {
+		return "", "", fmt.Errorf("invalid object kind %s", kind)
+	}
+
+	definition, err := objectDefinition(ctx, q, kind, oid)
+	if err != nil {
+		return "", "", err
+	}
+
+	// pg_get_functiondef doesn't end the statement
+	definition = strings.TrimRight(definition, " \n")
+	if !strings.HasSuffix(definition, ";") {
+		definition += ";"
+	}
+
+	var b strings.Builder
+	b.WriteString(definition + "\n")
+
+	// Identity is the schema qualified name, with the argument types of functions and the table of triggers
+	var identity, comment string
+	query := `SELECT (pg_identify_object($2::text::regclass, $1, 0)).identity, COALESCE(obj_description($1, $2::text::name), '')`
+	err = q.QueryRow(ctx, query, oid, info.catalog).Scan(&identity, &comment)
+	if err != nil {
+		return "", "", err
+	}
+	if kind == model.ObjectKindTrigger {
+		// "name on schema.table"
+		if i := strings.LastIndex(identity, " on "); i != -1 {
+			identity = identity[:i] + " ON " + identity[i+len(" on "):]
+		}
+	}
+
+	b.WriteString(commentSQL(info.keyword, identity, comment))
+
+	if info.grantOn != "" {
+		owner, grants, err := loadObjectGrants(ctx, q, info.catalog, oid)
+		if err != nil {
+			return "", "", err
+		}
+		ownership = ownerSQL(info.keyword, identity, owner) + grantsSQL(info.grantOn, identity, grants)
+	}
+
+	return b.String(), ownership, nil
+}
+
+// Render the OWNED BY of a sequence owned by a column, empty for other sequences
+func sequenceOwnedBySQL(ctx context.Context, q querier, oid uint32) (string, error) {
+	query := `
+		SELECT format('ALTER SEQUENCE %I.%I OWNED BY %I.%I.%I;', sn.nspname, s.relname, tn.nspname, t.relname, a.attname) || E'\n'
+		FROM pg_depend d
+		JOIN pg_class s      ON s.oid = d.objid
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t      ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a  ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass
+		  AND d.refclassid = 'pg_class'::regclass
+		  AND d.objid = $1
+		  AND d.deptype = 'a';
+	`
+	var ownedBy string
+	err := q.QueryRow(ctx, query, oid).Scan(&ownedBy)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	return ownedBy, nil
+}
+
+// GenerateTableDDL returns the CREATE TABLE statement of a table with its indexes, comments, owner and grants
+func (c *Connections) GenerateTableDDL(activePoolID uuid.UUID, schema, tableName string) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	def, err := loadTableDef(context.TODO(), pool, schema, tableName)
+	if err != nil {
+		return "", err
+	}
+
+	return createTableSQL(def, true) + tableExtrasSQL(def), nil
+}
+
+// GenerateObjectDDL returns the DDL of an object listed by GetDatabaseObjects, or of a table by its oid
+func (c *Connections) GenerateObjectDDL(activePoolID uuid.UUID, kind string, oid uint32) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	ctx := context.TODO()
+
+	if kind == model.ObjectKindTable {
+		def, err := loadTableDefByOID(ctx, pool, oid)
+		if err != nil {
+			return "", err
+		}
+		return createTableSQL(def, true) + tableExtrasSQL(def), nil
+	}
+
+	ddl, err := objectDDL(ctx, pool, kind, oid)
+	if err != nil {
+		return "", err
+	}
+
+	if kind == model.ObjectKindSequence {
+		ownedBy, err := sequenceOwnedBySQL(ctx, pool, oid)
+		if err != nil {
+			return "", err
+		}
+		ddl += ownedBy
+	}
+
+	return ddl, nil
+}
+
+// CREATE FUNCTION checks the body of SQL functions against the catalog. Scripts turn the check off
+// while they create functions, a body can use objects which are created after it.
+const (
+	functionBodyChecksOff   = "SET check_function_bodies = off;"
+	functionBodyChecksReset = "RESET check_function_bodies;"
+)
+
+// GenerateSchemaDDL returns a script which creates all objects of a schema. Objects are ordered so
+// that the script runs top to bottom: types, sequences and functions first, foreign keys once all tables
+// exist and views after the relations they select from.
+func (c *Connections) GenerateSchemaDDL(activePoolID uuid.UUID, schema string) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	ctx := context.TODO()
+	schema = schemaOrDefault(schema)
+
+	var schemaOID uint32
+	var schemaComment string
+	err := pool.QueryRow(ctx, "SELECT oid, COALESCE(obj_description(oid, 'pg_namespace'), '') FROM pg_namespace WHERE nspname = $1", schema).Scan(&schemaOID, &schemaComment)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("schema %s does not exist", schema)
+		}
+		return "", err
+	}
+
+	var b strings.Builder
+	section := func(title string) {
+		b.WriteString("\n-- " + title + "\n\n")
+	}
+
+	// Schema
+	quotedSchema := quoteIdent(schema)
+	b.WriteString("-- Schema " + schema + "\n\n")
+	b.WriteString("CREATE SCHEMA IF NOT EXISTS " + quotedSchema + ";\n")
+	owner, grants, err := loadObjectGrants(ctx, pool, "pg_namespace", schemaOID)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(ownerSQL("SCHEMA", quotedSchema, owner))
+	b.WriteString(commentSQL("SCHEMA", quotedSchema, schemaComment))
+	b.WriteString(grantsSQL("SCHEMA", quotedSchema, grants))
+
+	objects, err := listDatabaseObjects(ctx, pool, schema)
+	if err != nil {
+		return "", err
+	}
+	objectsOfKind := func(kinds ...string) []model.DatabaseObject {
+		var matched []model.DatabaseObject
+		for _, object := range objects {
+			if containsString(kinds, object.Kind) {
+				matched = append(matched, object)
+			}
+		}
+		return matched
+	}
+	writeObjects := func(title string, objects []model.DatabaseObject) error {
+		if len(objects) == 0 {
+			return nil
+		}
+		section(title)
+		for _, object := range objects {
+			ddl, err := objectDDL(ctx, pool, object.Kind, object.OID)
+			if err != nil {
+				return err
+			}
+			b.WriteString(ddl + "\n")
+		}
+		return nil
+	}
+
+	if err := writeObjects("Extensions", objectsOfKind(model.ObjectKindExtension)); err != nil {
+		return "", err
+	}
+	// Enums before domains, a domain can be based on an enum
+	if err := writeObjects("Types", append(objectsOfKind(model.ObjectKindEnum), objectsOfKind(model.ObjectKindDomain)...)); err != nil {
+		return "", err
+	}
+	sequences := objectsOfKind(model.ObjectKindSequence)
+	if err := writeObjects("Sequences", sequences); err != nil {
+		return "", err
+	}
+
+	// Functions and tables, ordered by their dependencies: defaults and checks call functions,
+	// functions take rows of tables and SQL standard bodies use them. Parents come before their
+	// partitions and children.
+	functions := objectsOfKind(model.ObjectKindFunction, model.ObjectKindProcedure)
+	tables, err := loadSchemaTableDefs(ctx, pool, schema)
+	if err != nil {
+		return "", err
+	}
+	if len(functions)+len(tables) > 0 {
+		ids := make([]catalogObject, 0, len(functions)+len(tables))
+		ddls := make(map[catalogObject]string, len(functions)+len(tables))
+		for _, function := range functions {
+			ddl, err := objectDDL(ctx, pool, function.Kind, function.OID)
+			if err != nil {
+				return "", err
+			}
+			id := catalogObject{objectKindDDL[function.Kind].catalog, function.OID}
+			ids = append(ids, id)
+			ddls[id] = ddl
+		}
+		for _, def := range tables {
+			id := catalogObject{"pg_class", def.OID}
+			ids = append(ids, id)
+			ddls[id] = createTableSQL(def, false) + tableExtrasSQL(def)
+		}
+		dependencies, err := loadObjectDependencies(ctx, pool, ids)
+		if err != nil {
+			return "", err
+		}
+
+		section("Functions and tables")
+		if len(functions) > 0 {
+			b.WriteString(functionBodyChecksOff + "\n\n")
+		}
+		for _, id := range orderByDependencies(ids, dependencies) {
+			b.WriteString(ddls[id] + "\n")
+		}
+		if len(functions) > 0 {
+			b.WriteString(functionBodyChecksReset + "\n")
+		}
+	}
+	if err := writeObjects("Foreign tables", objectsOfKind(model.ObjectKindForeignTable)); err != nil {
+		return "", err
+	}
+
+	views, err := orderViewsByDependencies(ctx, pool, objectsOfKind(model.ObjectKindView, model.ObjectKindMaterializedView))
+	if err != nil {
+		return "", err
+	}
+	if err := writeObjects("Views", views); err != nil {
+		return "", err
+	}
+
+	var foreignKeys strings.Builder
+	for _, def := range tables {
+		foreignKeys.WriteString(foreignKeysSQL(def))
+	}
+	if foreignKeys.Len() > 0 {
+		section("Foreign keys")
+		b.WriteString(foreignKeys.String())
+	}
+
+	var ownedBy strings.Builder
+	for _, sequence := range sequences {
+		sql, err := sequenceOwnedBySQL(ctx, pool, sequence.OID)
+		if err != nil {
+			return "", err
+		}
+		ownedBy.WriteString(sql)
+	}
+	if ownedBy.Len() > 0 {
+		section("Sequence ownership")
+		b.WriteString(ownedBy.String())
+	}
+
+	if err := writeObjects("Triggers", objectsOfKind(model.ObjectKindTrigger)); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Load the definitions of all tables of a schema, parents before their partitions and children
+func loadSchemaTableDefs(ctx context.Context, q querier, schema string) ([]*model.TableDef, error) {
+	query := `
+		SELECT c.oid, COALESCE(array_agg(i.inhparent) FILTER (WHERE i.inhparent IS NOT NULL), '{}')
+		FROM pg_class c
+		JOIN pg_namespace n     ON n.oid = c.relnamespace
+		LEFT JOIN pg_inherits i ON i.inhrelid = c.oid
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p')
+		GROUP BY c.oid, c.relname
+		ORDER BY c.relname;
+	`
+	rows, err := q.Query(ctx, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var oids []uint32
+	parents := make(map[uint32][]uint32)
+	for rows.Next() {
+		var oid uint32
+		var tableParents []uint32
+		if err := rows.Scan(&oid, &tableParents); err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+		parents[oid] = tableParents
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var defs []*model.TableDef
+	for _, oid := range orderByDependencies(oids, parents) {
+		def, err := loadTableDefByOID(ctx, q, oid)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+
+	return defs, nil
+}
+
+// Order views so that every view comes after the views it selects from
+func orderViewsByDependencies(ctx context.Context, q querier, views []model.DatabaseObject) ([]model.DatabaseObject, error) {
+	if len(views) < 2 {
+		return views, nil
+	}
+
+	oids := make([]uint32, len(views))
+	byOID := make(map[uint32]model.DatabaseObject, len(views))
+	for i, view := range views {
+		oids[i] = view.OID
+		byOID[view.OID] = view
+	}
+
+	query := `
+		SELECT DISTINCT r.ev_class, d.refobjid
+		FROM pg_rewrite r
+		JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid AND d.refclassid = 'pg_class'::regclass
+		WHERE r.ev_class = ANY($1) AND d.refobjid = ANY($1) AND d.refobjid <> r.ev_class;
+	`
+	rows, err := q.Query(ctx, query, oids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependencies := make(map[uint32][]uint32)
+	for rows.Next() {
+		var view, dependency uint32
+		if err := rows.Scan(&view, &dependency); err != nil {
+			return nil, err
+		}
+		dependencies[view] = append(dependencies[view], dependency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ordered := make([]model.DatabaseObject, 0, len(views))
+	for _, oid := range orderByDependencies(oids, dependencies) {
+		ordered = append(ordered, byOID[oid])
+	}
+
+	return ordered, nil
+}
+
+// loadObjectDependencies returns the objects each of the given objects depends on according to
+// pg_depend, among the given objects. Column defaults, checks and view rules count as
+// dependencies of their relation and array and row types as dependencies on their element type
+// and relation.
+func loadObjectDependencies(ctx context.Context, q querier, objects []catalogObject) (map[catalogObject][]catalogObject, error) {
+	catalogs := make([]string, len(objects))
+	oids := make([]uint32, len(objects))
+	for i, object := range objects {
+		catalogs[i] = object.catalog
+		oids[i] = object.oid
+	}
+
+	query := `
+		WITH objects AS (
+			SELECT catalog::regclass AS classid, objid
+			FROM unnest($1::text[], $2::oid[]) AS o(catalog, objid)
+		),
+		dependencies AS (
+			SELECT
+				CASE WHEN d.classid IN ('pg_rewrite'::regclass, 'pg_attrdef'::regclass, 'pg_constraint'::regclass) THEN 'pg_class'::regclass ELSE d.classid END AS classid,
+				CASE d.classid
+					WHEN 'pg_rewrite'::regclass THEN (SELECT r.ev_class FROM pg_rewrite r WHERE r.oid = d.objid)
+					WHEN 'pg_attrdef'::regclass THEN (SELECT ad.adrelid FROM pg_attrdef ad WHERE ad.oid = d.objid)
+					WHEN 'pg_constraint'::regclass THEN (SELECT con.conrelid FROM pg_constraint con WHERE con.oid = d.objid AND con.contype = 'c')
+					ELSE d.objid
+				END AS objid,
+				CASE WHEN t.typrelid <> 0 THEN 'pg_class'::regclass ELSE d.refclassid END AS refclassid,
+				CASE
+					WHEN t.typrelid <> 0 THEN t.typrelid
+					WHEN t.typcategory = 'A' THEN t.typelem
+					ELSE d.refobjid
+				END AS refobjid
+			FROM pg_depend d
+			LEFT JOIN pg_type t ON d.refclassid = 'pg_type'::regclass AND t.oid = d.refobjid
+			WHERE d.deptype = 'n'
+			   -- partitions depend on their parent, sequences owned by a column don't
+			   OR (d.deptype = 'a' AND d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass
+			       AND EXISTS (SELECT 1 FROM pg_class c WHERE c.oid = d.objid AND c.relkind IN ('r', 'p')))
+		)
+		SELECT DISTINCT dep.classid::text, dep.objid, dep.refclassid::text, dep.refobjid
+		FROM dependencies dep
+		JOIN objects o ON o.classid = dep.classid AND o.objid = dep.objid
+		JOIN objects r ON r.classid = dep.refclassid AND r.objid = dep.refobjid;
+	`
+	rows, err := q.Query(ctx, query, catalogs, oids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependencies := make(map[catalogObject][]catalogObject)
+	for rows.Next() {
+		var object, dependency catalogObject
+		if err := rows.Scan(&object.catalog, &object.oid, &dependency.catalog, &dependency.oid); err != nil {
+			return nil, err
+		}
+		if object != dependency {
+			dependencies[object] = append(dependencies[object], dependency)
+		}
+	}
+
+	return dependencies, rows.Err()
+}
+
+// orderByDependencies orders ids so that every id comes after the ids it depends on, keeping the
+// input order otherwise. Dependencies outside of ids are ignored and cycles are broken arbitrarily.
+func orderByDependencies[K comparable](ids []K, dependencies map[K][]K) []K {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	known := make(map[K]struct{}, len(ids))
+	for _, id := range ids {
+		known[id] = struct{}{}
+	}
+
+	state := make(map[K]int, len(ids))
+	ordered := make([]K, 0, len(ids))
+
+	var visit func(id K)
+	visit = func(id K) {
+		if state[id] != 0 {
+			return
+		}
+		state[id] = visiting
+		for _, dependency := range dependencies[id] {
+			if _, ok := known[dependency]; ok {
+				visit(dependency)
+			}
+		}
+		state[id] = visited
+		ordered = append(ordered, id)
+	}
+
+	for _, id := range ids {
+		visit(id)
+	}
+
+	return ordered
+}
@@ -0,0 +1,273 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"dbmx/model"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Record a committed batch of row edits in the edit journal
+func (c *Connections) journalEditBatch(info PoolInfo, entries []model.EditJournalEntry) (int64, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var batchID int64
+	err = tx.QueryRow(`INSERT INTO edit_batches (connection_id, db_name) VALUES (?, ?) RETURNING id`, info.ConnectionID, info.DBName).Scan(&batchID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO edit_journal (batch_id, position, kind, schema_name, table_name, row_key, new_row_key, before, after) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for i, entry := range entries {
+		values := []any{entry.Key, entry.NewKey, entry.Before, entry.After}
+		for j, value := range values {
+			// Maps are marshalled with sorted keys, so equal keys have equal JSON
+			valueJSON, err := json.Marshal(value)
+			if err != nil {
+				return 0, err
+			}
+			values[j] = string(valueJSON)
+		}
+		_, err := tx.Exec(query, append([]any{batchID, i, entry.Kind, entry.Schema, entry.Table}, values...)...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return batchID, nil
+}
+
+func scanEditJournalEntry(rows *sql.Rows, batchID *int64) (model.EditJournalEntry, error) {
+	var entry model.EditJournalEntry
+	var key, newKey, before, after string
+	if err := rows.Scan(batchID, &entry.Kind, &entry.Schema, &entry.Table, &key, &newKey, &before, &after); err != nil {
+		return entry, err
+	}
+	for _, value := range []struct {
+		json   string
+		target any
+	}{{key, &entry.Key}, {newKey, &entry.NewKey}, {before, &entry.Before}, {after, &entry.After}} {
+		if err := json.Unmarshal([]byte(value.json), value.target); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// Load the entries of batches, in the order they were applied
+func (c *Connections) loadEditJournal(batches []model.EditBatch) error {
+	if len(batches) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(batches))
+	args := make([]any, len(batches))
+	for i, batch := range batches {
+		index[batch.ID] = i
+		args[i] = batch.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batches)), ", ")
+
+	query := fmt.Sprintf(`SELECT batch_id, kind, schema_name, table_name, row_key, new_row_key, before, after FROM edit_journal WHERE batch_id IN (%s) ORDER BY batch_id, position`, placeholders)
+	rows, err := c.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var batchID int64
+		entry, err := scanEditJournalEntry(rows, &batchID)
+		if err != nil {
+			return err
+		}
+		batch := &batches[index[batchID]]
+		batch.Entries = append(batch.Entries, entry)
+	}
+
+	return rows.Err()
+}
+
+func (c *Connections) queryEditBatches(query string, args ...any) ([]model.EditBatch, error) {
+	rows, err := c.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []model.EditBatch
+	for rows.Next() {
+		var b model.EditBatch
+		if err := rows.Scan(&b.ID, &b.ConnectionID, &b.DBName, &b.Undone, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := c.loadEditJournal(batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// GetEditHistory lists the journaled edit batches of a database with their rows, newest first.
+// A limit of 0 lists every batch.
+func (c *Connections) GetEditHistory(connectionID int64, dbName string, limit int) ([]model.EditBatch, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	query := `SELECT id, connection_id, db_name, undone, created_at, updated_at FROM edit_batches WHERE connection_id = ? AND db_name = ? ORDER BY id DESC LIMIT ?`
+	return c.queryEditBatches(query, connectionID, dbName, limit)
+}
+
+// GetRowEditHistory lists the journaled edit batches which touched a row, newest first
+func (c *Connections) GetRowEditHistory(connectionID int64, dbName, schema, tableName string, key model.RowKey) ([]model.EditBatch, error) {
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT id, connection_id, db_name, undone, created_at, updated_at
+		FROM edit_batches
+		WHERE connection_id = ? AND db_name = ?
+		  AND id IN (
+			SELECT batch_id FROM edit_journal
+			WHERE schema_name = ? AND table_name = ? AND (row_key = ? OR new_row_key = ?)
+		  )
+		ORDER BY id DESC
+	`
+	return c.queryEditBatches(query, connectionID, dbName, schemaOrDefault(schema), tableName, string(keyJSON), string(keyJSON))
+}
+
+// ClearEditHistory forgets the journaled edit batches of a database, they can't be undone afterwards
+func (c *Connections) ClearEditHistory(connectionID int64, dbName string) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM edit_journal WHERE batch_id IN (SELECT id FROM edit_batches WHERE connection_id = ? AND db_name = ?)`, connectionID, dbName)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM edit_batches WHERE connection_id = ? AND db_name = ?`, connectionID, dbName)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UndoEditBatch reverts a journaled batch of row edits in one transaction. Rows which changed
+// since the batch was applied are reported as conflicts and nothing is reverted, unless force is
+// set.
+func (c *Connections) UndoEditBatch(activePoolID uuid.UUID, batchID int64, force bool) (*model.RowEditResult, error) {
+	return c.replayEditBatch(activePoolID, batchID, true, force)
+}
+
+// RedoEditBatch applies an undone batch of row edits again. Rows which changed since the batch
+// was undone are reported as conflicts and nothing is applied, unless force is set.
+func (c *Connections) RedoEditBatch(activePoolID uuid.UUID, batchID int64, force bool) (*model.RowEditResult, error) {
+	return c.replayEditBatch(activePoolID, batchID, false, force)
+}
+
+func (c *Connections) replayEditBatch(activePoolID uuid.UUID, batchID int64, undo, force bool) (*model.RowEditResult, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+	info, exists := c.PM.GetPoolInfo(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	batches, err := c.queryEditBatches(`SELECT id, connection_id, db_name, undone, created_at, updated_at FROM edit_batches WHERE id = ?`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("edit batch %d doesn't exist", batchID)
+	}
+	batch := batches[0]
+	if batch.ConnectionID != info.ConnectionID || batch.DBName != info.DBName {
+		return nil, fmt.Errorf("edit batch %d was applied to another database", batchID)
+	}
+	if undo && batch.Undone {
+		return nil, fmt.Errorf("edit batch %d is undone already", batchID)
+	}
+	if !undo && !batch.Undone {
+		return nil, fmt.Errorf("edit batch %d isn't undone", batchID)
+	}
+
+	edits := replayEdits(batch.Entries, undo, force)
+	result, _, err := applyRowEdits(context.Background(), pool, edits, false)
+	if err != nil || !result.Applied {
+		return result, err
+	}
+
+	_, err = c.DB.Exec(`UPDATE edit_batches SET undone = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, undo, batchID)
+	if err != nil {
+		return nil, errors.Wrap(err, "the edits were replayed but the journal couldn't be updated")
+	}
+	result.BatchID = batchID
+
+	return result, nil
+}
+
+// Row edits which undo or redo journal entries. The rows are expected to be as the batch left
+// them, or as the undo left them for a redo, anything else is a conflict unless forced.
+func replayEdits(entries []model.EditJournalEntry, undo, force bool) []model.RowEdit {
+	var edits []model.RowEdit
+	for _, entry := range entries {
+		edit := model.RowEdit{Schema: entry.Schema, Table: entry.Table}
+		switch {
+		case entry.Kind == model.RowEditInsert && undo:
+			edit.Kind, edit.Key, edit.Original = model.RowEditDelete, entry.NewKey, entry.After
+		// Rows are inserted again with the values they had, identity columns included
+		case entry.Kind == model.RowEditInsert:
+			edit.Kind, edit.Values, edit.OverridingSystemValue = model.RowEditInsert, entry.After, true
+		case entry.Kind == model.RowEditUpdate && undo:
+			edit.Kind, edit.Key, edit.Values, edit.Original = model.RowEditUpdate, entry.NewKey, entry.Before, entry.After
+		case entry.Kind == model.RowEditUpdate:
+			edit.Kind, edit.Key, edit.Values, edit.Original = model.RowEditUpdate, entry.Key, entry.After, entry.Before
+		case entry.Kind == model.RowEditDelete && undo:
+			edit.Kind, edit.Values, edit.OverridingSystemValue = model.RowEditInsert, entry.Before, true
+		case entry.Kind == model.RowEditDelete:
+			edit.Kind, edit.Key, edit.Original = model.RowEditDelete, entry.Key, entry.Before
+		}
+		if force {
+			edit.Original = nil
+		}
+		edits = append(edits, edit)
+	}
+
+	// Undo reverts the last edit first
+	if undo {
+		slices.Reverse(edits)
+	}
+	return edits
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Environments whose destructive actions have to be confirmed explicitly
+var confirmedEnvs = map[string]struct{}{
+	"production": {},
+	"prod":       {},
+}
+
+// Environment of the saved connection a pool belongs to, empty when it isn't set
+func (c *Connections) poolEnv(activePoolID uuid.UUID) (string, error) {
+	info, exists := c.PM.GetPoolInfo(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	var env sql.NullString
+	err := c.DB.QueryRow(`SELECT env FROM connections WHERE id = ?`, info.ConnectionID).Scan(&env)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(env.String)), nil
+}
+
+// checkEnvSafety allows a destructive action on the database of a pool. On production the action
+// has to be confirmed by passing the expected confirmation, e.g. the id of the affected object.
+func (c *Connections) checkEnvSafety(activePoolID uuid.UUID, action, expected, confirmation string) error {
+	env, err := c.poolEnv(activePoolID)
+	if err != nil {
+		return err
+	}
+	if _, ok := confirmedEnvs[env]; !ok {
+		return nil
+	}
+	if strings.TrimSpace(confirmation) != expected {
+		return fmt.Errorf("%s runs on a %s connection, confirm it by typing %s", action, env, expected)
+	}
+	return nil
+}
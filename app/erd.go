@@ -0,0 +1,299 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"dbmx/model"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// GetERDGraph returns the tables of a database as nodes and their foreign keys as edges, with the
+// saved layout of the database
+func (c *Connections) GetERDGraph(activePoolID uuid.UUID, connectionID int64, dbName string, opts model.ERDOptions) (*model.ERDGraph, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+
+	schemas := opts.Schemas
+	if len(schemas) == 0 || opts.FocusTable != "" {
+		// Hops can cross schemas
+		var err error
+		schemas, err = listUserSchemas(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	graph, err := loadERDGraph(ctx, pool, schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.FocusTable != "" {
+		focus := quoteQualified(schemaOrDefault(opts.FocusSchema), opts.FocusTable)
+		graph = filterERDHops(graph, focus, opts.Hops)
+		if len(graph.Nodes) == 0 {
+			return nil, errors.Errorf("table %s does not exist", focus)
+		}
+		if len(opts.Schemas) > 0 {
+			graph = filterERDSchemas(graph, opts.Schemas)
+		}
+	}
+
+	positions, err := c.getERDLayout(connectionID, dbName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range graph.Nodes {
+		if position, ok := positions[graph.Nodes[i].ID]; ok {
+			graph.Nodes[i].Position = &position
+		}
+	}
+
+	return graph, nil
+}
+
+func loadERDGraph(ctx context.Context, q querier, schemas []string) (*model.ERDGraph, error) {
+	graph := &model.ERDGraph{}
+
+	// Partitions are left out, their parent represents them
+	query := `
+		SELECT
+			n.nspname::text,
+			c.relname::text,
+			a.attname::text,
+			format_type(a.atttypid, a.atttypmod),
+			a.attnotnull,
+			EXISTS (
+				SELECT 1 FROM pg_constraint con
+				WHERE con.conrelid = c.oid AND con.contype = 'p' AND a.attnum = ANY(con.conkey)
+			),
+			EXISTS (
+				SELECT 1 FROM pg_constraint con
+				WHERE con.conrelid = c.oid AND con.contype = 'f' AND a.attnum = ANY(con.conkey)
+			),
+			EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indrelid = c.oid AND i.indisunique AND i.indpred IS NULL
+				  AND i.indnatts = 1 AND i.indkey[0] = a.attnum
+			)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		WHERE c.relkind IN ('r', 'p')
+		  AND NOT c.relispartition
+		  AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname, a.attnum;
+	`
+	rows, err := q.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, table string
+		var column model.ERDColumn
+		err := rows.Scan(&schema, &table, &column.Name, &column.Type, &column.NotNull, &column.IsPrimaryKey, &column.IsForeignKey, &column.IsUnique)
+		if err != nil {
+			return nil, err
+		}
+
+		id := quoteQualified(schema, table)
+		if len(graph.Nodes) == 0 || graph.Nodes[len(graph.Nodes)-1].ID != id {
+			graph.Nodes = append(graph.Nodes, model.ERDNode{ID: id, Schema: schema, Name: table})
+		}
+		node := &graph.Nodes[len(graph.Nodes)-1]
+		node.Columns = append(node.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Foreign keys between the tables, the ones a partition inherits are left out. A foreign key
+	// is one-to-one when its columns are unique.
+	query = `
+		SELECT
+			con.conname::text,
+			sn.nspname::text,
+			s.relname::text,
+			tn.nspname::text,
+			t.relname::text,
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indrelid = con.conrelid AND i.indisunique AND i.indpred IS NULL
+				  AND i.indnatts = cardinality(con.conkey) AND i.indkey::int2[] @> con.conkey
+			),
+			EXISTS (
+				SELECT 1 FROM pg_attribute a
+				WHERE a.attrelid = con.conrelid AND a.attnum = ANY(con.conkey) AND NOT a.attnotnull
+			)
+		FROM pg_constraint con
+		JOIN pg_class s      ON s.oid = con.conrelid
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t      ON t.oid = con.confrelid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		WHERE con.contype = 'f'
+		  AND con.conparentid = 0
+		  AND NOT s.relispartition
+		  AND sn.nspname = ANY($1)
+		  AND tn.nspname = ANY($1)
+		ORDER BY sn.nspname, s.relname, con.conname;
+	`
+	rows, err = q.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var edge model.ERDEdge
+		var sourceSchema, sourceTable, targetSchema, targetTable string
+		var unique bool
+		err := rows.Scan(&edge.Name, &sourceSchema, &sourceTable, &targetSchema, &targetTable, &edge.SourceColumns, &edge.TargetColumns, &unique, &edge.Optional)
+		if err != nil {
+			return nil, err
+		}
+		// Same ids as the nodes
+		edge.Source = quoteQualified(sourceSchema, sourceTable)
+		edge.Target = quoteQualified(targetSchema, targetTable)
+		edge.Cardinality = model.CardinalityManyToOne
+		if unique {
+			edge.Cardinality = model.CardinalityOneToOne
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// Keep the tables within hops foreign keys of the focus table, following edges in both directions
+func filterERDHops(graph *model.ERDGraph, focus string, hops int) *model.ERDGraph {
+	neighbours := make(map[string][]string)
+	for _, edge := range graph.Edges {
+		neighbours[edge.Source] = append(neighbours[edge.Source], edge.Target)
+		neighbours[edge.Target] = append(neighbours[edge.Target], edge.Source)
+	}
+
+	distance := map[string]int{focus: 0}
+	queue := []string{focus}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if distance[id] >= hops {
+			continue
+		}
+		for _, neighbour := range neighbours[id] {
+			if _, seen := distance[neighbour]; !seen {
+				distance[neighbour] = distance[id] + 1
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+
+	filtered := &model.ERDGraph{}
+	for _, node := range graph.Nodes {
+		if _, ok := distance[node.ID]; ok {
+			filtered.Nodes = append(filtered.Nodes, node)
+		}
+	}
+	for _, edge := range graph.Edges {
+		_, sourceOK := distance[edge.Source]
+		_, targetOK := distance[edge.Target]
+		if sourceOK && targetOK {
+			filtered.Edges = append(filtered.Edges, edge)
+		}
+	}
+
+	return filtered
+}
+
+// Keep the tables of the given schemas
+func filterERDSchemas(graph *model.ERDGraph, schemas []string) *model.ERDGraph {
+	filtered := &model.ERDGraph{}
+	kept := make(map[string]struct{})
+	for _, node := range graph.Nodes {
+		if containsString(schemas, node.Schema) {
+			filtered.Nodes = append(filtered.Nodes, node)
+			kept[node.ID] = struct{}{}
+		}
+	}
+	for _, edge := range graph.Edges {
+		_, sourceOK := kept[edge.Source]
+		_, targetOK := kept[edge.Target]
+		if sourceOK && targetOK {
+			filtered.Edges = append(filtered.Edges, edge)
+		}
+	}
+	return filtered
+}
+
+func (c *Connections) getERDLayout(connectionID int64, dbName string) (map[string]model.ERDPosition, error) {
+	positions := make(map[string]model.ERDPosition)
+
+	var layoutJSON string
+	err := c.DB.QueryRow(`SELECT layout FROM erd_layouts WHERE connection_id = ? AND db_name = ?`, connectionID, dbName).Scan(&layoutJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return positions, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(layoutJSON), &positions); err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+// SaveERDLayout saves node positions of the ER diagram of a database. Positions of nodes which
+// aren't passed are kept, so a filtered diagram doesn't reset the others.
+func (c *Connections) SaveERDLayout(connectionID int64, dbName string, positions []model.ERDPosition) error {
+	layout, err := c.getERDLayout(connectionID, dbName)
+	if err != nil {
+		return err
+	}
+	for _, position := range positions {
+		layout[position.ID] = position
+	}
+
+	layoutJSON, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO erd_layouts (connection_id, db_name, layout, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (connection_id, db_name) DO UPDATE SET layout = excluded.layout, updated_at = excluded.updated_at
+	`
+	_, err = c.DB.Exec(query, connectionID, dbName, string(layoutJSON))
+	return err
+}
+
+// ResetERDLayout forgets the saved positions of the ER diagram of a database
+func (c *Connections) ResetERDLayout(connectionID int64, dbName string) error {
+	_, err := c.DB.Exec(`DELETE FROM erd_layouts WHERE connection_id = ? AND db_name = ?`, connectionID, dbName)
+	return err
+}
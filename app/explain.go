@@ -0,0 +1,218 @@
+package app
+
+import (
+	"dbmx/model"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Number of nodes flagged as the worst misestimates of a plan
+	worstMisestimates = 3
+
+	// Estimates off by less than this factor are not flagged
+	minMisestimateFactor = 10
+)
+
+// explainPlan mirrors a plan node of EXPLAIN (FORMAT JSON)
+type explainPlan struct {
+	NodeType            string        `json:"Node Type"`
+	ParentRelationship  string        `json:"Parent Relationship"`
+	SubplanName         string        `json:"Subplan Name"`
+	RelationName        string        `json:"Relation Name"`
+	Schema              string        `json:"Schema"`
+	Alias               string        `json:"Alias"`
+	IndexName           string        `json:"Index Name"`
+	JoinType            string        `json:"Join Type"`
+	Strategy            string        `json:"Strategy"`
+	ParallelAware       bool          `json:"Parallel Aware"`
+	Filter              string        `json:"Filter"`
+	IndexCond           string        `json:"Index Cond"`
+	JoinFilter          string        `json:"Join Filter"`
+	HashCond            string        `json:"Hash Cond"`
+	MergeCond           string        `json:"Merge Cond"`
+	RecheckCond         string        `json:"Recheck Cond"`
+	Output              []string      `json:"Output"`
+	StartupCost         float64       `json:"Startup Cost"`
+	TotalCost           float64       `json:"Total Cost"`
+	PlanRows            float64       `json:"Plan Rows"`
+	PlanWidth           int64         `json:"Plan Width"`
+	ActualStartupTime   float64       `json:"Actual Startup Time"`
+	ActualTotalTime     float64       `json:"Actual Total Time"`
+	ActualRows          float64       `json:"Actual Rows"`
+	ActualLoops         float64       `json:"Actual Loops"`
+	RowsRemovedByFilter float64       `json:"Rows Removed by Filter"`
+	SharedHitBlocks     int64         `json:"Shared Hit Blocks"`
+	SharedReadBlocks    int64         `json:"Shared Read Blocks"`
+	SharedDirtiedBlocks int64         `json:"Shared Dirtied Blocks"`
+	SharedWrittenBlocks int64         `json:"Shared Written Blocks"`
+	TempReadBlocks      int64         `json:"Temp Read Blocks"`
+	TempWrittenBlocks   int64         `json:"Temp Written Blocks"`
+	Plans               []explainPlan `json:"Plans"`
+}
+
+type explainOutput struct {
+	Plan          explainPlan `json:"Plan"`
+	PlanningTime  float64     `json:"Planning Time"`
+	ExecutionTime float64     `json:"Execution Time"`
+}
+
+// Build the EXPLAIN statement for the given options
+func explainStatement(query string, opts model.ExplainOptions) string {
+	options := []string{}
+	if opts.Analyze {
+		options = append(options, "ANALYZE")
+	}
+	if opts.Buffers {
+		options = append(options, "BUFFERS")
+	}
+	if opts.Verbose {
+		options = append(options, "VERBOSE")
+	}
+	options = append(options, "FORMAT JSON")
+
+	return "EXPLAIN (" + strings.Join(options, ", ") + ") " + strings.TrimRight(strings.TrimSpace(query), ";")
+}
+
+// ExplainQuery runs EXPLAIN (FORMAT JSON) with the given options and returns the parsed plan tree
+func (c *Connections) ExplainQuery(activePoolID uuid.UUID, query string, tabID int64, opts model.ExplainOptions) model.ExplainResult {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return model.ExplainResult{OK: false, Message: "pool doesn't exist"}
+	}
+
+	ctx, cancel, err := c.startTabQuery(tabID, 30*time.Second)
+	if err != nil {
+		return model.ExplainResult{OK: false, Message: err.Error()}
+	}
+	defer c.finishTabQuery(tabID, cancel)
+
+	// ANALYZE executes the statement. It always runs in a transaction which is rolled back
+	// so that writes, including data modifying CTEs, don't change any data.
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return model.ExplainResult{OK: false, Message: err.Error()}
+	}
+	defer tx.Rollback(ctx)
+
+	var raw []byte
+	err = tx.QueryRow(ctx, explainStatement(query, opts)).Scan(&raw)
+	if err != nil {
+		res := c.handleQueryError(err)
+		return model.ExplainResult{OK: false, Message: res.Message}
+	}
+
+	result, err := parseExplainJSON(raw)
+	if err != nil {
+		return model.ExplainResult{OK: false, Message: err.Error()}
+	}
+	result.RolledBack = opts.Analyze && isWriteOperation(query)
+
+	return *result
+}
+
+// Parse the output of EXPLAIN (FORMAT JSON) into a plan tree
+func parseExplainJSON(raw []byte) (*model.ExplainResult, error) {
+	var outputs []explainOutput
+	if err := json.Unmarshal(raw, &outputs); err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return nil, errors.New("EXPLAIN returned no plan")
+	}
+
+	output := outputs[0]
+	plan := buildPlanNode(output.Plan)
+	flagWorstMisestimates(&plan)
+
+	return &model.ExplainResult{
+		OK:            true,
+		Plan:          &plan,
+		PlanningTime:  output.PlanningTime,
+		ExecutionTime: output.ExecutionTime,
+		RawJSON:       string(raw),
+	}, nil
+}
+
+func buildPlanNode(p explainPlan) model.PlanNode {
+	node := model.PlanNode{
+		NodeType:            p.NodeType,
+		ParentRelationship:  p.ParentRelationship,
+		SubplanName:         p.SubplanName,
+		RelationName:        p.RelationName,
+		Schema:              p.Schema,
+		Alias:               p.Alias,
+		IndexName:           p.IndexName,
+		JoinType:            p.JoinType,
+		Strategy:            p.Strategy,
+		ParallelAware:       p.ParallelAware,
+		Filter:              p.Filter,
+		IndexCond:           p.IndexCond,
+		JoinFilter:          p.JoinFilter,
+		HashCond:            p.HashCond,
+		MergeCond:           p.MergeCond,
+		RecheckCond:         p.RecheckCond,
+		Output:              p.Output,
+		StartupCost:         p.StartupCost,
+		TotalCost:           p.TotalCost,
+		EstimatedRows:       p.PlanRows,
+		PlanWidth:           p.PlanWidth,
+		ActualRows:          p.ActualRows,
+		ActualLoops:         p.ActualLoops,
+		ActualStartupTime:   p.ActualStartupTime,
+		ActualTotalTime:     p.ActualTotalTime,
+		RowsRemovedByFilter: p.RowsRemovedByFilter,
+		SharedHitBlocks:     p.SharedHitBlocks,
+		SharedReadBlocks:    p.SharedReadBlocks,
+		SharedDirtiedBlocks: p.SharedDirtiedBlocks,
+		SharedWrittenBlocks: p.SharedWrittenBlocks,
+		TempReadBlocks:      p.TempReadBlocks,
+		TempWrittenBlocks:   p.TempWrittenBlocks,
+		IsSeqScan:           p.NodeType == "Seq Scan",
+	}
+
+	// Actual total time is per loop, the time of the children is subtracted to get the exclusive time
+	childrenTime := 0.0
+	for _, child := range p.Plans {
+		childrenTime += child.ActualTotalTime * child.ActualLoops
+		node.Children = append(node.Children, buildPlanNode(child))
+	}
+	node.ExclusiveTime = math.Max(0, p.ActualTotalTime*p.ActualLoops-childrenTime)
+
+	// Misestimates are only known when the node was executed
+	if p.ActualLoops > 0 {
+		estimated := math.Max(p.PlanRows, 1)
+		actual := math.Max(p.ActualRows, 1)
+		node.MisestimateFactor = math.Max(estimated/actual, actual/estimated)
+	}
+
+	return node
+}
+
+// Flag the nodes whose row estimates are off the most
+func flagWorstMisestimates(root *model.PlanNode) {
+	var nodes []*model.PlanNode
+	var walk func(n *model.PlanNode)
+	walk = func(n *model.PlanNode) {
+		if n.MisestimateFactor >= minMisestimateFactor {
+			nodes = append(nodes, n)
+		}
+		for i := range n.Children {
+			walk(&n.Children[i])
+		}
+	}
+	walk(root)
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].MisestimateFactor > nodes[j].MisestimateFactor
+	})
+	for i := 0; i < len(nodes) && i < worstMisestimates; i++ {
+		nodes[i].IsWorstMisestimate = true
+	}
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// A foreign key between two tables with its columns in constraint order
+type foreignKeyRef struct {
+	name              string
+	schema            string
+	table             string
+	columns           []string
+	referencedSchema  string
+	referencedTable   string
+	referencedColumns []string
+}
+
+// loadForeignKeys returns the foreign keys of a table, or the foreign keys of other tables which
+// reference it. Foreign keys a partition inherits from its parent are left out.
+func loadForeignKeys(ctx context.Context, q querier, schema, tableName string, referencing bool) ([]foreignKeyRef, error) {
+	filter := "sn.nspname = $1 AND s.relname = $2"
+	if referencing {
+		filter = "tn.nspname = $1 AND t.relname = $2"
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			con.conname::text,
+			sn.nspname::text,
+			s.relname::text,
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			tn.nspname::text,
+			t.relname::text,
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			)
+		FROM pg_constraint con
+		JOIN pg_class s      ON s.oid = con.conrelid
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t      ON t.oid = con.confrelid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		WHERE con.contype = 'f'
+		  AND con.conparentid = 0
+		  AND %s
+		ORDER BY sn.nspname, s.relname, cardinality(con.conkey), con.conname;
+	`, filter)
+	rows, err := q.Query(ctx, query, schemaOrDefault(schema), tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foreignKeys []foreignKeyRef
+	for rows.Next() {
+		var fk foreignKeyRef
+		err := rows.Scan(&fk.name, &fk.schema, &fk.table, &fk.columns, &fk.referencedSchema, &fk.referencedTable, &fk.referencedColumns)
+		if err != nil {
+			return nil, err
+		}
+		foreignKeys = append(foreignKeys, fk)
+	}
+
+	return foreignKeys, rows.Err()
+}
+
+// Structured filter matching columns to values
+func equalityFilter(columns, values []string) model.TableFilter {
+	filter := model.TableFilter{Mode: model.FilterModeStructured, Where: model.FilterGroup{Op: "AND"}}
+	for i, column := range columns {
+		filter.Where.Conditions = append(filter.Where.Conditions, model.FilterCondition{Column: column, Operator: "=", Value: values[i]})
+	}
+	return filter
+}
+
+// FollowForeignKey finds the row a value of a result row references. When the column belongs to
+// several foreign keys, the first one whose columns all have a value is followed.
+func (c *Connections) FollowForeignKey(activePoolID uuid.UUID, lookup model.ForeignKeyLookup) (*model.ForeignKeyTarget, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	foreignKeys, err := loadForeignKeys(ctx, pool, lookup.Schema, lookup.Table, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var referencedColumn bool
+	for _, fk := range foreignKeys {
+		if !slices.Contains(fk.columns, lookup.Column) {
+			continue
+		}
+		referencedColumn = true
+
+		values := make([]string, len(fk.columns))
+		complete := true
+		for i, column := range fk.columns {
+			value, ok := lookup.Values[column]
+			if column == lookup.Column {
+				value, ok = lookup.Value, true
+			}
+			if !ok {
+				complete = false
+				break
+			}
+			values[i] = value
+		}
+		if !complete {
+			continue
+		}
+
+		target := &model.ForeignKeyTarget{
+			Constraint: fk.name,
+			Schema:     fk.referencedSchema,
+			Table:      fk.referencedTable,
+			Columns:    fk.referencedColumns,
+			Filter:     equalityFilter(fk.referencedColumns, values),
+		}
+		target.Result = c.GetFilteredTableData(activePoolID, 0, fk.referencedSchema, fk.referencedTable, target.Filter, "1", "", true)
+		if !target.Result.OK {
+			return nil, errors.New(target.Result.Message)
+		}
+		return target, nil
+	}
+
+	table := quoteQualified(schemaOrDefault(lookup.Schema), lookup.Table)
+	if referencedColumn {
+		return nil, fmt.Errorf("the values of every column of the foreign key of %s.%s are required", table, lookup.Column)
+	}
+	return nil, fmt.Errorf("column %s of %s doesn't reference another table", lookup.Column, table)
+}
+
+// GetReferencingTables counts the rows of every table which reference a row through a foreign
+// key. Row holds the text values of the row, nil is NULL. A foreign key with a NULL referenced
+// value matches no rows.
+func (c *Connections) GetReferencingTables(activePoolID uuid.UUID, schema, tableName string, row map[string]*string) ([]model.ReferencingTable, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	foreignKeys, err := loadForeignKeys(ctx, pool, schema, tableName, true)
+	if err != nil {
+		return nil, err
+	}
+
+	referencing := []model.ReferencingTable{}
+	for _, fk := range foreignKeys {
+		ref := model.ReferencingTable{
+			Constraint:        fk.name,
+			Schema:            fk.schema,
+			Table:             fk.table,
+			Columns:           fk.columns,
+			ReferencedColumns: fk.referencedColumns,
+		}
+
+		values := make([]string, len(fk.referencedColumns))
+		complete := true
+		for i, column := range fk.referencedColumns {
+			value, ok := row[column]
+			if !ok {
+				return nil, fmt.Errorf("the row lacks column %s referenced by %s", column, fk.name)
+			}
+			if value == nil {
+				complete = false
+				break
+			}
+			values[i] = *value
+		}
+		if !complete {
+			referencing = append(referencing, ref)
+			continue
+		}
+		ref.Filter = equalityFilter(fk.columns, values)
+
+		columns, err := getTableColumns(ctx, pool, fk.schema, fk.table)
+		if err != nil {
+			return nil, err
+		}
+		tableQuery, err := compileTableFilter(fk.schema, fk.table, columns, ref.Filter)
+		if err != nil {
+			return nil, err
+		}
+		// Rows referencing a single row are counted exactly, estimates of filtered counts are too rough
+		err = pool.QueryRow(ctx, tableQuery.countSQL(), tableQuery.args...).Scan(&ref.Count)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to count rows of %s", quoteQualified(fk.schema, fk.table))
+		}
+
+		referencing = append(referencing, ref)
+	}
+
+	return referencing, nil
+}
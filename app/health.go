@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Transaction IDs available before wraparound
+const wraparoundLimit = 1 << 31
+
+// Read the database wide counters, sizes and transaction ID age
+func loadDatabaseHealth(ctx context.Context, q querier) (*model.DatabaseHealth, error) {
+	query := `
+		SELECT
+			d.datname::text,
+			pg_database_size(d.oid),
+			s.blks_hit::float8 / NULLIF(s.blks_hit + s.blks_read, 0),
+			s.xact_commit,
+			s.xact_rollback,
+			s.deadlocks,
+			s.temp_bytes,
+			age(d.datfrozenxid)::bigint,
+			current_setting('autovacuum_freeze_max_age')::bigint,
+			s.stats_reset
+		FROM pg_database d
+		JOIN pg_stat_database s ON s.datid = d.oid
+		WHERE d.datname = current_database();
+	`
+	health := &model.DatabaseHealth{Tables: []model.TableHealth{}, Indexes: []model.IndexHealth{}}
+	err := q.QueryRow(ctx, query).Scan(
+		&health.Database, &health.Size, &health.CacheHitRatio, &health.XactCommit, &health.XactRollback,
+		&health.Deadlocks, &health.TempBytes, &health.WraparoundAge, &health.FreezeMaxAge, &health.StatsResetAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	health.WraparoundPercent = float64(health.WraparoundAge) / wraparoundLimit * 100
+
+	return health, nil
+}
+
+// Read the sizes, scans and vacuum status of the user tables. The bloat estimate compares the
+// size of a table with the pages its rows need given their average width from pg_stats, the
+// tuple header and line pointer, and the fillfactor. Null values take no space in a row.
+func loadTableHealth(ctx context.Context, q querier, schema string) ([]model.TableHealth, error) {
+	query := `
+		WITH widths AS (
+			SELECT s.schemaname, s.tablename, SUM(s.avg_width * (1 - s.null_frac)) AS width
+			FROM pg_stats s
+			WHERE ($1 = '' OR s.schemaname = $1) AND NOT s.inherited
+			GROUP BY s.schemaname, s.tablename
+		),
+		sizes AS (
+			SELECT
+				t.*,
+				c.reltuples,
+				c.relkind,
+				c.relfrozenxid,
+				pg_total_relation_size(c.oid) AS total_size,
+				pg_relation_size(c.oid) AS table_size,
+				pg_indexes_size(c.oid) AS indexes_size,
+				COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0) AS toast_size,
+				CASE WHEN w.width IS NOT NULL AND c.reltuples > 0 THEN
+					CEIL(c.reltuples / GREATEST(FLOOR(
+						(current_setting('block_size')::int - 24)
+						* COALESCE((SELECT option_value::int FROM pg_options_to_table(c.reloptions) WHERE option_name = 'fillfactor'), 100) / 100.0
+						/ (w.width + 28)
+					), 1)) * current_setting('block_size')::int
+				END AS expected_size,
+				io.heap_blks_hit::float8 / NULLIF(io.heap_blks_hit + io.heap_blks_read, 0) AS cache_hit_ratio
+			FROM pg_stat_user_tables t
+			JOIN pg_class c ON c.oid = t.relid
+			LEFT JOIN pg_statio_user_tables io ON io.relid = t.relid
+			LEFT JOIN widths w ON w.schemaname = t.schemaname AND w.tablename = t.relname
+			WHERE ($1 = '' OR t.schemaname = $1)
+		)
+		SELECT
+			schemaname::text,
+			relname::text,
+			total_size,
+			table_size,
+			indexes_size,
+			toast_size,
+			-- GREATEST ignores NULL, tables without statistics have no estimate
+			CASE WHEN expected_size IS NOT NULL THEN GREATEST(table_size - expected_size, 0)::bigint END,
+			CASE WHEN expected_size IS NOT NULL THEN GREATEST(table_size - expected_size, 0)::float8 / NULLIF(table_size, 0) END,
+			n_live_tup,
+			n_dead_tup,
+			n_dead_tup::float8 / NULLIF(n_live_tup + n_dead_tup, 0),
+			n_mod_since_analyze,
+			COALESCE(seq_scan, 0),
+			COALESCE(seq_tup_read, 0),
+			COALESCE(idx_scan, 0),
+			COALESCE(idx_scan, 0)::float8 / NULLIF(COALESCE(seq_scan, 0) + COALESCE(idx_scan, 0), 0),
+			cache_hit_ratio,
+			last_vacuum,
+			last_autovacuum,
+			last_analyze,
+			last_autoanalyze,
+			vacuum_count,
+			autovacuum_count,
+			analyze_count,
+			autoanalyze_count,
+			-- partitioned tables hold no rows, their relfrozenxid is 0 and its age meaningless
+			CASE WHEN relkind <> 'p' AND relfrozenxid::text <> '0' THEN age(relfrozenxid)::bigint END
+		FROM sizes
+		ORDER BY total_size DESC, schemaname, relname;
+	`
+	rows, err := q.Query(ctx, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []model.TableHealth{}
+	for rows.Next() {
+		var t model.TableHealth
+		err := rows.Scan(
+			&t.Schema, &t.Name, &t.TotalSize, &t.TableSize, &t.IndexesSize, &t.ToastSize, &t.EstimatedBloat, &t.BloatRatio,
+			&t.LiveTuples, &t.DeadTuples, &t.DeadTupleRatio, &t.ModsSinceAnalyze,
+			&t.SeqScans, &t.SeqTuplesRead, &t.IndexScans, &t.IndexScanRatio, &t.CacheHitRatio,
+			&t.LastVacuum, &t.LastAutovacuum, &t.LastAnalyze, &t.LastAutoanalyze,
+			&t.VacuumCount, &t.AutovacuumCount, &t.AnalyzeCount, &t.AutoanalyzeCount, &t.WraparoundAge,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+
+	return tables, rows.Err()
+}
+
+// Read the sizes and usage of the indexes of the user tables
+func loadIndexHealth(ctx context.Context, q querier, schema string) ([]model.IndexHealth, error) {
+	query := `
+		SELECT
+			s.schemaname::text,
+			s.relname::text,
+			s.indexrelname::text,
+			pg_relation_size(s.indexrelid),
+			s.idx_scan,
+			s.idx_tup_read,
+			io.idx_blks_hit::float8 / NULLIF(io.idx_blks_hit + io.idx_blks_read, 0),
+			i.indisunique,
+			i.indisprimary,
+			i.indisvalid
+		FROM pg_stat_user_indexes s
+		JOIN pg_index i ON i.indexrelid = s.indexrelid
+		LEFT JOIN pg_statio_user_indexes io ON io.indexrelid = s.indexrelid
+		WHERE ($1 = '' OR s.schemaname = $1)
+		ORDER BY pg_relation_size(s.indexrelid) DESC, s.schemaname, s.indexrelname;
+	`
+	rows, err := q.Query(ctx, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := []model.IndexHealth{}
+	for rows.Next() {
+		var i model.IndexHealth
+		err := rows.Scan(&i.Schema, &i.Table, &i.Name, &i.Size, &i.Scans, &i.TuplesRead, &i.CacheHitRatio, &i.Unique, &i.Primary, &i.Valid)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, i)
+	}
+
+	return indexes, rows.Err()
+}
+
+// GetDatabaseHealth reports sizes, estimated bloat, scan and cache hit ratios, dead tuples, vacuum
+// status and wraparound age of the database of a pool. An empty schema reports every user schema.
+func (c *Connections) GetDatabaseHealth(activePoolID uuid.UUID, schema string) (*model.DatabaseHealth, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	health, err := loadDatabaseHealth(ctx, pool)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read database statistics")
+	}
+
+	health.Tables, err = loadTableHealth(ctx, pool, schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read table statistics")
+	}
+
+	health.Indexes, err = loadIndexHealth(ctx, pool, schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read index statistics")
+	}
+
+	return health, nil
+}
@@ -0,0 +1,698 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"dbmx/model"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Number of file rows returned in an import preview
+	importPreviewRows = 20
+
+	// Row errors beyond this count are counted but not reported individually
+	maxImportRowErrors = 100
+
+	// Column of the upsert staging table numbering the rows in file order
+	importRowColumn = "dbmx_import_row"
+)
+
+// Matches the row and column of a COPY error context e.g. "COPY orders, line 3, column amount: "abc""
+var copyErrorWhere = regexp.MustCompile(`line (\d+)(?:, column ([^:]+))?`)
+
+// importFile reads the records of a csv or ndjson file aligned with its columns
+type importFile struct {
+	format     string
+	file       *os.File
+	csv        *csv.Reader
+	ndjson     *bufio.Reader
+	nullString string
+
+	columns []string
+
+	// Line number the last record was read from
+	line int64
+
+	// First record of a csv file without header, read to find the number of columns
+	pending []string
+}
+
+func openImportFile(opts model.ImportOptions, ndjsonColumns []string) (*importFile, error) {
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	if format != "csv" && format != "ndjson" {
+		return nil, errors.New("invalid import format. Only csv and ndjson are allowed.")
+	}
+
+	file, err := os.Open(opts.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open import file")
+	}
+
+	f := &importFile{
+		format:     format,
+		file:       file,
+		nullString: opts.NullString,
+	}
+
+	if format == "ndjson" {
+		f.ndjson = bufio.NewReader(file)
+		f.columns = ndjsonColumns
+		return f, nil
+	}
+
+	f.csv = csv.NewReader(bufio.NewReader(file))
+	f.csv.FieldsPerRecord = -1
+	if opts.Delimiter != "" {
+		delimiter := []rune(opts.Delimiter)
+		if len(delimiter) != 1 {
+			file.Close()
+			return nil, errors.New("delimiter must be a single character")
+		}
+		f.csv.Comma = delimiter[0]
+	}
+
+	first, err := f.csv.Read()
+	if err == io.EOF {
+		file.Close()
+		return nil, errors.New("import file is empty")
+	}
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "unable to read import file")
+	}
+
+	if opts.HasHeader {
+		for i, column := range first {
+			column = strings.TrimSpace(column)
+			if i == 0 {
+				// Strip the UTF-8 byte order mark written by spreadsheet exports
+				column = strings.TrimPrefix(column, "\ufeff")
+			}
+			f.columns = append(f.columns, column)
+		}
+	} else {
+		for i := range first {
+			f.columns = append(f.columns, fmt.Sprintf("column%d", i+1))
+		}
+		f.pending = first
+	}
+
+	return f, nil
+}
+
+// next returns the next record aligned with the file columns, io.EOF once the file is read
+// A non nil rowErr reports a malformed record which can be skipped
+func (f *importFile) next() (record []sql.NullString, rowErr *model.ImportRowError, err error) {
+	if f.format == "ndjson" {
+		return f.nextNDJSON()
+	}
+
+	var fields []string
+	if f.pending != nil {
+		fields = f.pending
+		f.pending = nil
+		f.line = 1
+	} else {
+		fields, err = f.csv.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				f.line = int64(parseErr.StartLine)
+				return nil, &model.ImportRowError{Line: f.line, Message: parseErr.Err.Error()}, nil
+			}
+			return nil, nil, err
+		}
+		line, _ := f.csv.FieldPos(0)
+		f.line = int64(line)
+	}
+
+	if len(fields) != len(f.columns) {
+		return nil, &model.ImportRowError{
+			Line:    f.line,
+			Message: fmt.Sprintf("expected %d fields, found %d", len(f.columns), len(fields)),
+		}, nil
+	}
+
+	record = make([]sql.NullString, len(fields))
+	for i, field := range fields {
+		if field == "" || (f.nullString != "" && field == f.nullString) {
+			continue
+		}
+		record[i] = sql.NullString{String: field, Valid: true}
+	}
+
+	return record, nil, nil
+}
+
+func (f *importFile) nextNDJSON() ([]sql.NullString, *model.ImportRowError, error) {
+	object, rowErr, err := f.nextObject()
+	if err != nil || rowErr != nil {
+		return nil, rowErr, err
+	}
+
+	record := make([]sql.NullString, len(f.columns))
+	for i, column := range f.columns {
+		value, ok := object[column]
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			record[i] = sql.NullString{String: v, Valid: true}
+		case json.Number:
+			record[i] = sql.NullString{String: v.String(), Valid: true}
+		case bool:
+			record[i] = sql.NullString{String: strconv.FormatBool(v), Valid: true}
+		default:
+			// Nested objects and arrays are kept as json text
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, &model.ImportRowError{Line: f.line, Column: column, Message: err.Error()}, nil
+			}
+			record[i] = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+
+	return record, nil, nil
+}
+
+// nextObject decodes the next non blank line of an ndjson file
+func (f *importFile) nextObject() (map[string]any, *model.ImportRowError, error) {
+	for {
+		line, err := f.ndjson.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, nil, err
+		}
+		f.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+
+		var object map[string]any
+		if err := decoder.Decode(&object); err != nil {
+			return nil, &model.ImportRowError{Line: f.line, Message: "invalid json object: " + err.Error()}, nil
+		}
+
+		return object, nil, nil
+	}
+}
+
+func (f *importFile) close() {
+	f.file.Close()
+}
+
+// Normalize a column name so that "Customer ID" matches customer_id
+func normalizeColumnName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_", ".", "_").Replace(name)
+}
+
+// Suggest a mapping of file columns to table columns by name
+func suggestImportMapping(fileColumns []string, tableColumns []model.ColumnInfo) []model.ImportColumnMapping {
+	byName := make(map[string]model.ColumnInfo, len(tableColumns))
+	for _, column := range tableColumns {
+		byName[normalizeColumnName(column.Name)] = column
+	}
+
+	mapping := make([]model.ImportColumnMapping, 0, len(fileColumns))
+	for _, fileColumn := range fileColumns {
+		m := model.ImportColumnMapping{FileColumn: fileColumn}
+		if column, ok := byName[normalizeColumnName(fileColumn)]; ok {
+			m.TableColumn = column.Name
+			m.DataType = column.DataType
+			m.UDTName = column.UDTName
+			m.IsNullable = column.IsNullable
+		}
+		mapping = append(mapping, m)
+	}
+
+	return mapping
+}
+
+// PreviewImportFile reads the first rows of a file and suggests a column mapping for opts.TableName
+func (c *Connections) PreviewImportFile(activePoolID uuid.UUID, opts model.ImportOptions) (*model.ImportPreview, error) {
+	preview := &model.ImportPreview{Format: strings.ToLower(strings.TrimSpace(opts.Format))}
+
+	f, err := openImportFile(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer f.close()
+
+	if f.format == "ndjson" {
+		// Columns of an ndjson file are the union of the keys of the sampled objects
+		var objects []map[string]any
+		seen := make(map[string]struct{})
+		for len(objects) < importPreviewRows {
+			object, rowErr, err := f.nextObject()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if rowErr != nil {
+				return nil, fmt.Errorf("line %d: %s", rowErr.Line, rowErr.Message)
+			}
+
+			keys := make([]string, 0, len(object))
+			for key := range object {
+				if _, ok := seen[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			// Map iteration order is random, keep new keys of the same object stable
+			sort.Strings(keys)
+			for _, key := range keys {
+				seen[key] = struct{}{}
+				f.columns = append(f.columns, key)
+			}
+			objects = append(objects, object)
+		}
+
+		for _, object := range objects {
+			row := make([]string, len(f.columns))
+			for i, column := range f.columns {
+				switch v := object[column].(type) {
+				case nil:
+					row[i] = "NULL"
+				case string:
+					row[i] = v
+				case json.Number:
+					row[i] = v.String()
+				default:
+					b, _ := json.Marshal(v)
+					row[i] = string(b)
+				}
+			}
+			preview.Rows = append(preview.Rows, row)
+		}
+	} else {
+		for len(preview.Rows) < importPreviewRows {
+			record, rowErr, err := f.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if rowErr != nil {
+				return nil, fmt.Errorf("line %d: %s", rowErr.Line, rowErr.Message)
+			}
+
+			row := make([]string, len(record))
+			for i, value := range record {
+				if value.Valid {
+					row[i] = value.String
+				} else {
+					row[i] = "NULL"
+				}
+			}
+			preview.Rows = append(preview.Rows, row)
+		}
+	}
+
+	preview.FileColumns = f.columns
+
+	if strings.TrimSpace(opts.TableName) == "" {
+		return preview, nil
+	}
+
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	tableColumns, err := getTableColumns(context.Background(), pool, opts.Schema, opts.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(tableColumns) == 0 {
+		return nil, fmt.Errorf("table %s not found", opts.TableName)
+	}
+
+	preview.TableColumns = tableColumns
+	preview.Mapping = suggestImportMapping(f.columns, tableColumns)
+
+	return preview, nil
+}
+
+// importSource streams the coerced records of an import file into CopyFrom
+type importSource struct {
+	file *importFile
+
+	// Index of each mapped column in the file record
+	indexes []int
+	mapping []model.ImportColumnMapping
+	skip    bool
+
+	values []any
+	err    error
+
+	result *model.ImportResult
+
+	// copyLines maps the rows sent to COPY back to file lines. Each entry marks the copy row
+	// from which the line offset changes, so that only skipped rows and multi line records cost memory.
+	copyLines []copyLineOffset
+	copied    int64
+}
+
+type copyLineOffset struct {
+	row    int64
+	offset int64
+}
+
+func (s *importSource) Next() bool {
+	for {
+		record, rowErr, err := s.file.next()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			s.err = err
+			return false
+		}
+		s.result.RowsRead++
+
+		if rowErr == nil {
+			s.values, rowErr = s.coerce(record)
+		}
+
+		if rowErr != nil {
+			s.addError(*rowErr)
+			if !s.skip {
+				s.err = fmt.Errorf("line %d: %s", rowErr.Line, rowErr.Message)
+				return false
+			}
+			s.result.RowsSkipped++
+			continue
+		}
+
+		s.copied++
+		offset := s.file.line - s.copied
+		if n := len(s.copyLines); n == 0 || s.copyLines[n-1].offset != offset {
+			s.copyLines = append(s.copyLines, copyLineOffset{row: s.copied, offset: offset})
+		}
+
+		return true
+	}
+}
+
+func (s *importSource) coerce(record []sql.NullString) ([]any, *model.ImportRowError) {
+	values := make([]any, len(s.mapping))
+	for i, m := range s.mapping {
+		raw := record[s.indexes[i]]
+		if !raw.Valid {
+			if !m.IsNullable {
+				return nil, &model.ImportRowError{Line: s.file.line, Column: m.TableColumn, Message: "null value in not null column"}
+			}
+			continue
+		}
+
+		value, err := coerceValue(m.UDTName, raw.String)
+		if err != nil {
+			return nil, &model.ImportRowError{Line: s.file.line, Column: m.TableColumn, Value: raw.String, Message: err.Error()}
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+func (s *importSource) addError(rowErr model.ImportRowError) {
+	if len(s.result.Errors) < maxImportRowErrors {
+		s.result.Errors = append(s.result.Errors, rowErr)
+	}
+}
+
+func (s *importSource) Values() ([]any, error) {
+	return s.values, nil
+}
+
+func (s *importSource) Err() error {
+	return s.err
+}
+
+// fileLine returns the file line of the nth row sent to COPY
+func (s *importSource) fileLine(row int64) int64 {
+	i := sort.Search(len(s.copyLines), func(i int) bool { return s.copyLines[i].row > row }) - 1
+	if i < 0 {
+		return row
+	}
+	return row + s.copyLines[i].offset
+}
+
+// ImportFile loads a csv or ndjson file into a table with COPY inside a single transaction
+func (c *Connections) ImportFile(activePoolID uuid.UUID, opts model.ImportOptions) (*model.ImportResult, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	if strings.TrimSpace(opts.TableName) == "" {
+		return nil, errors.New("table name is required for import")
+	}
+	if opts.Truncate && opts.Upsert {
+		return nil, errors.New("truncate and upsert can't be used together")
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+
+	tableColumns, err := getTableColumns(ctx, pool, opts.Schema, opts.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(tableColumns) == 0 {
+		return nil, fmt.Errorf("table %s not found", opts.TableName)
+	}
+	columnsByName := make(map[string]model.ColumnInfo, len(tableColumns))
+	for _, column := range tableColumns {
+		columnsByName[column.Name] = column
+	}
+
+	// Keep the mapped columns and take their types from the table rather than the request
+	var mapping []model.ImportColumnMapping
+	mappedTo := make(map[string]string)
+	for _, m := range opts.Mapping {
+		if m.TableColumn == "" {
+			continue
+		}
+		column, ok := columnsByName[m.TableColumn]
+		if !ok {
+			return nil, fmt.Errorf("column %s does not exist in table %s", m.TableColumn, opts.TableName)
+		}
+		if fileColumn, ok := mappedTo[m.TableColumn]; ok {
+			return nil, fmt.Errorf("column %s is mapped from both %s and %s", m.TableColumn, fileColumn, m.FileColumn)
+		}
+		mappedTo[m.TableColumn] = m.FileColumn
+
+		m.DataType = column.DataType
+		m.UDTName = column.UDTName
+		m.IsNullable = column.IsNullable
+		mapping = append(mapping, m)
+	}
+	if len(mapping) == 0 {
+		return nil, errors.New("at least one column must be mapped")
+	}
+
+	fileColumns := make([]string, len(mapping))
+	for i, m := range mapping {
+		fileColumns[i] = m.FileColumn
+	}
+
+	f, err := openImportFile(opts, fileColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer f.close()
+
+	// Find each mapped column in the file record
+	indexes := make([]int, len(mapping))
+	for i, m := range mapping {
+		indexes[i] = -1
+		for j, column := range f.columns {
+			if column == m.FileColumn {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			return nil, fmt.Errorf("column %s not found in file", m.FileColumn)
+		}
+	}
+
+	targetColumns := make([]string, len(mapping))
+	for i, m := range mapping {
+		targetColumns[i] = m.TableColumn
+	}
+
+	var conflictColumns []string
+	if opts.Upsert {
+		conflictColumns = opts.ConflictColumns
+		if len(conflictColumns) == 0 {
+			conflictColumns, err = getPrimaryKeyColumns(ctx, pool, opts.Schema, opts.TableName)
+			if err != nil {
+				return nil, err
+			}
+			if len(conflictColumns) == 0 {
+				return nil, fmt.Errorf("table %s has no primary key, conflict columns are required for upsert", opts.TableName)
+			}
+		}
+		for _, column := range conflictColumns {
+			if _, ok := mappedTo[column]; !ok {
+				return nil, fmt.Errorf("conflict column %s must be mapped for upsert", column)
+			}
+		}
+	}
+
+	result := &model.ImportResult{}
+	source := &importSource{
+		file:    f,
+		indexes: indexes,
+		mapping: mapping,
+		skip:    opts.SkipInvalidRows,
+		result:  result,
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	safeTable := qualifiedTableName(opts.Schema, opts.TableName)
+
+	if opts.Truncate {
+		if _, err := tx.Exec(ctx, "TRUNCATE "+safeTable); err != nil {
+			return nil, err
+		}
+	}
+
+	quotedColumns := make([]string, len(targetColumns))
+	for i, column := range targetColumns {
+		quotedColumns[i] = pgx.Identifier{column}.Sanitize()
+	}
+
+	// Upserts are copied into a temporary table first and merged with INSERT ... ON CONFLICT. It
+	// only has the mapped columns, without their constraints, and numbers the rows in file order.
+	copyTable := pgx.Identifier{schemaOrDefault(opts.Schema), opts.TableName}
+	if opts.Upsert {
+		copyTable = pgx.Identifier{"dbmx_import_" + strings.ReplaceAll(uuid.New().String(), "-", "")}
+		query := fmt.Sprintf(
+			"CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+			copyTable.Sanitize(), strings.Join(quotedColumns, ", "), safeTable,
+		)
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return nil, err
+		}
+		query = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s bigint GENERATED ALWAYS AS IDENTITY", copyTable.Sanitize(), importRowColumn)
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	copied, err := tx.CopyFrom(ctx, copyTable, targetColumns, source)
+	if err != nil {
+		result.Message = err.Error()
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			result.Message = pgErr.Message
+			rowErr := model.ImportRowError{Message: pgErr.Message}
+			if match := copyErrorWhere.FindStringSubmatch(pgErr.Where); match != nil {
+				row, _ := strconv.ParseInt(match[1], 10, 64)
+				rowErr.Line = source.fileLine(row)
+				rowErr.Column = match[2]
+			}
+			if pgErr.Detail != "" {
+				rowErr.Message += ": " + pgErr.Detail
+			}
+			source.addError(rowErr)
+		}
+
+		result.ExecutionTime = time.Since(start).Milliseconds()
+		return result, nil
+	}
+	result.RowsImported = copied
+
+	if opts.Upsert {
+		conflict := make(map[string]struct{}, len(conflictColumns))
+		quotedConflict := make([]string, len(conflictColumns))
+		for i, column := range conflictColumns {
+			conflict[column] = struct{}{}
+			quotedConflict[i] = pgx.Identifier{column}.Sanitize()
+		}
+
+		var updates []string
+		for i, column := range targetColumns {
+			if _, ok := conflict[column]; !ok {
+				updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quotedColumns[i], quotedColumns[i]))
+			}
+		}
+
+		action := "DO NOTHING"
+		if len(updates) > 0 {
+			action = "DO UPDATE SET " + strings.Join(updates, ", ")
+		}
+
+		// A row can only be upserted once per statement, the last row of the file with a
+		// conflict key wins
+		query := fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, %s DESC ON CONFLICT (%s) %s",
+			safeTable,
+			strings.Join(quotedColumns, ", "),
+			strings.Join(quotedConflict, ", "),
+			strings.Join(quotedColumns, ", "),
+			copyTable.Sanitize(),
+			strings.Join(quotedConflict, ", "),
+			importRowColumn,
+			strings.Join(quotedConflict, ", "),
+			action,
+		)
+		tag, err := tx.Exec(ctx, query)
+		if err != nil {
+			result.Message = err.Error()
+			result.RowsImported = 0
+			result.ExecutionTime = time.Since(start).Milliseconds()
+			return result, nil
+		}
+		result.RowsImported = tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	result.OK = true
+	result.Message = fmt.Sprintf("Imported %d rows into %s", result.RowsImported, opts.TableName)
+	if result.RowsSkipped > 0 {
+		result.Message += fmt.Sprintf(", skipped %d invalid rows", result.RowsSkipped)
+	}
+	result.ExecutionTime = time.Since(start).Milliseconds()
+
+	return result, nil
+}
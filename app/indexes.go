@@ -0,0 +1,451 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Render a CREATE INDEX statement, entries which aren't columns of the table are expressions
+func createIndexSQL(schema, table string, tableColumns []string, index model.DesignIndex, concurrently bool) string {
+	var columns []string
+	for _, column := range index.Columns {
+		if containsString(tableColumns, column) {
+			columns = append(columns, quoteIdent(column))
+		} else {
+			columns = append(columns, "("+column+")")
+		}
+	}
+
+	method := index.Method
+	if method == "" {
+		method = "btree"
+	}
+
+	definition := "CREATE "
+	if index.Unique {
+		definition += "UNIQUE "
+	}
+	definition += "INDEX "
+	if concurrently {
+		definition += "CONCURRENTLY "
+	}
+	definition += fmt.Sprintf("%s ON %s USING %s (%s)", quoteIdent(index.Name), quoteQualified(schema, table), method, strings.Join(columns, ", "))
+	if len(index.Include) > 0 {
+		definition += " INCLUDE (" + quoteColumns(index.Include) + ")"
+	}
+	if index.Where != "" {
+		definition += " WHERE " + index.Where
+	}
+	return definition
+}
+
+// Name an index the way Postgres does, expressions are named expr
+func defaultIndexName(table string, columns []string) string {
+	parts := []string{table}
+	for _, column := range columns {
+		if !plainIdentifier.MatchString(column) {
+			column = "expr"
+		}
+		parts = append(parts, column)
+	}
+	return strings.Join(append(parts, "idx"), "_")
+}
+
+// CreateIndex creates an index on a table and returns the statement it ran. Concurrent builds
+// don't block writes but take longer and can't be rolled back.
+func (c *Connections) CreateIndex(activePoolID uuid.UUID, opts model.CreateIndexOptions) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	if opts.Table == "" {
+		return "", errors.New("table name is required")
+	}
+	if len(opts.Index.Columns) == 0 {
+		return "", errors.New("index needs at least one column")
+	}
+
+	ctx := context.Background()
+	schema := schemaOrDefault(opts.Schema)
+
+	tableColumns, err := getTableColumns(ctx, pool, schema, opts.Table)
+	if err != nil {
+		return "", err
+	}
+	if len(tableColumns) == 0 {
+		return "", fmt.Errorf("table %s.%s does not exist", schema, opts.Table)
+	}
+	var columnNames []string
+	for _, column := range tableColumns {
+		columnNames = append(columnNames, column.Name)
+	}
+	for _, column := range opts.Index.Include {
+		if !containsString(columnNames, column) {
+			return "", fmt.Errorf("column %s does not exist in %s.%s", column, schema, opts.Table)
+		}
+	}
+
+	index := opts.Index
+	if index.Name == "" {
+		index.Name = defaultIndexName(opts.Table, index.Columns)
+	}
+
+	statement := createIndexSQL(schema, opts.Table, columnNames, index, opts.Concurrently) + ";"
+	if _, err := pool.Exec(ctx, statement); err != nil {
+		if opts.Concurrently {
+			return "", errors.Wrapf(err, "failed to create index %s, a failed concurrent build can leave an invalid index behind which has to be dropped", index.Name)
+		}
+		return "", err
+	}
+
+	return statement, nil
+}
+
+// DropIndex drops an index and returns the statement it ran
+func (c *Connections) DropIndex(activePoolID uuid.UUID, schema, indexName string, concurrently bool) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	statement := "DROP INDEX "
+	if concurrently {
+		statement += "CONCURRENTLY "
+	}
+	statement += quoteQualified(schemaOrDefault(schema), indexName) + ";"
+
+	if _, err := pool.Exec(context.Background(), statement); err != nil {
+		return "", err
+	}
+
+	return statement, nil
+}
+
+// An index as seen by the advisor
+type advisorIndex struct {
+	schema, table, name string
+	tableOID            uint32
+	// Index of a partitioned table, it has no storage or usage counters of its own
+	partitioned bool
+	method      string
+	// Identity of the whole definition, equal for duplicate indexes
+	definition string
+	// Key columns as attnum:opclass:collation:option, expressions have attnum 0
+	keys       []string
+	attnums    []int16
+	predicate  string
+	unique     bool
+	primary    bool
+	constraint bool
+	valid      bool
+	size       int64
+	scans      int64
+}
+
+func (i advisorIndex) hasExpressions() bool {
+	return slices.Contains(i.attnums, 0)
+}
+
+// Drop statement of a redundant index, concurrent drops aren't supported on partitioned tables
+func (i advisorIndex) dropSQL() string {
+	if i.constraint {
+		return ""
+	}
+	if i.partitioned {
+		return fmt.Sprintf("DROP INDEX %s;", quoteQualified(i.schema, i.name))
+	}
+	return fmt.Sprintf("DROP INDEX CONCURRENTLY %s;", quoteQualified(i.schema, i.name))
+}
+
+func (i advisorIndex) advice(kind, message string) model.IndexAdvice {
+	return model.IndexAdvice{
+		Kind:    kind,
+		Schema:  i.schema,
+		Table:   i.table,
+		Index:   i.name,
+		Size:    i.size,
+		Scans:   i.scans,
+		Message: message,
+		SQL:     i.dropSQL(),
+	}
+}
+
+func loadAdvisorIndexes(ctx context.Context, q querier, schemas []string) ([]advisorIndex, error) {
+	query := `
+		SELECT
+			n.nspname::text,
+			t.relname::text,
+			i.relname::text,
+			t.oid,
+			i.relkind = 'I',
+			am.amname::text,
+			concat_ws('|', am.amname, idx.indkey::text, idx.indclass::text, idx.indcollation::text, idx.indoption::text,
+				COALESCE(pg_get_expr(idx.indexprs, idx.indrelid), ''), COALESCE(pg_get_expr(idx.indpred, idx.indrelid), '')),
+			ARRAY(
+				SELECT concat_ws(':', idx.indkey[k], idx.indclass[k], idx.indcollation[k], idx.indoption[k])
+				FROM generate_series(0, idx.indnkeyatts - 1) AS k
+				ORDER BY k
+			),
+			ARRAY(
+				SELECT idx.indkey[k]
+				FROM generate_series(0, idx.indnkeyatts - 1) AS k
+				ORDER BY k
+			),
+			COALESCE(pg_get_expr(idx.indpred, idx.indrelid), ''),
+			idx.indisunique,
+			idx.indisprimary,
+			EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = idx.indexrelid AND con.contype IN ('p', 'u', 'x')),
+			idx.indisvalid,
+			pg_relation_size(i.oid),
+			COALESCE(s.idx_scan, 0)
+		FROM pg_index idx
+		JOIN pg_class i      ON i.oid = idx.indexrelid
+		JOIN pg_class t      ON t.oid = idx.indrelid
+		JOIN pg_namespace n  ON n.oid = t.relnamespace
+		JOIN pg_am am        ON am.oid = i.relam
+		LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = idx.indexrelid
+		WHERE n.nspname = ANY($1)
+		ORDER BY n.nspname, t.relname, i.relname;
+	`
+	rows, err := q.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []advisorIndex
+	for rows.Next() {
+		var i advisorIndex
+		err := rows.Scan(&i.schema, &i.table, &i.name, &i.tableOID, &i.partitioned, &i.method, &i.definition, &i.keys, &i.attnums,
+			&i.predicate, &i.unique, &i.primary, &i.constraint, &i.valid, &i.size, &i.scans)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, i)
+	}
+
+	return indexes, rows.Err()
+}
+
+// Pick the index to keep out of duplicates: the one backing a constraint, then a unique one,
+// then the most used one
+func preferredIndex(a, b advisorIndex) bool {
+	switch {
+	case a.primary != b.primary:
+		return a.primary
+	case a.constraint != b.constraint:
+		return a.constraint
+	case a.unique != b.unique:
+		return a.unique
+	case a.scans != b.scans:
+		return a.scans > b.scans
+	}
+	return a.name < b.name
+}
+
+// GetIndexAdvice flags invalid, duplicate, overlapping and unused indexes, and foreign keys
+// without an index on their columns. All user schemas are checked when schema is empty.
+func (c *Connections) GetIndexAdvice(activePoolID uuid.UUID, schema string) (*model.IndexAdvisorReport, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+
+	schemas := []string{schema}
+	if schema == "" {
+		var err error
+		schemas, err = listUserSchemas(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resetAt, err := statsResetAt(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	report := &model.IndexAdvisorReport{StatsResetAt: resetAt}
+
+	indexes, err := loadAdvisorIndexes(ctx, pool, schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	// Indexes already reported as redundant aren't reported as unused as well
+	redundant := make(map[string]struct{})
+	key := func(i advisorIndex) string { return i.schema + "." + i.name }
+
+	for _, i := range indexes {
+		if !i.valid {
+			advice := i.advice(model.IndexAdviceInvalid, "The index is invalid, usually after a failed concurrent build. It isn't used by queries but may still slow down writes, drop it and create it again.")
+			if advice.SQL == "" {
+				advice.SQL = fmt.Sprintf("REINDEX INDEX CONCURRENTLY %s;", quoteQualified(i.schema, i.name))
+			}
+			report.Advice = append(report.Advice, advice)
+			redundant[key(i)] = struct{}{}
+		}
+	}
+
+	// Duplicates have the same columns, operator classes, expressions and predicate
+	groups := make(map[string][]advisorIndex)
+	var groupKeys []string
+	for _, i := range indexes {
+		if !i.valid {
+			continue
+		}
+		groupKey := fmt.Sprintf("%d|%s", i.tableOID, i.definition)
+		if _, ok := groups[groupKey]; !ok {
+			groupKeys = append(groupKeys, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], i)
+	}
+	for _, groupKey := range groupKeys {
+		group := groups[groupKey]
+		if len(group) < 2 {
+			continue
+		}
+		keep := group[0]
+		for _, i := range group[1:] {
+			if preferredIndex(i, keep) {
+				keep = i
+			}
+		}
+		for _, i := range group {
+			if i.name == keep.name {
+				continue
+			}
+			message := fmt.Sprintf("The index duplicates %s.", keep.name)
+			if i.constraint {
+				message += " Both back a constraint, drop one of the constraints instead."
+			}
+			advice := i.advice(model.IndexAdviceDuplicate, message)
+			advice.CoveredBy = keep.name
+			report.Advice = append(report.Advice, advice)
+			redundant[key(i)] = struct{}{}
+		}
+	}
+
+	// A btree index whose columns are a leading part of another index of the table is redundant,
+	// unless it enforces uniqueness
+	for _, a := range indexes {
+		if _, ok := redundant[key(a)]; ok || a.method != "btree" || a.unique || a.hasExpressions() || a.predicate != "" {
+			continue
+		}
+		for _, b := range indexes {
+			if b.tableOID != a.tableOID || !b.valid || b.method != "btree" || b.predicate != "" || len(b.keys) <= len(a.keys) {
+				continue
+			}
+			if slices.Equal(b.keys[:len(a.keys)], a.keys) {
+				advice := a.advice(model.IndexAdviceOverlapping, fmt.Sprintf("The columns of the index are the leading columns of %s, which can serve the same queries.", b.name))
+				advice.CoveredBy = b.name
+				report.Advice = append(report.Advice, advice)
+				redundant[key(a)] = struct{}{}
+				break
+			}
+		}
+	}
+
+	for _, i := range indexes {
+		if _, ok := redundant[key(i)]; ok || i.partitioned || i.unique || i.constraint || i.scans > 0 {
+			continue
+		}
+		report.Advice = append(report.Advice, i.advice(model.IndexAdviceUnused, "The index hasn't been scanned since the statistics were reset but is updated on every write."))
+	}
+
+	missing, err := missingForeignKeyIndexes(ctx, pool, schemas, indexes)
+	if err != nil {
+		return nil, err
+	}
+	report.Advice = append(report.Advice, missing...)
+
+	return report, nil
+}
+
+// Foreign keys whose columns aren't the leading columns of an index. Deleting or updating a
+// referenced row then scans the referencing table.
+func missingForeignKeyIndexes(ctx context.Context, q querier, schemas []string, indexes []advisorIndex) ([]model.IndexAdvice, error) {
+	query := `
+		SELECT
+			n.nspname::text,
+			t.relname::text,
+			con.conname::text,
+			con.conrelid,
+			t.relkind = 'p',
+			con.conkey,
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			)
+		FROM pg_constraint con
+		JOIN pg_class t     ON t.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE con.contype = 'f'
+		  AND con.conparentid = 0
+		  AND n.nspname = ANY($1)
+		ORDER BY n.nspname, t.relname, con.conname;
+	`
+	rows, err := q.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var advice []model.IndexAdvice
+	for rows.Next() {
+		var schema, table, name string
+		var tableOID uint32
+		var partitioned bool
+		var attnums []int16
+		var columns []string
+		err := rows.Scan(&schema, &table, &name, &tableOID, &partitioned, &attnums, &columns)
+		if err != nil {
+			return nil, err
+		}
+
+		covered := slices.ContainsFunc(indexes, func(i advisorIndex) bool {
+			if i.tableOID != tableOID || !i.valid || i.predicate != "" || len(i.attnums) < len(attnums) {
+				return false
+			}
+			leading := slices.Clone(i.attnums[:len(attnums)])
+			expected := slices.Clone(attnums)
+			slices.Sort(leading)
+			slices.Sort(expected)
+			return slices.Equal(leading, expected)
+		})
+		if covered {
+			continue
+		}
+
+		index := model.DesignIndex{Name: defaultIndexName(table, columns), Columns: columns}
+		advice = append(advice, model.IndexAdvice{
+			Kind:       model.IndexAdviceMissingFK,
+			Schema:     schema,
+			Table:      table,
+			ForeignKey: name,
+			Columns:    columns,
+			Message:    fmt.Sprintf("No index starts with the columns of foreign key %s, deleting or updating a referenced row scans %s.", name, table),
+			SQL:        createIndexSQL(schema, table, columns, index, !partitioned) + ";",
+		})
+	}
+
+	return advice, rows.Err()
+}
+
+// Stats reset time of the current database, nil if it was never reset
+func statsResetAt(ctx context.Context, q querier) (*time.Time, error) {
+	var resetAt *time.Time
+	err := q.QueryRow(ctx, "SELECT stats_reset FROM pg_stat_database WHERE datname = current_database()").Scan(&resetAt)
+	return resetAt, err
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Rows and bytes processed by a job are emitted at most once per interval
+const jobProgressInterval = 500 * time.Millisecond
+
+// job is a running background job, cancelled through CancelJob
+type job struct {
+	c      *Connections
+	cancel context.CancelFunc
+	// Pools the job holds connections of and closed once the job finished
+	pools []uuid.UUID
+	done  chan struct{}
+
+	mu       sync.Mutex
+	info     model.Job
+	lastEmit time.Time
+}
+
+// Register a job running on pools, the returned context is cancelled by CancelJob and when one of
+// the pools is closed
+func (c *Connections) startJob(kind, description string, pools ...uuid.UUID) (*job, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		c:      c,
+		cancel: cancel,
+		pools:  pools,
+		done:   make(chan struct{}),
+		info:   model.Job{ID: uuid.New().String(), Kind: kind, Description: description, StartedAt: time.Now()},
+	}
+
+	c.jobMu.Lock()
+	c.jobs[j.info.ID] = j
+	c.jobMu.Unlock()
+
+	return j, ctx
+}
+
+// step moves the job to its next step and emits the progress
+func (j *job) step(step string, done, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.info.Progress.Step = step
+	j.info.Progress.Done = done
+	j.info.Progress.Total = total
+	j.emitProgress()
+}
+
+// addProgress counts processed rows and bytes
+func (j *job) addProgress(rows, bytes int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.info.Progress.Rows += rows
+	j.info.Progress.Bytes += bytes
+	if time.Since(j.lastEmit) >= jobProgressInterval {
+		j.emitProgress()
+	}
+}
+
+func (j *job) emitProgress() {
+	j.lastEmit = time.Now()
+	if elapsed := j.lastEmit.Sub(j.info.StartedAt).Seconds(); elapsed > 0 {
+		j.info.Progress.RowsPerSecond = float64(j.info.Progress.Rows) / elapsed
+		j.info.Progress.BytesPerSecond = float64(j.info.Progress.Bytes) / elapsed
+	}
+	j.c.emit("jobProgress", j.info.ID, j.info.Progress)
+}
+
+// finishJob unregisters a job and emits its result as a jobFinished event
+func (c *Connections) finishJob(ctx context.Context, j *job, message string, err error) {
+	c.jobMu.Lock()
+	delete(c.jobs, j.info.ID)
+	c.jobMu.Unlock()
+
+	j.mu.Lock()
+	result := model.JobResult{
+		JobID:         j.info.ID,
+		Kind:          j.info.Kind,
+		OK:            err == nil,
+		Message:       message,
+		Rows:          j.info.Progress.Rows,
+		Bytes:         j.info.Progress.Bytes,
+		ExecutionTime: time.Since(j.info.StartedAt).Milliseconds(),
+	}
+	j.mu.Unlock()
+	if err != nil {
+		result.Message = err.Error()
+		if ctx.Err() != nil {
+			result.Cancelled = true
+			result.Message = "cancelled"
+		}
+	}
+	j.cancel()
+	close(j.done)
+
+	c.emit("jobFinished", result.JobID, result)
+}
+
+// Cancel the jobs running on a pool and wait until they finished. It has to run before the pool
+// is closed, closing waits for acquired connections.
+func (c *Connections) stopPoolJobs(activePoolID uuid.UUID) {
+	c.jobMu.Lock()
+	var running []*job
+	for _, j := range c.jobs {
+		if slices.Contains(j.pools, activePoolID) {
+			running = append(running, j)
+		}
+	}
+	c.jobMu.Unlock()
+
+	for _, j := range running {
+		j.cancel()
+		<-j.done
+	}
+}
+
+// CancelJob stops a running job, it finishes with a cancelled result
+func (c *Connections) CancelJob(jobID string) error {
+	c.jobMu.Lock()
+	j, isRunning := c.jobs[jobID]
+	c.jobMu.Unlock()
+	if !isRunning {
+		return errors.New("job doesn't exist")
+	}
+
+	j.cancel()
+	return nil
+}
+
+// GetJobs returns the running jobs with their progress, oldest first
+func (c *Connections) GetJobs() []model.Job {
+	c.jobMu.Lock()
+	running := make([]*job, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		running = append(running, j)
+	}
+	c.jobMu.Unlock()
+
+	jobs := make([]model.Job, 0, len(running))
+	for _, j := range running {
+		j.mu.Lock()
+		jobs = append(jobs, j.info)
+		j.mu.Unlock()
+	}
+	slices.SortFunc(jobs, func(a, b model.Job) int { return a.StartedAt.Compare(b.StartedAt) })
+
+	return jobs
+}
+
+// progressWriter counts the bytes written through it as progress of a job
+type progressWriter struct {
+	w   io.Writer
+	job *job
+	n   int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.job.addProgress(0, int64(n))
+	return n, err
+}
+
+// progressReader counts the bytes read through it as progress of a job
+type progressReader struct {
+	r   io.Reader
+	job *job
+	n   int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.job.addProgress(0, int64(n))
+	return n, err
+}
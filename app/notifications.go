@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// notificationListener holds a connection of a pool dedicated to LISTEN. The connection waits
+// for notifications in the background, commands pause the wait to use it.
+type notificationListener struct {
+	conn *pgxpool.Conn
+
+	// Guards channels, cancelWait and closed, held by commands for their whole run
+	mu         sync.Mutex
+	channels   []string
+	cancelWait context.CancelFunc
+	// The connection went back to the pool
+	closed bool
+
+	// Held while the connection waits for notifications
+	connMu sync.Mutex
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// Run a command on the listener connection while the wait for notifications is paused
+func (l *notificationListener) exec(ctx context.Context, sql string) error {
+	l.cancelWait()
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+
+	_, err := l.conn.Exec(ctx, sql)
+	return err
+}
+
+// Wait for notifications and emit them until the listener is stopped or its connection fails.
+// The connection goes back to the pool when it returns.
+func (c *Connections) runNotificationListener(ctx context.Context, activePoolID uuid.UUID, l *notificationListener) {
+	defer close(l.done)
+	defer l.release()
+
+	for {
+		l.mu.Lock()
+		if ctx.Err() != nil {
+			l.mu.Unlock()
+			return
+		}
+		waitCtx, cancelWait := context.WithCancel(ctx)
+		l.cancelWait = cancelWait
+		l.connMu.Lock()
+		l.mu.Unlock()
+
+		notification, err := l.conn.Conn().WaitForNotification(waitCtx)
+		l.connMu.Unlock()
+		paused := waitCtx.Err() != nil
+		cancelWait()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if paused {
+				// A command needs the connection, wait again once it's done
+				continue
+			}
+			c.emit("notificationError", activePoolID.String(), err.Error())
+			c.listenMu.Lock()
+			if c.listeners[activePoolID] == l {
+				delete(c.listeners, activePoolID)
+			}
+			c.listenMu.Unlock()
+			return
+		}
+
+		c.emit("notification", activePoolID.String(), model.Notification{
+			Channel:    notification.Channel,
+			Payload:    notification.Payload,
+			PID:        notification.PID,
+			ReceivedAt: time.Now(),
+		})
+	}
+}
+
+// Listen subscribes to channels on a dedicated connection of a pool. Notifications are emitted as
+// notification events with the pool id. It returns every channel listened to.
+func (c *Connections) Listen(activePoolID uuid.UUID, channels []string) ([]string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("at least one channel is required")
+	}
+
+	ctx := context.Background()
+	c.listenMu.Lock()
+	l, isListening := c.listeners[activePoolID]
+	if !isListening {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			c.listenMu.Unlock()
+			return nil, err
+		}
+		listenCtx, stop := context.WithCancel(context.Background())
+		l = &notificationListener{conn: conn, cancelWait: func() {}, stop: stop, done: make(chan struct{})}
+		c.listeners[activePoolID] = l
+		go c.runNotificationListener(listenCtx, activePoolID, l)
+	}
+	c.listenMu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, errors.New("the listener stopped, listen again")
+	}
+
+	for _, channel := range channels {
+		if channel == "" || slices.Contains(l.channels, channel) {
+			continue
+		}
+		if err := l.exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return slices.Clone(l.channels), err
+		}
+		l.channels = append(l.channels, channel)
+	}
+
+	return slices.Clone(l.channels), nil
+}
+
+// Unlisten unsubscribes from channels, the dedicated connection goes back to the pool once no
+// channel is left. It returns the channels still listened to.
+func (c *Connections) Unlisten(activePoolID uuid.UUID, channels []string) ([]string, error) {
+	c.listenMu.Lock()
+	l, isListening := c.listeners[activePoolID]
+	c.listenMu.Unlock()
+	if !isListening {
+		return []string{}, nil
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return []string{}, nil
+	}
+	for _, channel := range channels {
+		if !slices.Contains(l.channels, channel) {
+			continue
+		}
+		if err := l.exec(context.Background(), "UNLISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			remaining := slices.Clone(l.channels)
+			l.mu.Unlock()
+			return remaining, err
+		}
+		l.channels = slices.DeleteFunc(l.channels, func(name string) bool { return name == channel })
+	}
+	remaining := slices.Clone(l.channels)
+	l.mu.Unlock()
+
+	if len(remaining) == 0 {
+		c.stopNotificationListener(activePoolID)
+	}
+	return remaining, nil
+}
+
+// GetListenChannels returns the channels listened to on a pool
+func (c *Connections) GetListenChannels(activePoolID uuid.UUID) []string {
+	c.listenMu.Lock()
+	l, isListening := c.listeners[activePoolID]
+	c.listenMu.Unlock()
+	if !isListening {
+		return []string{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.channels)
+}
+
+// Notify sends a notification with a payload on a channel
+func (c *Connections) Notify(activePoolID uuid.UUID, channel, payload string) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("channel is required")
+	}
+
+	_, err := pool.Exec(context.Background(), "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// Stop listening on a pool and wait until the connection went back to the pool. It has to run
+// before the pool is closed, closing waits for acquired connections.
+func (c *Connections) stopNotificationListener(activePoolID uuid.UUID) {
+	c.listenMu.Lock()
+	l, isListening := c.listeners[activePoolID]
+	delete(c.listeners, activePoolID)
+	c.listenMu.Unlock()
+	if !isListening {
+		return
+	}
+
+	l.stop()
+	<-l.done
+}
+
+// Give the connection back to the pool. Its subscriptions are dropped first, a connection which
+// can't drop them is closed instead.
+func (l *notificationListener) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := l.conn.Exec(ctx, "UNLISTEN *"); err != nil {
+		log.Printf("failed to unlisten, closing the listener connection: %v", err)
+		conn := l.conn.Hijack()
+		conn.Close(ctx)
+		return
+	}
+	l.conn.Release()
+}
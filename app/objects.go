@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// Definition query of every object kind, each takes the oid of the object as $1
+var objectDefinitionQueries = map[string]string{
+	model.ObjectKindView: `
+		SELECT 'CREATE OR REPLACE VIEW ' || format('%I.%I', n.nspname, c.relname) || E' AS\n' || pg_get_viewdef(c.oid, true)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1 AND c.relkind = 'v';
+	`,
+	model.ObjectKindMaterializedView: `
+		SELECT 'CREATE MATERIALIZED VIEW ' || format('%I.%I', n.nspname, c.relname) || E' AS\n' || pg_get_viewdef(c.oid, true)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1 AND c.relkind = 'm';
+	`,
+	model.ObjectKindForeignTable: `
+		SELECT
+			'CREATE FOREIGN TABLE ' || format('%I.%I', n.nspname, c.relname) || E' (\n'
+			|| COALESCE((
+				SELECT string_agg(
+					'    ' || quote_ident(a.attname) || ' ' || format_type(a.atttypid, a.atttypmod)
+						|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END,
+					E',\n' ORDER BY a.attnum
+				)
+				FROM pg_attribute a
+				WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+			), '')
+			|| E'\n)\nSERVER ' || quote_ident(s.srvname)
+			|| COALESCE(E'\nOPTIONS (' || (
+				SELECT string_agg(quote_ident(split_part(o, '=', 1)) || ' ' || quote_literal(substr(o, strpos(o, '=') + 1)), ', ')
+				FROM unnest(ft.ftoptions) o
+			) || ')', '')
+			|| ';'
+		FROM pg_class c
+		JOIN pg_namespace n      ON n.oid = c.relnamespace
+		JOIN pg_foreign_table ft ON ft.ftrelid = c.oid
+		JOIN pg_foreign_server s ON s.oid = ft.ftserver
+		WHERE c.oid = $1;
+	`,
+	model.ObjectKindSequence: `
+		SELECT
+			'CREATE SEQUENCE ' || format('%I.%I', n.nspname, c.relname)
+			|| ' AS ' || format_type(s.seqtypid, NULL)
+			|| E'\n    INCREMENT BY ' || s.seqincrement
+			|| E'\n    MINVALUE ' || s.seqmin
+			|| E'\n    MAXVALUE ' || s.seqmax
+			|| E'\n    START WITH ' || s.seqstart
+			|| E'\n    CACHE ' || s.seqcache
+			|| CASE WHEN s.seqcycle THEN E'\n    CYCLE' ELSE E'\n    NO CYCLE' END
+			|| ';'
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_sequence s  ON s.seqrelid = c.oid
+		WHERE c.oid = $1;
+	`,
+	model.ObjectKindFunction: `
+		SELECT pg_get_functiondef(p.oid) FROM pg_proc p WHERE p.oid = $1 AND p.prokind = 'f';
+	`,
+	model.ObjectKindProcedure: `
+		SELECT pg_get_functiondef(p.oid) FROM pg_proc p WHERE p.oid = $1 AND p.prokind = 'p';
+	`,
+	model.ObjectKindEnum: `
+		SELECT
+			'CREATE TYPE ' || format('%I.%I', n.nspname, t.typname) || ' AS ENUM ('
+			|| COALESCE(string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder), '')
+			|| ');'
+		FROM pg_type t
+		JOIN pg_namespace n  ON n.oid = t.typnamespace
+		LEFT JOIN pg_enum e  ON e.enumtypid = t.oid
+		WHERE t.oid = $1 AND t.typtype = 'e'
+		GROUP BY n.nspname, t.typname;
+	`,
+	model.ObjectKindDomain: `
+		SELECT
+			'CREATE DOMAIN ' || format('%I.%I', n.nspname, t.typname)
+			|| ' AS ' || format_type(t.typbasetype, t.typtypmod)
+			|| COALESCE((
+				SELECT ' COLLATE ' || format('%I.%I', cn.nspname, co.collname)
+				FROM pg_collation co
+				JOIN pg_namespace cn ON cn.oid = co.collnamespace
+				WHERE co.oid = t.typcollation AND t.typcollation <> bt.typcollation
+			), '')
+			|| COALESCE(' DEFAULT ' || t.typdefault, '')
+			|| CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END
+			|| COALESCE((
+				SELECT string_agg(E'\n    CONSTRAINT ' || quote_ident(con.conname) || ' ' || pg_get_constraintdef(con.oid, true), '' ORDER BY con.conname)
+				FROM pg_constraint con
+				WHERE con.contypid = t.oid AND con.contype = 'c'
+			), '')
+			|| ';'
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_type bt     ON bt.oid = t.typbasetype
+		WHERE t.oid = $1 AND t.typtype = 'd';
+	`,
+	model.ObjectKindTrigger: `
+		SELECT pg_get_triggerdef(t.oid, true) || ';' FROM pg_trigger t WHERE t.oid = $1;
+	`,
+	model.ObjectKindExtension: `
+		SELECT
+			'CREATE EXTENSION IF NOT EXISTS ' || quote_ident(e.extname)
+			|| ' WITH SCHEMA ' || quote_ident(n.nspname)
+			|| ' VERSION ' || quote_literal(e.extversion) || ';'
+		FROM pg_extension e
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE e.oid = $1;
+	`,
+}
+
+// GetDatabaseObjects lists the views, materialized views, foreign tables, sequences, functions,
+// procedures, enums, domains, triggers and extensions of a schema, or of all user schemas when
+// schema is empty. Objects which belong to an extension are skipped.
+func (c *Connections) GetDatabaseObjects(activePoolID uuid.UUID, schema string) ([]model.DatabaseObject, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	return listDatabaseObjects(context.TODO(), pool, schema)
+}
+
+func listDatabaseObjects(ctx context.Context, q querier, schema string) ([]model.DatabaseObject, error) {
+	query := `
+		SELECT o.kind, o.oid, o.schema_name, o.name, o.arguments, o.table_name, o.version, o.owner, o.comment
+		FROM (
+			SELECT
+				CASE c.relkind
+					WHEN 'v' THEN 'view'
+					WHEN 'm' THEN 'materialized_view'
+					WHEN 'f' THEN 'foreign_table'
+					ELSE 'sequence'
+				END AS kind,
+				c.oid,
+				n.nspname::text AS schema_name,
+				c.relname::text AS name,
+				'' AS arguments,
+				'' AS table_name,
+				'' AS version,
+				pg_get_userbyid(c.relowner)::text AS owner,
+				COALESCE(obj_description(c.oid, 'pg_class'), '') AS comment
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.relkind IN ('v', 'm', 'f', 'S')
+			  -- identity sequences are managed through their column
+			  AND NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('e', 'i')
+			  )
+
+			UNION ALL
+
+			SELECT
+				CASE p.prokind WHEN 'p' THEN 'procedure' ELSE 'function' END,
+				p.oid,
+				n.nspname::text,
+				p.proname::text,
+				pg_get_function_identity_arguments(p.oid),
+				'',
+				'',
+				pg_get_userbyid(p.proowner)::text,
+				COALESCE(obj_description(p.oid, 'pg_proc'), '')
+			FROM pg_proc p
+			JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE p.prokind IN ('f', 'p')
+			  AND NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e'
+			  )
+
+			UNION ALL
+
+			SELECT
+				CASE t.typtype WHEN 'e' THEN 'enum' ELSE 'domain' END,
+				t.oid,
+				n.nspname::text,
+				t.typname::text,
+				'',
+				'',
+				'',
+				pg_get_userbyid(t.typowner)::text,
+				COALESCE(obj_description(t.oid, 'pg_type'), '')
+			FROM pg_type t
+			JOIN pg_namespace n ON n.oid = t.typnamespace
+			WHERE t.typtype IN ('e', 'd')
+			  AND NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e'
+			  )
+
+			UNION ALL
+
+			SELECT
+				'trigger',
+				tg.oid,
+				n.nspname::text,
+				tg.tgname::text,
+				'',
+				c.relname::text,
+				'',
+				pg_get_userbyid(c.relowner)::text,
+				COALESCE(obj_description(tg.oid, 'pg_trigger'), '')
+			FROM pg_trigger tg
+			JOIN pg_class c     ON c.oid = tg.tgrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE NOT tg.tgisinternal
+			  -- triggers cloned onto partitions come with the trigger of the parent
+			  AND NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_trigger'::regclass AND d.objid = tg.oid AND d.deptype IN ('P', 'S')
+			  )
+
+			UNION ALL
+
+			SELECT
+				'extension',
+				e.oid,
+				n.nspname::text,
+				e.extname::text,
+				'',
+				'',
+				e.extversion,
+				pg_get_userbyid(e.extowner)::text,
+				COALESCE(obj_description(e.oid, 'pg_extension'), '')
+			FROM pg_extension e
+			JOIN pg_namespace n ON n.oid = e.extnamespace
+		) o
+		-- extensions like plpgsql live in pg_catalog
+		WHERE (o.kind = 'extension' OR (o.schema_name !~ '^pg_' AND o.schema_name <> 'information_schema'))
+		  AND ($1::text = '' OR o.schema_name = $1::text)
+		ORDER BY o.schema_name, o.kind, o.name, o.arguments;
+	`
+	rows, err := q.Query(ctx, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []model.DatabaseObject
+
+	for rows.Next() {
+		var object model.DatabaseObject
+		err := rows.Scan(&object.Kind, &object.OID, &object.Schema, &object.Name, &object.Arguments, &object.TableName, &object.Version, &object.Owner, &object.Comment)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// GetObjectDefinition returns the SQL definition of an object listed by GetDatabaseObjects
+func (c *Connections) GetObjectDefinition(activePoolID uuid.UUID, kind string, oid uint32) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	return objectDefinition(context.TODO(), pool, kind, oid)
+}
+
+func objectDefinition(ctx context.Context, q querier, kind string, oid uint32) (string, error) {
+	query, ok := objectDefinitionQueries[kind]
+	if !ok {
+		return "", fmt.Errorf("invalid object kind %s", kind)
+	}
+
+	var definition string
+	err := q.QueryRow(ctx, query, oid).Scan(&definition)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%s with oid %d does not exist", kind, oid)
+		}
+		return "", err
+	}
+
+	return definition, nil
+}
@@ -14,12 +14,21 @@ type PoolManager struct {
 	mu          sync.RWMutex
 	Pools       map[uuid.UUID]*pgxpool.Pool
 	ActiveConns map[int64]int64
+	// Connection and database of each pool
+	PoolInfos map[uuid.UUID]PoolInfo
+}
+
+// PoolInfo identifies the saved connection and database a pool is connected to
+type PoolInfo struct {
+	ConnectionID int64
+	DBName       string
 }
 
 func NewPoolManager() *PoolManager {
 	return &PoolManager{
 		Pools:       make(map[uuid.UUID]*pgxpool.Pool),
 		ActiveConns: make(map[int64]int64),
+		PoolInfos:   make(map[uuid.UUID]PoolInfo),
 	}
 }
 
@@ -39,6 +48,7 @@ func (pm *PoolManager) AddPool(id uuid.UUID, c *pgx.ConnConfig, connID int64) (*
 	}
 
 	pm.Pools[id] = pool
+	pm.PoolInfos[id] = PoolInfo{ConnectionID: connID, DBName: c.Database}
 
 	// Add the connection ID to the map
 	// This is used to track the count of the number of active pools for a connection
@@ -54,6 +64,13 @@ func (pm *PoolManager) GetPool(id uuid.UUID) (*pgxpool.Pool, bool) {
 	return pool, exists
 }
 
+func (pm *PoolManager) GetPoolInfo(id uuid.UUID) (PoolInfo, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	info, exists := pm.PoolInfos[id]
+	return info, exists
+}
+
 func (pm *PoolManager) DeletePool(id uuid.UUID, connID int64) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -73,6 +90,7 @@ func (pm *PoolManager) DeletePool(id uuid.UUID, connID int64) error {
 
 	// Remove the pool from the pools map
 	delete(pm.Pools, id)
+	delete(pm.PoolInfos, id)
 
 	// Get the number of active pools for the connection
 	activeConns := pm.ActiveConns[connID]
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// querier is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Schema of tables created before schemas were tracked
+const defaultSchema = "public"
+
+// schemaOrDefault returns the public schema for an empty schema name
+func schemaOrDefault(schema string) string {
+	if schema == "" {
+		return defaultSchema
+	}
+	return schema
+}
+
+// qualifiedTableName returns the quoted schema qualified name of a table
+func qualifiedTableName(schema, tableName string) string {
+	return pgx.Identifier{schemaOrDefault(schema), tableName}.Sanitize()
+}
+
+// Get the columns of a table in ordinal order
+func getTableColumns(ctx context.Context, q querier, schema, tableName string) ([]model.ColumnInfo, error) {
+	query := `
+		SELECT
+			column_name,
+			CASE
+				WHEN character_maximum_length IS NOT NULL
+					THEN data_type || '(' || character_maximum_length || ')'
+				ELSE data_type
+			END AS data_type,
+			udt_name,
+			is_nullable = 'YES' AS is_nullable,
+			COALESCE(column_default, '') AS column_default,
+			ordinal_position,
+			is_generated = 'ALWAYS' AS is_generated
+		FROM information_schema.columns
+		WHERE table_name = $1
+		  AND table_schema = $2
+		ORDER BY ordinal_position;
+	`
+	rows, err := q.Query(ctx, query, tableName, schemaOrDefault(schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []model.ColumnInfo
+	for rows.Next() {
+		var column model.ColumnInfo
+		err := rows.Scan(&column.Name, &column.DataType, &column.UDTName, &column.IsNullable, &column.Default, &column.Position, &column.IsGenerated)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// Get the primary key columns of a table in key order
+func getPrimaryKeyColumns(ctx context.Context, q querier, schema, tableName string) ([]string, error) {
+	query := `
+		SELECT a.attname
+		FROM pg_index idx
+		JOIN pg_class t     ON t.oid = idx.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(idx.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE idx.indisprimary
+		  AND t.relname = $1
+		  AND n.nspname = $2
+		ORDER BY k.ord;
+	`
+	rows, err := q.Query(ctx, query, tableName, schemaOrDefault(schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Layouts accepted for date and timestamp values, tried in order
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// coerceValue converts the text representation of a value into the go type pgx encodes for the
+// given postgres udt name (int4, timestamptz, _text...). Types without a dedicated conversion are
+// passed through as text and parsed by postgres itself.
+func coerceValue(udtName string, raw string) (any, error) {
+	value := strings.TrimSpace(raw)
+
+	switch udtName {
+	case "int2", "int4", "int8", "oid":
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid integer", raw)
+		}
+		return v, nil
+	case "float4", "float8":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid number", raw)
+		}
+		return v, nil
+	case "numeric":
+		var v pgtype.Numeric
+		if err := v.Scan(value); err != nil {
+			return nil, fmt.Errorf("%q is not a valid numeric", raw)
+		}
+		return v, nil
+	case "bool":
+		switch strings.ToLower(value) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a valid boolean", raw)
+	case "date", "timestamp", "timestamptz":
+		for _, layout := range timeLayouts {
+			if v, err := time.Parse(layout, value); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a valid %s", raw, udtName)
+	case "uuid":
+		v, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid uuid", raw)
+		}
+		return v.String(), nil
+	case "json", "jsonb":
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("%q is not valid json", raw)
+		}
+		return value, nil
+	}
+
+	return raw, nil
+}
+
+// formatCellValue formats a value returned by pgx for display in a result grid
+func formatCellValue(value any) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case nil:
+		return "NULL"
+	case [16]uint8:
+		return uuid.UUID(v).String()
+	case string:
+		if v == "" {
+			return "EMPTY"
+		}
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"dbmx/model"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Friendly parameter type names and the postgres udt names they are coerced as
+var paramTypeUDTNames = map[string]string{
+	"int":      "int8",
+	"integer":  "int8",
+	"bigint":   "int8",
+	"smallint": "int8",
+	"float":    "float8",
+	"double":   "float8",
+	"real":     "float8",
+	"decimal":  "numeric",
+	"boolean":  "bool",
+	"string":   "text",
+	"varchar":  "text",
+}
+
+// Query parameters found in a query
+type queryParams struct {
+	// Highest $n referenced in the query
+	maxPosition int
+	// Named parameters in order of first appearance, they are numbered after the positional ones
+	names []string
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || (ch >= '0' && ch <= '9') || ch == '$'
+}
+
+// rewriteNamedParams replaces :name parameters with $n placeholders numbered after the highest
+// positional parameter. String literals, quoted identifiers, comments, dollar quoted bodies and
+// :: casts are left untouched.
+func rewriteNamedParams(query string) (string, queryParams) {
+	var params queryParams
+	var out strings.Builder
+	numbers := make(map[string]int)
+
+	// First pass finds the highest positional parameter, second pass rewrites the named ones
+	for pass := 0; pass < 2; pass++ {
+		out.Reset()
+		n := len(query)
+		i := 0
+		for i < n {
+			ch := query[i]
+			switch {
+			// Line comment
+			case ch == '-' && i+1 < n && query[i+1] == '-':
+				end := strings.IndexByte(query[i:], '\n')
+				if end == -1 {
+					end = n - i
+				}
+				out.WriteString(query[i : i+end])
+				i += end
+
+			// Block comment, these nest in postgres
+			case ch == '/' && i+1 < n && query[i+1] == '*':
+				start := i
+				depth := 0
+				for i < n {
+					if i+1 < n && query[i] == '/' && query[i+1] == '*' {
+						depth++
+						i += 2
+					} else if i+1 < n && query[i] == '*' && query[i+1] == '/' {
+						depth--
+						i += 2
+						if depth == 0 {
+							break
+						}
+					} else {
+						i++
+					}
+				}
+				out.WriteString(query[start:i])
+
+			// String literal or quoted identifier
+			case ch == '\'' || ch == '"':
+				start := i
+				// E'' strings allow backslash escapes
+				escapes := ch == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i < 2 || !isIdentChar(query[i-2]))
+				i++
+				for i < n {
+					if escapes && query[i] == '\\' {
+						i += 2
+						continue
+					}
+					if query[i] == ch {
+						// A doubled quote is an escaped quote
+						if i+1 < n && query[i+1] == ch {
+							i += 2
+							continue
+						}
+						i++
+						break
+					}
+					i++
+				}
+				if i > n {
+					i = n
+				}
+				out.WriteString(query[start:i])
+
+			// Positional parameter or dollar quoted string
+			case ch == '$' && (i == 0 || !isIdentChar(query[i-1])):
+				j := i + 1
+				for j < n && query[j] >= '0' && query[j] <= '9' {
+					j++
+				}
+				if j > i+1 {
+					position, _ := strconv.Atoi(query[i+1 : j])
+					if position > params.maxPosition {
+						params.maxPosition = position
+					}
+					out.WriteString(query[i:j])
+					i = j
+					continue
+				}
+
+				// $tag$ ... $tag$
+				j = i + 1
+				for j < n && isIdentChar(query[j]) && query[j] != '$' {
+					j++
+				}
+				if j < n && query[j] == '$' {
+					tag := query[i : j+1]
+					end := strings.Index(query[j+1:], tag)
+					if end == -1 {
+						end = n - j - 1
+					} else {
+						end += len(tag)
+					}
+					out.WriteString(query[i : j+1+end])
+					i = j + 1 + end
+					continue
+				}
+				out.WriteByte(ch)
+				i++
+
+			// Cast
+			case ch == ':' && i+1 < n && query[i+1] == ':':
+				out.WriteString("::")
+				i += 2
+
+			// Named parameter
+			case ch == ':' && i+1 < n && isIdentStart(query[i+1]) && (i == 0 || !isIdentChar(query[i-1])):
+				j := i + 1
+				for j < n && isIdentChar(query[j]) && query[j] != '$' {
+					j++
+				}
+				name := query[i+1 : j]
+				if pass == 1 {
+					number, ok := numbers[name]
+					if !ok {
+						params.names = append(params.names, name)
+						number = params.maxPosition + len(params.names)
+						numbers[name] = number
+					}
+					out.WriteString("$" + strconv.Itoa(number))
+				} else {
+					out.WriteString(query[i:j])
+				}
+				i = j
+
+			default:
+				out.WriteByte(ch)
+				i++
+			}
+		}
+	}
+
+	return out.String(), params
+}
+
+// bindQueryParams rewrites the named parameters of the query and returns the coerced argument for
+// every placeholder. Every parameter referenced in the query must have a value.
+func bindQueryParams(query string, params map[string]model.QueryParam) (string, []any, error) {
+	rewritten, found := rewriteNamedParams(query)
+
+	keys := make([]string, 0, found.maxPosition+len(found.names))
+	for i := 1; i <= found.maxPosition; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	keys = append(keys, found.names...)
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		param, ok := params[key]
+		if !ok {
+			if i < found.maxPosition {
+				return "", nil, fmt.Errorf("no value for parameter $%s", key)
+			}
+			return "", nil, fmt.Errorf("no value for parameter :%s", key)
+		}
+		if param.IsNull {
+			continue
+		}
+
+		paramType := strings.ToLower(strings.TrimSpace(param.Type))
+		if udtName, ok := paramTypeUDTNames[paramType]; ok {
+			paramType = udtName
+		}
+		value, err := coerceValue(paramType, param.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter %s: %w", key, err)
+		}
+		args[i] = value
+	}
+
+	return rewritten, args, nil
+}
@@ -0,0 +1,635 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// Privileges which can be granted on each type of object, ALL grants every one of them
+var objectPrivileges = map[string][]string{
+	model.PrivilegeObjectTable:    {"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"},
+	model.PrivilegeObjectColumn:   {"SELECT", "INSERT", "UPDATE", "REFERENCES"},
+	model.PrivilegeObjectSequence: {"USAGE", "SELECT", "UPDATE"},
+	model.PrivilegeObjectSchema:   {"USAGE", "CREATE"},
+	model.PrivilegeObjectFunction: {"EXECUTE"},
+	model.PrivilegeObjectDatabase: {"CONNECT", "CREATE", "TEMPORARY"},
+}
+
+// ListRoles returns the roles of the server with their attributes and memberships
+func (c *Connections) ListRoles(activePoolID uuid.UUID) ([]model.Role, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	// A password valid until infinity never expires like one without VALID UNTIL, and
+	// -infinity has always expired. Neither fits in a time.Time.
+	query := `
+		SELECT
+			rolname::text, rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin,
+			rolreplication, rolbypassrls, rolconnlimit,
+			CASE
+				WHEN rolvaliduntil = '-infinity' THEN '0001-01-01 00:00:00+00'::timestamptz
+				ELSE NULLIF(rolvaliduntil, 'infinity')
+			END,
+			rolname LIKE 'pg\_%'
+		FROM pg_roles
+		ORDER BY rolname LIKE 'pg\_%', rolname;
+	`
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []model.Role{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var r model.Role
+		err := rows.Scan(&r.Name, &r.Superuser, &r.Inherit, &r.CreateRole, &r.CreateDB, &r.CanLogin,
+			&r.Replication, &r.BypassRLS, &r.ConnectionLimit, &r.ValidUntil, &r.System)
+		if err != nil {
+			return nil, err
+		}
+		r.MemberOf, r.Members = []model.RoleMembership{}, []model.RoleMembership{}
+		index[r.Name] = len(roles)
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT g.rolname::text, m.rolname::text, COALESCE(gr.rolname::text, ''), am.admin_option
+		FROM pg_auth_members am
+		JOIN pg_roles g       ON g.oid = am.roleid
+		JOIN pg_roles m       ON m.oid = am.member
+		LEFT JOIN pg_roles gr ON gr.oid = am.grantor
+		ORDER BY g.rolname, m.rolname;
+	`
+	rows, err = pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.RoleMembership
+		if err := rows.Scan(&m.Role, &m.Member, &m.Grantor, &m.AdminOption); err != nil {
+			return nil, err
+		}
+		if i, ok := index[m.Member]; ok {
+			roles[i].MemberOf = append(roles[i].MemberOf, m)
+		}
+		if i, ok := index[m.Role]; ok {
+			roles[i].Members = append(roles[i].Members, m)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// Select list checking each privilege of a role with a has_*_privilege function. The role is
+// always $1, object is the SQL of the object argument(s).
+func privilegeChecks(function, object string, privileges []string) string {
+	checks := make([]string, len(privileges))
+	for i, privilege := range privileges {
+		checks[i] = fmt.Sprintf("%s($1::name, %s, '%s')", function, object, privilege)
+	}
+	return strings.Join(checks, ", ")
+}
+
+// Query objects with their privilege checks. Every row starts with the schema, name and detail
+// of the object followed by the checks of privileges.
+func queryObjectPrivileges(ctx context.Context, q querier, objectType string, privileges []string, query string, args ...any) ([]model.ObjectPrivileges, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []model.ObjectPrivileges{}
+	for rows.Next() {
+		object := model.ObjectPrivileges{ObjectType: objectType, Privileges: make(map[string]bool, len(privileges))}
+		has := make([]bool, len(privileges))
+		dest := []any{&object.Schema, &object.Name, &object.Detail}
+		for i := range has {
+			dest = append(dest, &has[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, privilege := range privileges {
+			object.Privileges[privilege] = has[i]
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+// GetRolePrivileges returns the effective privileges of a role on the database, a schema and the
+// tables, views, sequences and functions of the schema
+func (c *Connections) GetRolePrivileges(activePoolID uuid.UUID, role, schema string) (*model.RolePrivileges, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	schema = schemaOrDefault(schema)
+	result := &model.RolePrivileges{Role: role}
+
+	privileges := objectPrivileges[model.PrivilegeObjectDatabase]
+	query := fmt.Sprintf(`SELECT '', current_database()::text, '', %s`, privilegeChecks("has_database_privilege", "current_database()", privileges))
+	databases, err := queryObjectPrivileges(ctx, pool, model.PrivilegeObjectDatabase, privileges, query, role)
+	if err != nil {
+		return nil, err
+	}
+	result.Database = databases[0]
+
+	privileges = objectPrivileges[model.PrivilegeObjectSchema]
+	query = fmt.Sprintf(`SELECT '', nspname::text, '', %s FROM pg_namespace WHERE nspname = $2`, privilegeChecks("has_schema_privilege", "oid", privileges))
+	schemas, err := queryObjectPrivileges(ctx, pool, model.PrivilegeObjectSchema, privileges, query, role, schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return nil, fmt.Errorf("schema %s does not exist", schema)
+	}
+	result.Schema = schemas[0]
+
+	privileges = objectPrivileges[model.PrivilegeObjectTable]
+	query = fmt.Sprintf(`
+		SELECT n.nspname::text, c.relname::text, '', %s
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $2 AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		ORDER BY c.relname
+	`, privilegeChecks("has_table_privilege", "c.oid", privileges))
+	result.Tables, err = queryObjectPrivileges(ctx, pool, model.PrivilegeObjectTable, privileges, query, role, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	privileges = objectPrivileges[model.PrivilegeObjectSequence]
+	query = fmt.Sprintf(`
+		SELECT n.nspname::text, c.relname::text, '', %s
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $2 AND c.relkind = 'S'
+		ORDER BY c.relname
+	`, privilegeChecks("has_sequence_privilege", "c.oid", privileges))
+	result.Sequences, err = queryObjectPrivileges(ctx, pool, model.PrivilegeObjectSequence, privileges, query, role, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	privileges = objectPrivileges[model.PrivilegeObjectFunction]
+	query = fmt.Sprintf(`
+		SELECT n.nspname::text, p.proname::text, pg_get_function_identity_arguments(p.oid), %s
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $2 AND p.prokind IN ('f', 'p')
+		ORDER BY p.proname, p.oid
+	`, privilegeChecks("has_function_privilege", "p.oid", privileges))
+	result.Functions, err = queryObjectPrivileges(ctx, pool, model.PrivilegeObjectFunction, privileges, query, role, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetColumnPrivileges returns the effective privileges of a role on each column of a table
+func (c *Connections) GetColumnPrivileges(activePoolID uuid.UUID, role, schema, tableName string) ([]model.ObjectPrivileges, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	privileges := objectPrivileges[model.PrivilegeObjectColumn]
+	query := fmt.Sprintf(`
+		SELECT n.nspname::text, c.relname::text, a.attname::text, %s
+		FROM pg_attribute a
+		JOIN pg_class c     ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $2 AND c.relname = $3 AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, privilegeChecks("has_column_privilege", "c.oid, a.attnum", privileges))
+	return queryObjectPrivileges(context.Background(), pool, model.PrivilegeObjectColumn, privileges, query, role, schemaOrDefault(schema), tableName)
+}
+
+// Quote a grantee, PUBLIC is a keyword
+func quoteGrantee(grantee string) string {
+	if strings.EqualFold(grantee, "public") {
+		return "PUBLIC"
+	}
+	return quoteIdent(grantee)
+}
+
+// Render the GRANT or REVOKE statement of a privilege change. Functions are looked up to render
+// their signature.
+func privilegeChangeSQL(ctx context.Context, q querier, change model.PrivilegeChange) (string, error) {
+	if len(change.Grantees) == 0 {
+		return "", errors.New("privileges have to be granted to at least one role")
+	}
+	grantees := make([]string, len(change.Grantees))
+	for i, grantee := range change.Grantees {
+		grantees[i] = quoteGrantee(grantee)
+	}
+
+	var b strings.Builder
+	if change.ObjectType == model.PrivilegeObjectRole {
+		if change.Name == "" {
+			return "", errors.New("the role to grant is required")
+		}
+		if change.Revoke {
+			b.WriteString("REVOKE ")
+			if change.WithGrantOption {
+				b.WriteString("ADMIN OPTION FOR ")
+			}
+			b.WriteString(quoteIdent(change.Name) + " FROM " + strings.Join(grantees, ", "))
+			if change.Cascade {
+				b.WriteString(" CASCADE")
+			}
+		} else {
+			b.WriteString("GRANT " + quoteIdent(change.Name) + " TO " + strings.Join(grantees, ", "))
+			if change.WithGrantOption {
+				b.WriteString(" WITH ADMIN OPTION")
+			}
+		}
+		return b.String() + ";", nil
+	}
+
+	objectType := change.ObjectType
+	if objectType == model.PrivilegeObjectColumn || (objectType == model.PrivilegeObjectTable && len(change.Columns) > 0) {
+		objectType = model.PrivilegeObjectColumn
+		if len(change.Columns) == 0 {
+			return "", errors.New("column privileges require columns")
+		}
+		if change.AllInSchema {
+			return "", errors.New("column privileges can't be granted on every table of a schema")
+		}
+	}
+	allowed, ok := objectPrivileges[objectType]
+	if !ok {
+		return "", fmt.Errorf("invalid object type %q. Only table, column, sequence, schema, function, database and role are allowed", change.ObjectType)
+	}
+
+	if len(change.Privileges) == 0 {
+		return "", errors.New("no privileges to grant")
+	}
+	var privileges []string
+	for _, privilege := range change.Privileges {
+		privilege = strings.ToUpper(strings.TrimSpace(privilege))
+		switch {
+		case privilege == "ALL" || privilege == "ALL PRIVILEGES":
+			privilege = "ALL PRIVILEGES"
+		case privilege == "TEMP":
+			privilege = "TEMPORARY"
+		case !slices.Contains(allowed, privilege):
+			return "", fmt.Errorf("privilege %s can't be granted on a %s. Only %s are allowed", privilege, objectType, strings.Join(allowed, ", "))
+		}
+		if objectType == model.PrivilegeObjectColumn {
+			privilege += " (" + quoteColumns(change.Columns) + ")"
+		}
+		privileges = append(privileges, privilege)
+	}
+
+	var object string
+	schema := schemaOrDefault(change.Schema)
+	switch objectType {
+	case model.PrivilegeObjectTable, model.PrivilegeObjectColumn, model.PrivilegeObjectSequence:
+		keyword, all := "TABLE", "ALL TABLES"
+		if objectType == model.PrivilegeObjectSequence {
+			keyword, all = "SEQUENCE", "ALL SEQUENCES"
+		}
+		object = keyword + " " + quoteQualified(schema, change.Name)
+		if change.AllInSchema {
+			object = all + " IN SCHEMA " + quoteIdent(schema)
+		} else if change.Name == "" {
+			return "", fmt.Errorf("the name of the %s is required", objectType)
+		}
+	case model.PrivilegeObjectFunction:
+		if change.AllInSchema {
+			object = "ALL FUNCTIONS IN SCHEMA " + quoteIdent(schema)
+			break
+		}
+		var signature *string
+		query := `
+			SELECT format('%I.%I(%s)', n.nspname, p.proname, pg_get_function_identity_arguments(p.oid))
+			FROM pg_proc p
+			JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE p.oid = to_regprocedure($1)
+		`
+		name := quoteQualified(schema, change.Name) + "(" + change.Arguments + ")"
+		err := q.QueryRow(ctx, query, name).Scan(&signature)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return "", err
+		}
+		if signature == nil {
+			return "", fmt.Errorf("function %s does not exist", name)
+		}
+		object = "FUNCTION " + *signature
+	case model.PrivilegeObjectSchema:
+		name := change.Name
+		if name == "" {
+			name = schema
+		}
+		object = "SCHEMA " + quoteIdent(name)
+	case model.PrivilegeObjectDatabase:
+		if change.Name == "" {
+			return "", errors.New("the name of the database is required")
+		}
+		object = "DATABASE " + quoteIdent(change.Name)
+	}
+
+	if change.Revoke {
+		b.WriteString("REVOKE ")
+		if change.WithGrantOption {
+			b.WriteString("GRANT OPTION FOR ")
+		}
+		b.WriteString(strings.Join(privileges, ", ") + " ON " + object + " FROM " + strings.Join(grantees, ", "))
+		if change.Cascade {
+			b.WriteString(" CASCADE")
+		}
+	} else {
+		b.WriteString("GRANT " + strings.Join(privileges, ", ") + " ON " + object + " TO " + strings.Join(grantees, ", "))
+		if change.WithGrantOption {
+			b.WriteString(" WITH GRANT OPTION")
+		}
+	}
+
+	return b.String() + ";", nil
+}
+
+func privilegeChangesSQL(ctx context.Context, q querier, changes []model.PrivilegeChange) ([]string, error) {
+	if len(changes) == 0 {
+		return nil, errors.New("there are no privilege changes")
+	}
+	statements := make([]string, len(changes))
+	for i, change := range changes {
+		statement, err := privilegeChangeSQL(ctx, q, change)
+		if err != nil {
+			return nil, errors.Wrapf(err, "change %d", i+1)
+		}
+		statements[i] = statement
+	}
+	return statements, nil
+}
+
+// PreviewPrivilegeChanges renders the GRANT and REVOKE statements of privilege changes
+func (c *Connections) PreviewPrivilegeChanges(activePoolID uuid.UUID, changes []model.PrivilegeChange) (string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	statements, err := privilegeChangesSQL(context.Background(), pool, changes)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(statements, "\n"), nil
+}
+
+// ApplyPrivilegeChanges runs the statements of privilege changes in one transaction. They have
+// to render to the reviewed SQL. On production the database name has to be passed as
+// confirmation.
+func (c *Connections) ApplyPrivilegeChanges(activePoolID uuid.UUID, changes []model.PrivilegeChange, reviewedSQL, confirmation string) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+	info, _ := c.PM.GetPoolInfo(activePoolID)
+	if err := c.checkEnvSafety(activePoolID, "changing privileges", info.DBName, confirmation); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	statements, err := privilegeChangesSQL(ctx, tx, changes)
+	if err != nil {
+		return err
+	}
+	if strings.Join(statements, "\n") != reviewedSQL {
+		return errors.New("the privilege changes differ from the reviewed SQL, review them again")
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return errors.Wrapf(err, "failed to run %s", statement)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Roles a privilege on a table or sequence is granted to, with how the role gets it through each
+// of them. Without an ACL the owner has the default privileges of the relation kind.
+func tableGrantSources(ctx context.Context, q querier, role string, oid uint32, privilege string) ([]string, error) {
+	query := `
+		SELECT
+			CASE WHEN x.grantee = 0 THEN 'PUBLIC' ELSE pg_get_userbyid(x.grantee)::text END,
+			-- pg_has_role fails on the PUBLIC pseudo role 0
+			CASE WHEN x.grantee = 0 THEN true ELSE pg_has_role($1::name, x.grantee, 'USAGE') END,
+			CASE WHEN x.grantee = 0 THEN false ELSE pg_has_role($1::name, x.grantee, 'MEMBER') END
+		FROM pg_class c, aclexplode(COALESCE(c.relacl, acldefault(CASE WHEN c.relkind = 'S' THEN 's' ELSE 'r' END::"char", c.relowner))) x
+		WHERE c.oid = $2 AND x.privilege_type = $3
+		ORDER BY 1;
+	`
+	rows, err := q.Query(ctx, query, role, oid, privilege)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []string
+	for rows.Next() {
+		var grantee string
+		var inherits, member bool
+		if err := rows.Scan(&grantee, &inherits, &member); err != nil {
+			return nil, err
+		}
+		switch {
+		case grantee == "PUBLIC":
+			sources = append(sources, "granted to PUBLIC")
+		case grantee == role:
+			sources = append(sources, "granted to the role directly")
+		case inherits:
+			sources = append(sources, fmt.Sprintf("inherited from role %s", grantee))
+		case member:
+			sources = append(sources, fmt.Sprintf("granted to role %s, the role is a member but doesn't inherit its privileges, it needs SET ROLE %s", grantee, quoteIdent(grantee)))
+		}
+	}
+
+	return sources, rows.Err()
+}
+
+// ExplainTableAccess explains whether a role can use a privilege on a table, view or sequence,
+// checking login, database and schema access, table and column privileges and row level security
+func (c *Connections) ExplainTableAccess(activePoolID uuid.UUID, role, schema, tableName, privilege string) (*model.AccessExplanation, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	schema = schemaOrDefault(schema)
+	privilege = strings.ToUpper(strings.TrimSpace(privilege))
+	if privilege == "" {
+		privilege = "SELECT"
+	}
+	if !slices.Contains(objectPrivileges[model.PrivilegeObjectTable], privilege) {
+		return nil, fmt.Errorf("invalid table privilege %s. Only %s are allowed", privilege, strings.Join(objectPrivileges[model.PrivilegeObjectTable], ", "))
+	}
+
+	explanation := &model.AccessExplanation{Role: role, Schema: schema, Table: tableName, Privilege: privilege, Checks: []model.AccessCheck{}}
+	table := quoteQualified(schema, tableName)
+	var fixes []string
+	check := func(name string, ok bool, detail, fix string) {
+		explanation.Checks = append(explanation.Checks, model.AccessCheck{Check: name, OK: ok, Detail: detail})
+		if !ok && fix != "" {
+			fixes = append(fixes, fix)
+		}
+	}
+
+	var superuser, canLogin, bypassRLS bool
+	err := pool.QueryRow(ctx, `SELECT rolsuper, rolcanlogin, rolbypassrls FROM pg_roles WHERE rolname = $1`, role).Scan(&superuser, &canLogin, &bypassRLS)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("role %s does not exist", role)
+		}
+		return nil, err
+	}
+
+	var oid uint32
+	var owner string
+	var rowSecurity, forceRowSecurity bool
+	query := `
+		SELECT c.oid, pg_get_userbyid(c.relowner)::text, c.relrowsecurity, c.relforcerowsecurity
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p', 'v', 'm', 'f', 'S')
+	`
+	err = pool.QueryRow(ctx, query, schema, tableName).Scan(&oid, &owner, &rowSecurity, &forceRowSecurity)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("table %s does not exist", table)
+		}
+		return nil, err
+	}
+
+	if canLogin {
+		check("login", true, "the role can log in", "")
+	} else {
+		check("login", false, "the role can't log in, it can only be used through SET ROLE by its members", "ALTER ROLE "+quoteIdent(role)+" LOGIN;")
+	}
+
+	if superuser {
+		check("superuser", true, "the role is a superuser, privilege checks don't apply", "")
+		explanation.Allowed = canLogin
+		explanation.FixSQL = strings.Join(fixes, "\n")
+		return explanation, nil
+	}
+
+	var connect, usage, hasPrivilege, anyColumn, owns bool
+	query = `
+		SELECT
+			has_database_privilege($1::name, current_database(), 'CONNECT'),
+			has_schema_privilege($1::name, $2::text, 'USAGE'),
+			has_table_privilege($1::name, $3::oid, $4),
+			$4::text IN ('SELECT', 'INSERT', 'UPDATE', 'REFERENCES') AND has_any_column_privilege($1::name, $3::oid, $4),
+			pg_has_role($1::name, $5::name, 'USAGE')
+	`
+	err = pool.QueryRow(ctx, query, role, schema, oid, privilege, owner).Scan(&connect, &usage, &hasPrivilege, &anyColumn, &owns)
+	if err != nil {
+		return nil, err
+	}
+
+	var dbName string
+	if err := pool.QueryRow(ctx, `SELECT current_database()::text`).Scan(&dbName); err != nil {
+		return nil, err
+	}
+	if connect {
+		check("database", true, fmt.Sprintf("the role can connect to database %s", dbName), "")
+	} else {
+		check("database", false, fmt.Sprintf("the role lacks CONNECT on database %s", dbName), fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s;", quoteIdent(dbName), quoteIdent(role)))
+	}
+	if usage {
+		check("schema", true, fmt.Sprintf("the role has USAGE on schema %s", schema), "")
+	} else {
+		check("schema", false, fmt.Sprintf("the role lacks USAGE on schema %s, it can't reach any object in it", schema), fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s;", quoteIdent(schema), quoteIdent(role)))
+	}
+
+	sources, err := tableGrantSources(ctx, pool, role, oid, privilege)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case hasPrivilege && owns:
+		check("privilege", true, fmt.Sprintf("the role has %s on %s as its owner %s", privilege, table, owner), "")
+	case hasPrivilege:
+		check("privilege", true, fmt.Sprintf("the role has %s on %s: %s", privilege, table, strings.Join(sources, "; ")), "")
+	default:
+		detail := fmt.Sprintf("the role lacks %s on %s", privilege, table)
+		if anyColumn {
+			detail += ", it only has it on some of its columns"
+		}
+		if len(sources) > 0 {
+			detail += ": " + strings.Join(sources, "; ")
+		}
+		check("privilege", false, detail, fmt.Sprintf("GRANT %s ON TABLE %s TO %s;", privilege, table, quoteIdent(role)))
+	}
+
+	// Row level security filters the rows of everyone but the owner, unless forced, and roles
+	// bypassing it
+	if rowSecurity && !bypassRLS && (!owns || forceRowSecurity) && privilege != "TRUNCATE" && privilege != "REFERENCES" && privilege != "TRIGGER" {
+		query := `
+			SELECT p.polname::text
+			FROM pg_policy p
+			WHERE p.polrelid = $1
+			  AND p.polcmd::text IN ('*', $2)
+			  AND (p.polroles = '{0}' OR EXISTS (
+				SELECT 1 FROM unnest(p.polroles) AS r(oid) WHERE pg_has_role($3::name, r.oid, 'USAGE')
+			  ))
+			ORDER BY 1;
+		`
+		command := map[string]string{"SELECT": "r", "INSERT": "a", "UPDATE": "w", "DELETE": "d"}[privilege]
+		rows, err := pool.Query(ctx, query, oid, command, role)
+		if err != nil {
+			return nil, err
+		}
+		policies, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		if len(policies) == 0 {
+			check("row level security", false, fmt.Sprintf("row level security is enabled on %s and no policy applies to the role for %s, it sees or changes no rows", table, privilege), "")
+		} else {
+			check("row level security", true, fmt.Sprintf("row level security is enabled on %s, rows are limited by policies %s", table, strings.Join(policies, ", ")), "")
+		}
+	}
+
+	explanation.Allowed = true
+	for _, accessCheck := range explanation.Checks {
+		explanation.Allowed = explanation.Allowed && accessCheck.OK
+	}
+	explanation.FixSQL = strings.Join(fixes, "\n")
+
+	return explanation, nil
+}
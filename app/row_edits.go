@@ -0,0 +1,523 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// A table touched by row edits with its columns and key
+type editTable struct {
+	name    string
+	columns map[string]model.ColumnInfo
+	key     []rowKeyColumn
+}
+
+// Tables of a batch of row edits, looked up once per table
+type editTables struct {
+	q      querier
+	tables map[string]*editTable
+}
+
+func newEditTables(q querier) *editTables {
+	return &editTables{q: q, tables: make(map[string]*editTable)}
+}
+
+func (t *editTables) get(ctx context.Context, schema, tableName string) (*editTable, error) {
+	name := quoteQualified(schemaOrDefault(schema), tableName)
+	if table, ok := t.tables[name]; ok {
+		return table, nil
+	}
+
+	columns, err := getTableColumns(ctx, t.q, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", name)
+	}
+	key, err := getRowKeyColumns(ctx, t.q, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &editTable{name: name, columns: make(map[string]model.ColumnInfo, len(columns)), key: key}
+	for _, column := range columns {
+		table.columns[column.Name] = column
+	}
+	t.tables[name] = table
+	return table, nil
+}
+
+// Columns which can be written, in table order
+func (t *editTable) writableColumns() []string {
+	columns := slices.SortedFunc(maps.Values(t.columns), func(a, b model.ColumnInfo) int { return a.Position - b.Position })
+	var names []string
+	for _, column := range columns {
+		if !column.IsGenerated {
+			names = append(names, column.Name)
+		}
+	}
+	return names
+}
+
+// Key of a row from its text values, nil when the table has no key
+func (t *editTable) rowKey(values map[string]*string) model.RowKey {
+	if len(t.key) == 0 || values == nil {
+		return nil
+	}
+	key := make(model.RowKey, len(t.key))
+	for _, column := range t.key {
+		if value := values[column.name]; value != nil {
+			key[column.name] = *value
+		}
+	}
+	return key
+}
+
+func (t *editTable) column(name string) (model.ColumnInfo, error) {
+	column, ok := t.columns[name]
+	if !ok {
+		return column, fmt.Errorf("column %s does not exist in %s", name, t.name)
+	}
+	return column, nil
+}
+
+// A statement of a row edit, built with bind parameters and with the values inlined for review
+type editStatement struct {
+	edit    int
+	kind    string
+	table   *editTable
+	key     model.RowKey
+	sql     strings.Builder
+	preview strings.Builder
+	args    []any
+	// Columns returned as text by the statement, the row after the edit
+	returning []string
+	// Reads and locks the row before an update or delete, for the journal
+	before        *editStatement
+	beforeColumns []string
+	// Tells a deleted row from a changed one when an update or delete matches nothing
+	exists *editStatement
+}
+
+func (s *editStatement) write(text string) {
+	s.sql.WriteString(text)
+	s.preview.WriteString(text)
+}
+
+func (s *editStatement) bind(udtName string, raw *string) error {
+	if raw == nil {
+		s.write("NULL")
+		return nil
+	}
+	value, err := coerceValue(udtName, *raw)
+	if err != nil {
+		return err
+	}
+	s.args = append(s.args, value)
+	s.sql.WriteString(fmt.Sprintf("$%d", len(s.args)))
+	s.preview.WriteString(quoteLiteral(*raw))
+	return nil
+}
+
+// Return the columns as text after the statement. The clause is left out of the preview.
+func (s *editStatement) returnText(columns []string) {
+	s.returning = columns
+	s.sql.WriteString(" RETURNING " + textColumns(columns))
+}
+
+func textColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = pgx.Identifier{name}.Sanitize() + "::text"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Run a statement returning text columns and read its first row, nil when there is none
+func queryTextRow(ctx context.Context, q querier, s *editStatement, columns []string) (map[string]*string, int64, error) {
+	rows, err := q.Query(ctx, s.sql.String(), s.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	values, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([]any, error) { return row.Values() })
+	if err != nil {
+		return nil, 0, err
+	}
+	affected := rows.CommandTag().RowsAffected()
+	if len(values) == 0 {
+		return nil, affected, nil
+	}
+
+	row := make(map[string]*string, len(columns))
+	for i, name := range columns {
+		row[name] = nil
+		if text, ok := values[0][i].(string); ok {
+			row[name] = &text
+		}
+	}
+	return row, affected, nil
+}
+
+// Write the condition matching a row by its key
+func (s *editStatement) keyCondition(table *editTable, key model.RowKey) error {
+	if len(table.key) == 0 {
+		return fmt.Errorf("%s has no primary key or unique key on NOT NULL columns, its rows can't be edited", table.name)
+	}
+	for i, column := range table.key {
+		raw, ok := key[column.name]
+		if !ok {
+			return fmt.Errorf("the key of the row lacks column %s of %s", column.name, table.name)
+		}
+		if i > 0 {
+			s.write(" AND ")
+		}
+		s.write(pgx.Identifier{column.name}.Sanitize() + " = ")
+		if err := s.bind(column.udtName, &raw); err != nil {
+			return fmt.Errorf("key column %s: %w", column.name, err)
+		}
+	}
+	return nil
+}
+
+// Types without an equality operator, or whose equality doesn't tell values apart, e.g. boxes of
+// the same area are equal. Their original values are compared as text.
+var textComparedTypes = map[string]bool{
+	"json":    true,
+	"xml":     true,
+	"point":   true,
+	"line":    true,
+	"lseg":    true,
+	"box":     true,
+	"path":    true,
+	"polygon": true,
+	"circle":  true,
+}
+
+// Rows edited earlier in a batch with the columns written. Their xmin and the values of those
+// columns change within the batch, so they don't guard later edits of the row.
+type editedRows map[string]map[string]bool
+
+func (r editedRows) columns(table *editTable, key model.RowKey) map[string]bool {
+	values := make([]string, len(table.key))
+	for i, column := range table.key {
+		values[i] = key[column.name]
+	}
+	row := table.name + "\x00" + strings.Join(values, "\x00")
+	if r[row] == nil {
+		r[row] = make(map[string]bool)
+	}
+	return r[row]
+}
+
+// Write the conditions which make an update or delete conflict when the row changed since it was
+// read. written holds the columns edited earlier in the batch, nil when the row wasn't edited yet.
+func (s *editStatement) guardConditions(table *editTable, edit model.RowEdit, written map[string]bool) error {
+	if edit.XMin != "" && len(written) == 0 {
+		s.write(" AND xmin::text = ")
+		if err := s.bind("text", &edit.XMin); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(edit.Original)) {
+		column, err := table.column(name)
+		if err != nil {
+			return err
+		}
+		if written[name] {
+			continue
+		}
+		identifier := pgx.Identifier{name}.Sanitize()
+		switch {
+		// json has no equality operator, both are compared as jsonb
+		case column.UDTName == "json" || column.UDTName == "jsonb":
+			s.write(" AND " + identifier + "::jsonb IS NOT DISTINCT FROM ")
+			if err := s.bind(column.UDTName, edit.Original[name]); err != nil {
+				return fmt.Errorf("original value of %s: %w", name, err)
+			}
+			s.write("::jsonb")
+		case textComparedTypes[strings.TrimPrefix(column.UDTName, "_")]:
+			s.write(" AND " + identifier + "::text IS NOT DISTINCT FROM ")
+			if err := s.bind("text", edit.Original[name]); err != nil {
+				return fmt.Errorf("original value of %s: %w", name, err)
+			}
+		default:
+			s.write(" AND " + identifier + " IS NOT DISTINCT FROM ")
+			if err := s.bind(column.UDTName, edit.Original[name]); err != nil {
+				return fmt.Errorf("original value of %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func buildRowEdit(ctx context.Context, tables *editTables, edited editedRows, index int, edit model.RowEdit) (*editStatement, error) {
+	table, err := tables.get(ctx, edit.Schema, edit.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &editStatement{edit: index, kind: edit.Kind, table: table, key: edit.Key}
+	columns := slices.Sorted(maps.Keys(edit.Values))
+
+	switch edit.Kind {
+	case model.RowEditInsert:
+		s.write("INSERT INTO " + table.name)
+		if len(columns) == 0 {
+			s.write(" DEFAULT VALUES")
+		} else {
+			quoted := make([]string, len(columns))
+			for i, name := range columns {
+				quoted[i] = pgx.Identifier{name}.Sanitize()
+			}
+			s.write(" (" + strings.Join(quoted, ", ") + ")")
+			if edit.OverridingSystemValue {
+				s.write(" OVERRIDING SYSTEM VALUE")
+			}
+			s.write(" VALUES (")
+			for i, name := range columns {
+				column, err := table.column(name)
+				if err != nil {
+					return nil, err
+				}
+				if i > 0 {
+					s.write(", ")
+				}
+				if err := s.bind(column.UDTName, edit.Values[name]); err != nil {
+					return nil, fmt.Errorf("column %s: %w", name, err)
+				}
+			}
+			s.write(")")
+		}
+		// The new row is returned with its key, so the insert can be journaled and undone
+		s.returnText(table.writableColumns())
+		return s, nil
+
+	case model.RowEditUpdate:
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("update of %s sets no columns", table.name)
+		}
+		s.write("UPDATE " + table.name + " SET ")
+		for i, name := range columns {
+			column, err := table.column(name)
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 {
+				s.write(", ")
+			}
+			s.write(pgx.Identifier{name}.Sanitize() + " = ")
+			if err := s.bind(column.UDTName, edit.Values[name]); err != nil {
+				return nil, fmt.Errorf("column %s: %w", name, err)
+			}
+		}
+		s.write(" WHERE ")
+		s.beforeColumns = columns
+
+	case model.RowEditDelete:
+		s.write("DELETE FROM " + table.name + " WHERE ")
+		s.beforeColumns = table.writableColumns()
+
+	default:
+		return nil, fmt.Errorf("invalid row edit %q. Only insert, update and delete are allowed", edit.Kind)
+	}
+
+	if err := s.keyCondition(table, edit.Key); err != nil {
+		return nil, err
+	}
+	written := edited.columns(table, edit.Key)
+	if err := s.guardConditions(table, edit, written); err != nil {
+		return nil, err
+	}
+	for _, name := range columns {
+		written[name] = true
+	}
+	if edit.Kind == model.RowEditUpdate {
+		// The key is returned too, the update may change it
+		returning := slices.Clone(s.beforeColumns)
+		for _, column := range table.key {
+			if !slices.Contains(returning, column.name) {
+				returning = append(returning, column.name)
+			}
+		}
+		s.returnText(returning)
+	}
+
+	s.before = &editStatement{}
+	s.before.write("SELECT " + textColumns(s.beforeColumns) + " FROM " + table.name + " WHERE ")
+	if err := s.before.keyCondition(table, edit.Key); err != nil {
+		return nil, err
+	}
+	s.before.write(" FOR UPDATE")
+
+	s.exists = &editStatement{}
+	s.exists.write("SELECT EXISTS (SELECT 1 FROM " + table.name + " WHERE ")
+	if err := s.exists.keyCondition(table, edit.Key); err != nil {
+		return nil, err
+	}
+	s.exists.write(")")
+
+	return s, nil
+}
+
+func buildRowEdits(ctx context.Context, q querier, edits []model.RowEdit) ([]*editStatement, *model.RowEditResult, error) {
+	if len(edits) == 0 {
+		return nil, nil, errors.New("there are no changes to save")
+	}
+
+	tables := newEditTables(q)
+	edited := make(editedRows)
+	result := &model.RowEditResult{}
+	var statements []*editStatement
+	var previews []string
+	for i, edit := range edits {
+		s, err := buildRowEdit(ctx, tables, edited, i, edit)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "edit %d", i+1)
+		}
+		statements = append(statements, s)
+		previews = append(previews, s.preview.String()+";")
+		result.Statements = append(result.Statements, model.RowEditStatement{SQL: s.preview.String() + ";", Key: edit.Key})
+	}
+	result.SQL = strings.Join(previews, "\n")
+
+	return statements, result, nil
+}
+
+// PreviewRowEdits renders the statements of a batch of row edits without running them
+func (c *Connections) PreviewRowEdits(activePoolID uuid.UUID, edits []model.RowEdit) (*model.RowEditResult, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	_, result, err := buildRowEdits(context.Background(), pool, edits)
+	return result, err
+}
+
+// ApplyRowEdits runs a batch of row edits in one transaction. Updates and deletes of rows which
+// changed since they were read are reported as conflicts and nothing is committed. A dry run
+// reports what would happen and rolls back. Committed batches are journaled so they can be undone.
+func (c *Connections) ApplyRowEdits(activePoolID uuid.UUID, edits []model.RowEdit, dryRun bool) (*model.RowEditResult, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	result, entries, err := applyRowEdits(context.Background(), pool, edits, dryRun)
+	if err != nil || !result.Applied {
+		return result, err
+	}
+
+	// The edits are committed already, a journal failure only loses the undo
+	info, exists := c.PM.GetPoolInfo(activePoolID)
+	if !exists {
+		return result, nil
+	}
+	batchID, err := c.journalEditBatch(info, entries)
+	if err != nil {
+		log.Printf("failed to journal row edits: %v", err)
+		return result, nil
+	}
+	result.BatchID = batchID
+
+	return result, nil
+}
+
+// Run a batch of row edits in one transaction and return the journal entries of the edited rows
+func applyRowEdits(ctx context.Context, pool *pgxpool.Pool, edits []model.RowEdit, dryRun bool) (*model.RowEditResult, []model.EditJournalEntry, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	statements, result, err := buildRowEdits(ctx, tx, edits)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.DryRun = dryRun
+
+	var entries []model.EditJournalEntry
+	for i, s := range statements {
+		entry := model.EditJournalEntry{
+			Kind:   s.kind,
+			Schema: schemaOrDefault(edits[i].Schema),
+			Table:  edits[i].Table,
+		}
+
+		if s.before != nil {
+			entry.Key = s.key
+			entry.Before, _, err = queryTextRow(ctx, tx, s.before, s.beforeColumns)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "edit %d", i+1)
+			}
+		}
+
+		after, affected, err := queryTextRow(ctx, tx, s, s.returning)
+		if err != nil {
+			// A restored row whose key is taken again is a conflict, the transaction can't go on
+			var pgErr *pgconn.PgError
+			if s.kind == model.RowEditInsert && errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				result.Conflicts = append(result.Conflicts, model.RowEditConflict{
+					Edit:    i,
+					Key:     s.table.rowKey(edits[i].Values),
+					Message: fmt.Sprintf("edit %d: a row with the same key already exists: %s", i+1, pgErr.Detail),
+				})
+				break
+			}
+			return nil, nil, errors.Wrapf(err, "edit %d", i+1)
+		}
+		result.Statements[i].RowsAffected = affected
+
+		if affected > 0 {
+			if s.kind != model.RowEditDelete {
+				entry.After = after
+				entry.NewKey = s.table.rowKey(after)
+			}
+			if s.kind == model.RowEditInsert {
+				result.Statements[i].Key = entry.NewKey
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		if s.kind == model.RowEditInsert {
+			continue
+		}
+
+		var rowExists bool
+		if err := tx.QueryRow(ctx, s.exists.sql.String(), s.exists.args...).Scan(&rowExists); err != nil {
+			return nil, nil, errors.Wrapf(err, "edit %d", i+1)
+		}
+		conflict := model.RowEditConflict{Edit: i, Key: s.key, Deleted: !rowExists}
+		if rowExists {
+			conflict.Message = fmt.Sprintf("edit %d: the row was changed by someone else since it was read", i+1)
+		} else {
+			conflict.Message = fmt.Sprintf("edit %d: the row was deleted by someone else since it was read", i+1)
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+
+	if dryRun || len(result.Conflicts) > 0 {
+		return result, nil, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	result.Applied = true
+
+	return result, entries, nil
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// A column of the key identifying the rows of a table
+type rowKeyColumn struct {
+	name    string
+	attnum  int16
+	udtName string
+}
+
+// getRowKeyColumns returns the columns which identify a row: the primary key, or else the
+// smallest unique index over NOT NULL columns without expressions or predicate. Tables without
+// such a key return no columns.
+func getRowKeyColumns(ctx context.Context, q querier, schema, tableName string) ([]rowKeyColumn, error) {
+	query := `
+		WITH key AS (
+			SELECT idx.indrelid, idx.indkey, idx.indnkeyatts
+			FROM pg_index idx
+			JOIN pg_class t     ON t.oid = idx.indrelid
+			JOIN pg_namespace n ON n.oid = t.relnamespace
+			WHERE t.relname = $1
+			  AND n.nspname = $2
+			  AND idx.indisunique
+			  AND idx.indisvalid
+			  AND idx.indpred IS NULL
+			  AND idx.indexprs IS NULL
+			  AND NOT EXISTS (
+				SELECT 1
+				FROM generate_series(0, idx.indnkeyatts - 1) AS k
+				JOIN pg_attribute a ON a.attrelid = idx.indrelid AND a.attnum = idx.indkey[k]
+				WHERE NOT a.attnotnull
+			  )
+			ORDER BY idx.indisprimary DESC, idx.indnkeyatts, idx.indexrelid
+			LIMIT 1
+		)
+		SELECT a.attname::text, a.attnum, t.typname::text
+		FROM key
+		CROSS JOIN generate_series(0, key.indnkeyatts - 1) AS k
+		JOIN pg_attribute a ON a.attrelid = key.indrelid AND a.attnum = key.indkey[k]
+		JOIN pg_type t      ON t.oid = a.atttypid
+		ORDER BY k;
+	`
+	rows, err := q.Query(ctx, query, tableName, schemaOrDefault(schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []rowKeyColumn
+	for rows.Next() {
+		var column rowKeyColumn
+		if err := rows.Scan(&column.name, &column.attnum, &column.udtName); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// rowKeys reads the key of every row of a result over a single table
+type rowKeys struct {
+	columns []string
+	indexes []int
+	oids    []uint32
+	typeMap *pgtype.Map
+}
+
+// newRowKeys finds the key columns of a table in a result. When the rows of the result can't be
+// told apart it returns the reason instead.
+func newRowKeys(ctx context.Context, q querier, schema, tableName string, rows pgx.Rows) (*rowKeys, string, error) {
+	keyColumns, err := getRowKeyColumns(ctx, q, schema, tableName)
+	if err != nil {
+		return nil, "", err
+	}
+	table := quoteQualified(schemaOrDefault(schema), tableName)
+	if len(keyColumns) == 0 {
+		return nil, fmt.Sprintf("%s has no primary key or unique key on NOT NULL columns, its rows can't be edited", table), nil
+	}
+
+	// Columns are matched by attribute number, so an expression aliased to a key column name
+	// isn't taken for the key
+	fields := rows.FieldDescriptions()
+	keys := &rowKeys{typeMap: rows.Conn().TypeMap()}
+	var missing []string
+	for _, column := range keyColumns {
+		index := slices.IndexFunc(fields, func(field pgconn.FieldDescription) bool {
+			return field.TableOID != 0 && field.TableAttributeNumber == uint16(column.attnum)
+		})
+		if index == -1 {
+			missing = append(missing, column.name)
+			continue
+		}
+		keys.columns = append(keys.columns, column.name)
+		keys.indexes = append(keys.indexes, index)
+		keys.oids = append(keys.oids, fields[index].DataTypeOID)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Sprintf("the result doesn't include the key columns %s of %s, its rows can't be edited", strings.Join(missing, ", "), table), nil
+	}
+
+	return keys, "", nil
+}
+
+// Key of a row as the text representation of its key values
+func (k *rowKeys) key(row []any) (model.RowKey, error) {
+	key := make(model.RowKey, len(k.columns))
+	for i, index := range k.indexes {
+		if row[index] == nil {
+			return nil, fmt.Errorf("key column %s is NULL", k.columns[i])
+		}
+		text, err := k.typeMap.Encode(k.oids[i], pgtype.TextFormatCode, row[index], nil)
+		if err != nil {
+			return nil, err
+		}
+		key[k.columns[i]] = string(text)
+	}
+	return key, nil
+}
+
+// Alias of the xmin column appended to table reads. It's removed from the result, clients get the
+// xmin of every row as RowVersions.
+const rowVersionColumn = "dbmx_row_version"
+
+// withRowVersion appends xmin to the select list of a table read. Plain and partitioned tables
+// have one, views and foreign tables don't, and grouped rows are no table rows.
+func (q *tableQuery) withRowVersion(ctx context.Context, db querier) (bool, error) {
+	if q.groupBy != "" {
+		return false, nil
+	}
+	var relkind string
+	if err := db.QueryRow(ctx, "SELECT relkind::text FROM pg_class WHERE oid = $1::regclass", q.table).Scan(&relkind); err != nil {
+		return false, err
+	}
+	if relkind != "r" && relkind != "p" {
+		return false, nil
+	}
+	q.selectList += ", xmin::text AS " + rowVersionColumn
+	return true, nil
+}
+
+// Split the row version off the end of a row
+func splitRowVersion(row []any) ([]any, string) {
+	version, _ := row[len(row)-1].(string)
+	return row[:len(row)-1], version
+}
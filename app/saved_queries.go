@@ -3,6 +3,7 @@ package app
 import (
 	"database/sql"
 	"dbmx/model"
+	"encoding/json"
 )
 
 type SavedQueries struct {
@@ -14,13 +15,27 @@ func NewSavedQueries(db *sql.DB) *SavedQueries {
 }
 
 func (sq *SavedQueries) SaveQuery(title string, query string) error {
-	stmt := `INSERT INTO saved_queries (title, query) VALUES (?, ?)`
-	_, err := sq.DB.Exec(stmt, title, query)
+	return sq.SaveQueryWithParams(title, query, nil)
+}
+
+// SaveQueryWithParams saves a query along with the values of its parameters
+func (sq *SavedQueries) SaveQueryWithParams(title string, query string, params map[string]model.QueryParam) error {
+	paramsJSON := ""
+	if len(params) > 0 {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		paramsJSON = string(b)
+	}
+
+	stmt := `INSERT INTO saved_queries (title, query, params) VALUES (?, ?, ?)`
+	_, err := sq.DB.Exec(stmt, title, query, paramsJSON)
 	return err
 }
 
 func (sq *SavedQueries) GetSavedQueries() ([]model.SavedQuery, error) {
-	query := `SELECT id, title, query, saved_at FROM saved_queries ORDER BY saved_at DESC LIMIT 50`
+	query := `SELECT id, title, query, saved_at, params FROM saved_queries ORDER BY saved_at DESC LIMIT 50`
 	rows, err := sq.DB.Query(query)
 	if err != nil {
 		return nil, err
@@ -30,10 +45,17 @@ func (sq *SavedQueries) GetSavedQueries() ([]model.SavedQuery, error) {
 	var queries []model.SavedQuery
 	for rows.Next() {
 		var q model.SavedQuery
-		err := rows.Scan(&q.ID, &q.Title, &q.Query, &q.SavedAt)
+		var paramsJSON string
+		err := rows.Scan(&q.ID, &q.Title, &q.Query, &q.SavedAt, &paramsJSON)
 		if err != nil {
 			return nil, err
 		}
+		if len(paramsJSON) > 0 {
+			err = json.Unmarshal([]byte(paramsJSON), &q.Params)
+			if err != nil {
+				return nil, err
+			}
+		}
 		queries = append(queries, q)
 	}
 
@@ -0,0 +1,898 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Object kinds compared by the schema diff
+var diffObjectKinds = []string{
+	model.ObjectKindSequence,
+	model.ObjectKindFunction,
+	model.ObjectKindProcedure,
+	model.ObjectKindView,
+	model.ObjectKindMaterializedView,
+}
+
+// Phases of a migration script, statements run in this order
+const (
+	phaseCreateSchemas = iota
+	phaseDropForeignKeys
+	phaseDropViews
+	phaseDropConstraints
+	phaseDropTables
+	phaseDropFunctions
+	phaseSequences
+	phaseFunctionsAndTables
+	phaseCreateTables
+	phaseAlterTables
+	phaseAddConstraints
+	phaseCreateViews
+	phaseAddForeignKeys
+	phaseComments
+	phaseDropSequences
+	phaseDropSchemas
+	phaseCount
+)
+
+var phaseTitles = [phaseCount]string{
+	"Create schemas",
+	"Drop foreign keys",
+	"Drop views",
+	"Drop constraints and indexes",
+	"Drop tables",
+	"Drop functions",
+	"Sequences",
+	"Functions and tables",
+	"Create tables",
+	"Alter tables",
+	"Add constraints and indexes",
+	"Create views",
+	"Add foreign keys",
+	"Comments",
+	"Drop sequences",
+	"Drop schemas",
+}
+
+type migration struct {
+	phases [phaseCount][]string
+	// Functions and tables to create, ordered by their dependencies when the script is rendered
+	creates []migrationCreate
+}
+
+// migrationCreate creates a function or a table. Keys and dependencies are schema qualified
+// names, functions are named with their identity arguments.
+type migrationCreate struct {
+	key          string
+	dependencies []string
+	statement    string
+	function     bool
+}
+
+func (m *migration) add(phase int, statement string) {
+	statement = strings.TrimRight(statement, "\n")
+	if statement == "" {
+		return
+	}
+	m.phases[phase] = append(m.phases[phase], statement)
+}
+
+func (m *migration) create(key string, dependencies []string, statement string, function bool) {
+	m.creates = append(m.creates, migrationCreate{key, dependencies, strings.TrimRight(statement, "\n"), function})
+}
+
+// Statements of the created functions and tables, functions first unless they use a table
+func (m *migration) createStatements() []string {
+	creates := slices.Clone(m.creates)
+	slices.SortStableFunc(creates, func(a, b migrationCreate) int {
+		switch {
+		case a.function == b.function:
+			return 0
+		case a.function:
+			return -1
+		}
+		return 1
+	})
+
+	keys := make([]string, len(creates))
+	dependencies := make(map[string][]string, len(creates))
+	statements := make(map[string]string, len(creates))
+	for i, create := range creates {
+		keys[i] = create.key
+		dependencies[create.key] = create.dependencies
+		statements[create.key] = create.statement
+	}
+
+	var ordered []string
+	if len(creates) > 0 && creates[0].function {
+		ordered = append(ordered, functionBodyChecksOff)
+	}
+	for _, key := range orderByDependencies(keys, dependencies) {
+		ordered = append(ordered, statements[key])
+	}
+	if len(creates) > 0 && creates[0].function {
+		ordered = append(ordered, functionBodyChecksReset)
+	}
+	return ordered
+}
+
+func (m *migration) sql() string {
+	phases := m.phases
+	phases[phaseFunctionsAndTables] = m.createStatements()
+
+	var b strings.Builder
+	for phase, statements := range phases {
+		if len(statements) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("-- " + phaseTitles[phase] + "\n\n")
+		for _, statement := range statements {
+			b.WriteString(statement + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Get the names of all user schemas
+func listUserSchemas(ctx context.Context, q querier) ([]string, error) {
+	rows, err := q.Query(ctx, "SELECT nspname::text FROM pg_namespace WHERE nspname !~ '^pg_' AND nspname <> 'information_schema' ORDER BY nspname")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, rows.Err()
+}
+
+// loadSchemaModel introspects the tables, views, functions and sequences of the given schemas, or
+// of all user schemas when none are given
+func loadSchemaModel(ctx context.Context, q querier, schemas []string) (*model.SchemaModel, error) {
+	if len(schemas) == 0 {
+		var err error
+		schemas, err = listUserSchemas(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &model.SchemaModel{}
+	// Index of each function and procedure in the objects, by oid
+	functions := make(map[uint32]int)
+	for _, schema := range schemas {
+		var exists bool
+		err := q.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", schema).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		m.Schemas = append(m.Schemas, schema)
+
+		tables, err := loadSchemaTableDefs(ctx, q, schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			m.Tables = append(m.Tables, *table)
+		}
+
+		objects, err := listDatabaseObjects(ctx, q, schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if object.Schema != schema || !containsString(diffObjectKinds, object.Kind) {
+				continue
+			}
+			definition, err := objectDefinition(ctx, q, object.Kind, object.OID)
+			if err != nil {
+				return nil, err
+			}
+			var signature string
+			if object.Kind == model.ObjectKindFunction || object.Kind == model.ObjectKindProcedure {
+				query := "SELECT pg_get_function_arguments($1) || COALESCE(' RETURNS ' || pg_get_function_result($1), '')"
+				if err := q.QueryRow(ctx, query, object.OID).Scan(&signature); err != nil {
+					return nil, err
+				}
+				functions[object.OID] = len(m.Objects)
+			}
+			m.Objects = append(m.Objects, model.ObjectDef{
+				Kind:       object.Kind,
+				Schema:     object.Schema,
+				Name:       object.Name,
+				Arguments:  object.Arguments,
+				Signature:  signature,
+				Definition: strings.TrimSpace(definition),
+			})
+		}
+	}
+
+	// Relations selected by views
+	query := `
+		SELECT DISTINCT format('%I.%I', vn.nspname, v.relname), format('%I.%I', dn.nspname, dc.relname)
+		FROM pg_rewrite r
+		JOIN pg_class v      ON v.oid = r.ev_class
+		JOIN pg_namespace vn ON vn.oid = v.relnamespace
+		JOIN pg_depend d     ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid AND d.refclassid = 'pg_class'::regclass
+		JOIN pg_class dc     ON dc.oid = d.refobjid
+		JOIN pg_namespace dn ON dn.oid = dc.relnamespace
+		WHERE v.relkind IN ('v', 'm') AND dc.oid <> v.oid AND vn.nspname = ANY($1);
+	`
+	rows, err := q.Query(ctx, query, m.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependencies := make(map[string][]string)
+	for rows.Next() {
+		var view, dependency string
+		if err := rows.Scan(&view, &dependency); err != nil {
+			return nil, err
+		}
+		dependencies[view] = append(dependencies[view], dependency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range m.Objects {
+		object := &m.Objects[i]
+		if isViewKind(object.Kind) {
+			object.Dependencies = dependencies[quoteQualified(object.Schema, object.Name)]
+		}
+	}
+
+	// Functions and tables using each other, they are created in the order of their dependencies
+	names := make(map[catalogObject]string)
+	for _, table := range m.Tables {
+		names[catalogObject{"pg_class", table.OID}] = quoteQualified(table.Schema, table.Name)
+	}
+	for oid, i := range functions {
+		names[catalogObject{"pg_proc", oid}] = objectSQLName(m.Objects[i])
+	}
+	objects := make([]catalogObject, 0, len(names))
+	for object := range names {
+		objects = append(objects, object)
+	}
+	objectDependencies, err := loadObjectDependencies(ctx, q, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	m.TableDependencies = make(map[string][]string)
+	for object, refs := range objectDependencies {
+		var used []string
+		for _, ref := range refs {
+			used = append(used, names[ref])
+		}
+		slices.Sort(used)
+		if object.catalog == "pg_class" {
+			m.TableDependencies[names[object]] = used
+		} else {
+			m.Objects[functions[object.oid]].Dependencies = used
+		}
+	}
+
+	return m, nil
+}
+
+func isViewKind(kind string) bool {
+	return kind == model.ObjectKindView || kind == model.ObjectKindMaterializedView
+}
+
+// Key of an object, functions are overloaded by their arguments
+func objectKey(object model.ObjectDef) string {
+	key := object.Kind + " " + quoteQualified(object.Schema, object.Name)
+	if object.Kind == model.ObjectKindFunction || object.Kind == model.ObjectKindProcedure {
+		key += "(" + object.Arguments + ")"
+	}
+	return key
+}
+
+// Name of an object in DDL statements
+func objectSQLName(object model.ObjectDef) string {
+	name := quoteQualified(object.Schema, object.Name)
+	if object.Kind == model.ObjectKindFunction || object.Kind == model.ObjectKindProcedure {
+		name += "(" + object.Arguments + ")"
+	}
+	return name
+}
+
+func indexTables(tables []model.TableDef) ([]string, map[string]*model.TableDef) {
+	keys := make([]string, len(tables))
+	byKey := make(map[string]*model.TableDef, len(tables))
+	for i := range tables {
+		keys[i] = quoteQualified(tables[i].Schema, tables[i].Name)
+		byKey[keys[i]] = &tables[i]
+	}
+	return keys, byKey
+}
+
+func indexObjects(objects []model.ObjectDef) ([]string, map[string]*model.ObjectDef) {
+	keys := make([]string, len(objects))
+	byKey := make(map[string]*model.ObjectDef, len(objects))
+	for i := range objects {
+		keys[i] = objectKey(objects[i])
+		byKey[keys[i]] = &objects[i]
+	}
+	return keys, byKey
+}
+
+// Attributes which differ between two versions of a column
+func columnChanges(source, target model.ColumnDef) []string {
+	var changes []string
+	if source.Type != target.Type {
+		changes = append(changes, "type")
+	}
+	if source.Collation != target.Collation {
+		changes = append(changes, "collation")
+	}
+	if source.Default != target.Default {
+		changes = append(changes, "default")
+	}
+	if source.NotNull != target.NotNull {
+		changes = append(changes, "not null")
+	}
+	if source.Identity != target.Identity {
+		changes = append(changes, "identity")
+	}
+	if source.Generated != target.Generated {
+		changes = append(changes, "generated")
+	}
+	if source.Comment != target.Comment {
+		changes = append(changes, "comment")
+	}
+	return changes
+}
+
+func nullableLiteral(value string) string {
+	if value == "" {
+		return "NULL"
+	}
+	return quoteLiteral(value)
+}
+
+// diffSchemaModels compares two schema models. The SQL of the diff migrates the target to the source.
+func diffSchemaModels(source, target *model.SchemaModel) *model.SchemaDiff {
+	diff := &model.SchemaDiff{}
+	m := &migration{}
+
+	// Schemas
+	for _, schema := range source.Schemas {
+		if !containsString(target.Schemas, schema) {
+			diff.Schemas = append(diff.Schemas, model.ItemDiff{Name: schema, Change: model.DiffAdded})
+			m.add(phaseCreateSchemas, "CREATE SCHEMA IF NOT EXISTS "+quoteIdent(schema)+";")
+		}
+	}
+	for _, schema := range target.Schemas {
+		if !containsString(source.Schemas, schema) {
+			diff.Schemas = append(diff.Schemas, model.ItemDiff{Name: schema, Change: model.DiffRemoved})
+			m.add(phaseDropSchemas, "DROP SCHEMA "+quoteIdent(schema)+";")
+		}
+	}
+
+	sourceTableKeys, sourceTables := indexTables(source.Tables)
+	targetTableKeys, targetTables := indexTables(target.Tables)
+
+	// Tables whose dependent views have to be recreated: dropped tables and tables with
+	// dropped or retyped columns
+	rebuildDependents := make(map[string]struct{})
+
+	// Added tables
+	for _, key := range sourceTableKeys {
+		if _, ok := targetTables[key]; ok {
+			continue
+		}
+		def := sourceTables[key]
+		diff.Tables = append(diff.Tables, model.TableDiff{Schema: def.Schema, Name: def.Name, Change: model.DiffAdded})
+
+		m.create(key, source.TableDependencies[key], createTableSQL(def, false), false)
+		for _, index := range def.Indexes {
+			m.add(phaseAddConstraints, index.Definition+";")
+		}
+		if fks := foreignKeysSQL(def); fks != "" {
+			m.add(phaseAddForeignKeys, fks)
+		}
+		m.add(phaseComments, tableCommentsSQL(def))
+	}
+
+	// Removed tables, tables referencing or inheriting from a table are dropped first
+	var removedTables []string
+	droppedBefore := make(map[string][]string)
+	for _, key := range targetTableKeys {
+		if _, ok := sourceTables[key]; ok {
+			continue
+		}
+		def := targetTables[key]
+		diff.Tables = append(diff.Tables, model.TableDiff{Schema: def.Schema, Name: def.Name, Change: model.DiffRemoved})
+		removedTables = append(removedTables, key)
+		rebuildDependents[key] = struct{}{}
+
+		for _, constraint := range def.Constraints {
+			if constraint.Type == model.ConstraintForeignKey && constraint.References != key {
+				droppedBefore[constraint.References] = append(droppedBefore[constraint.References], key)
+			}
+		}
+		parents := def.Inherits
+		if def.PartitionOf != "" {
+			parents = append(parents, def.PartitionOf)
+		}
+		for _, parent := range parents {
+			droppedBefore[parent] = append(droppedBefore[parent], key)
+		}
+	}
+	for _, key := range orderByDependencies(removedTables, droppedBefore) {
+		m.add(phaseDropTables, "DROP TABLE "+key+";")
+	}
+
+	// Changed tables
+	for _, key := range sourceTableKeys {
+		targetDef, ok := targetTables[key]
+		if !ok {
+			continue
+		}
+		tableDiff, rebuild := diffTables(sourceTables[key], targetDef, m, diff)
+		if tableDiff != nil {
+			diff.Tables = append(diff.Tables, *tableDiff)
+		}
+		if rebuild {
+			rebuildDependents[key] = struct{}{}
+		}
+	}
+
+	diffObjects(source, target, rebuildDependents, m, diff)
+
+	diff.SQL = m.sql()
+
+	return diff
+}
+
+// Compare two versions of a table and add the statements which migrate it. It also reports whether
+// views selecting from the table have to be recreated.
+func diffTables(source, target *model.TableDef, m *migration, diff *model.SchemaDiff) (*model.TableDiff, bool) {
+	tableDiff := &model.TableDiff{Schema: source.Schema, Name: source.Name, Change: model.DiffChanged}
+	name := quoteQualified(source.Schema, source.Name)
+	rebuild := false
+
+	if source.PartitionBy != target.PartitionBy || source.PartitionOf != target.PartitionOf || source.PartitionBound != target.PartitionBound || !slices.Equal(source.Inherits, target.Inherits) {
+		diff.Warnings = append(diff.Warnings, fmt.Sprintf("Partitioning or inheritance of %s differs, the table has to be recreated manually", name))
+	}
+
+	if source.Unlogged != target.Unlogged {
+		if source.Unlogged {
+			m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s SET UNLOGGED;", name))
+		} else {
+			m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s SET LOGGED;", name))
+		}
+	}
+
+	if !slices.Equal(source.Options, target.Options) {
+		if len(source.Options) > 0 {
+			m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s SET (%s);", name, strings.Join(source.Options, ", ")))
+		}
+		var reset []string
+		for _, option := range target.Options {
+			key, _, _ := strings.Cut(option, "=")
+			found := false
+			for _, sourceOption := range source.Options {
+				if strings.HasPrefix(sourceOption, key+"=") {
+					found = true
+				}
+			}
+			if !found {
+				reset = append(reset, key)
+			}
+		}
+		if len(reset) > 0 {
+			m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s RESET (%s);", name, strings.Join(reset, ", ")))
+		}
+	}
+
+	// Columns
+	targetColumns := make(map[string]model.ColumnDef, len(target.Columns))
+	for _, column := range target.Columns {
+		targetColumns[column.Name] = column
+	}
+	sourceColumns := make(map[string]model.ColumnDef, len(source.Columns))
+	for _, column := range source.Columns {
+		sourceColumns[column.Name] = column
+	}
+
+	for _, column := range source.Columns {
+		targetColumn, ok := targetColumns[column.Name]
+		if !ok {
+			tableDiff.Columns = append(tableDiff.Columns, model.ColumnDiff{Name: column.Name, Change: model.DiffAdded, Source: &column})
+			if !column.Inherited {
+				m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", name, columnSQL(column)))
+				if column.Comment != "" {
+					m.add(phaseComments, commentSQL("COLUMN", name+"."+quoteIdent(column.Name), column.Comment))
+				}
+			}
+			continue
+		}
+
+		changes := columnChanges(column, targetColumn)
+		if len(changes) == 0 {
+			continue
+		}
+		tableDiff.Columns = append(tableDiff.Columns, model.ColumnDiff{Name: column.Name, Change: model.DiffChanged, Attributes: changes, Source: &column, Target: &targetColumn})
+		if column.Inherited {
+			continue
+		}
+		if alterColumnSQL(name, column, targetColumn, changes, m, diff) {
+			rebuild = true
+		}
+	}
+
+	for _, column := range target.Columns {
+		if _, ok := sourceColumns[column.Name]; ok {
+			continue
+		}
+		tableDiff.Columns = append(tableDiff.Columns, model.ColumnDiff{Name: column.Name, Change: model.DiffRemoved, Target: &column})
+		if !column.Inherited {
+			m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", name, quoteIdent(column.Name)))
+			rebuild = true
+		}
+	}
+
+	// Constraints, a changed constraint is dropped and added again
+	targetConstraints := make(map[string]model.ConstraintDef, len(target.Constraints))
+	for _, constraint := range target.Constraints {
+		targetConstraints[constraint.Name] = constraint
+	}
+	sourceConstraints := make(map[string]model.ConstraintDef, len(source.Constraints))
+	for _, constraint := range source.Constraints {
+		sourceConstraints[constraint.Name] = constraint
+	}
+
+	dropConstraint := func(constraint model.ConstraintDef) {
+		phase := phaseDropConstraints
+		if constraint.Type == model.ConstraintForeignKey {
+			phase = phaseDropForeignKeys
+		}
+		m.add(phase, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", name, quoteIdent(constraint.Name)))
+	}
+	addConstraint := func(constraint model.ConstraintDef) {
+		phase := phaseAddConstraints
+		if constraint.Type == model.ConstraintForeignKey {
+			phase = phaseAddForeignKeys
+		}
+		m.add(phase, addConstraintSQL(source, constraint))
+		if constraint.Comment != "" {
+			m.add(phaseComments, commentSQL("CONSTRAINT", quoteIdent(constraint.Name)+" ON "+name, constraint.Comment))
+		}
+	}
+
+	for _, constraint := range source.Constraints {
+		targetConstraint, ok := targetConstraints[constraint.Name]
+		switch {
+		case !ok:
+			tableDiff.Constraints = append(tableDiff.Constraints, model.ItemDiff{Name: constraint.Name, Change: model.DiffAdded, SourceDefinition: constraint.Definition})
+			addConstraint(constraint)
+		case constraint.Type != targetConstraint.Type || constraint.Definition != targetConstraint.Definition:
+			tableDiff.Constraints = append(tableDiff.Constraints, model.ItemDiff{Name: constraint.Name, Change: model.DiffChanged, SourceDefinition: constraint.Definition, TargetDefinition: targetConstraint.Definition})
+			dropConstraint(targetConstraint)
+			addConstraint(constraint)
+		case constraint.Comment != targetConstraint.Comment:
+			m.add(phaseComments, fmt.Sprintf("COMMENT ON CONSTRAINT %s ON %s IS %s;", quoteIdent(constraint.Name), name, nullableLiteral(constraint.Comment)))
+		}
+	}
+	for _, constraint := range target.Constraints {
+		if _, ok := sourceConstraints[constraint.Name]; !ok {
+			tableDiff.Constraints = append(tableDiff.Constraints, model.ItemDiff{Name: constraint.Name, Change: model.DiffRemoved, TargetDefinition: constraint.Definition})
+			dropConstraint(constraint)
+		}
+	}
+
+	// Indexes, a changed index is dropped and created again
+	targetIndexes := make(map[string]model.IndexDef, len(target.Indexes))
+	for _, index := range target.Indexes {
+		targetIndexes[index.Name] = index
+	}
+	sourceIndexes := make(map[string]model.IndexDef, len(source.Indexes))
+	for _, index := range source.Indexes {
+		sourceIndexes[index.Name] = index
+	}
+
+	for _, index := range source.Indexes {
+		targetIndex, ok := targetIndexes[index.Name]
+		indexName := quoteQualified(source.Schema, index.Name)
+		switch {
+		case !ok:
+			tableDiff.Indexes = append(tableDiff.Indexes, model.ItemDiff{Name: index.Name, Change: model.DiffAdded, SourceDefinition: index.Definition})
+			m.add(phaseAddConstraints, index.Definition+";")
+			m.add(phaseComments, commentSQL("INDEX", indexName, index.Comment))
+		case index.Definition != targetIndex.Definition:
+			tableDiff.Indexes = append(tableDiff.Indexes, model.ItemDiff{Name: index.Name, Change: model.DiffChanged, SourceDefinition: index.Definition, TargetDefinition: targetIndex.Definition})
+			m.add(phaseDropConstraints, "DROP INDEX "+indexName+";")
+			m.add(phaseAddConstraints, index.Definition+";")
+			m.add(phaseComments, commentSQL("INDEX", indexName, index.Comment))
+		case index.Comment != targetIndex.Comment:
+			m.add(phaseComments, fmt.Sprintf("COMMENT ON INDEX %s IS %s;", indexName, nullableLiteral(index.Comment)))
+		}
+	}
+	for _, index := range target.Indexes {
+		if _, ok := sourceIndexes[index.Name]; !ok {
+			tableDiff.Indexes = append(tableDiff.Indexes, model.ItemDiff{Name: index.Name, Change: model.DiffRemoved, TargetDefinition: index.Definition})
+			m.add(phaseDropConstraints, "DROP INDEX "+quoteQualified(target.Schema, index.Name)+";")
+		}
+	}
+
+	if source.Comment != target.Comment {
+		tableDiff.CommentChanged = true
+		m.add(phaseComments, fmt.Sprintf("COMMENT ON TABLE %s IS %s;", name, nullableLiteral(source.Comment)))
+	}
+
+	if len(tableDiff.Columns) == 0 && len(tableDiff.Constraints) == 0 && len(tableDiff.Indexes) == 0 && !tableDiff.CommentChanged &&
+		source.Unlogged == target.Unlogged && slices.Equal(source.Options, target.Options) {
+		return nil, rebuild
+	}
+
+	return tableDiff, rebuild
+}
+
+// Add the statements which migrate a changed column. It reports whether the column was retyped or
+// recreated, which requires dependent views to be recreated.
+func alterColumnSQL(table string, source, target model.ColumnDef, changes []string, m *migration, diff *model.SchemaDiff) bool {
+	column := quoteIdent(source.Name)
+	alter := func(action string) {
+		m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s;", table, column, action))
+	}
+
+	// Generated columns can't be altered into regular ones and back, their values are derived
+	// so the column is recreated
+	if containsString(changes, "generated") {
+		if target.Generated == "" {
+			diff.Warnings = append(diff.Warnings, fmt.Sprintf("Column %s of %s becomes generated, its current values are discarded", source.Name, table))
+		}
+		m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, column))
+		m.add(phaseAlterTables, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table, columnSQL(source)))
+		if source.Comment != "" {
+			m.add(phaseComments, commentSQL("COLUMN", table+"."+column, source.Comment))
+		}
+		return true
+	}
+
+	retyped := false
+	if containsString(changes, "type") || containsString(changes, "collation") {
+		action := "TYPE " + source.Type
+		if source.Collation != "" {
+			action += " COLLATE " + source.Collation
+		}
+		if source.Type != target.Type {
+			action += fmt.Sprintf(" USING %s::%s", column, source.Type)
+		}
+		alter(action)
+		retyped = true
+	}
+	if containsString(changes, "identity") {
+		switch {
+		case source.Identity == "":
+			alter("DROP IDENTITY")
+		case target.Identity == "":
+			alter("ADD GENERATED " + source.Identity + " AS IDENTITY")
+		default:
+			alter("SET GENERATED " + source.Identity)
+		}
+	}
+	if containsString(changes, "default") {
+		if source.Default == "" {
+			alter("DROP DEFAULT")
+		} else {
+			alter("SET DEFAULT " + source.Default)
+		}
+	}
+	if containsString(changes, "not null") {
+		if source.NotNull {
+			alter("SET NOT NULL")
+		} else {
+			alter("DROP NOT NULL")
+		}
+	}
+	if containsString(changes, "comment") {
+		m.add(phaseComments, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;", table, column, nullableLiteral(source.Comment)))
+	}
+
+	return retyped
+}
+
+// Render the comments of a new table
+func tableCommentsSQL(def *model.TableDef) string {
+	var b strings.Builder
+	name := quoteQualified(def.Schema, def.Name)
+	b.WriteString(commentSQL("TABLE", name, def.Comment))
+	for _, column := range def.Columns {
+		if !column.Inherited {
+			b.WriteString(commentSQL("COLUMN", name+"."+quoteIdent(column.Name), column.Comment))
+		}
+	}
+	for _, constraint := range def.Constraints {
+		b.WriteString(commentSQL("CONSTRAINT", quoteIdent(constraint.Name)+" ON "+name, constraint.Comment))
+	}
+	for _, index := range def.Indexes {
+		b.WriteString(commentSQL("INDEX", quoteQualified(def.Schema, index.Name), index.Comment))
+	}
+	return b.String()
+}
+
+// Compare views, functions and sequences. Views which select from a changed view or from a table
+// in rebuildDependents are dropped and created again.
+func diffObjects(source, target *model.SchemaModel, rebuildDependents map[string]struct{}, m *migration, diff *model.SchemaDiff) {
+	sourceKeys, sourceObjects := indexObjects(source.Objects)
+	targetKeys, targetObjects := indexObjects(target.Objects)
+
+	for _, key := range sourceKeys {
+		object := sourceObjects[key]
+		targetObject, ok := targetObjects[key]
+		objectDiff := model.ObjectDiff{Kind: object.Kind, Schema: object.Schema, Name: object.Name, Arguments: object.Arguments, SourceDefinition: object.Definition}
+		switch {
+		case !ok:
+			objectDiff.Change = model.DiffAdded
+		case object.Definition != targetObject.Definition:
+			objectDiff.Change = model.DiffChanged
+			objectDiff.TargetDefinition = targetObject.Definition
+		default:
+			continue
+		}
+		diff.Objects = append(diff.Objects, objectDiff)
+
+		switch object.Kind {
+		case model.ObjectKindSequence:
+			if ok {
+				// ALTER SEQUENCE takes the same options
+				m.add(phaseSequences, strings.Replace(object.Definition, "CREATE SEQUENCE", "ALTER SEQUENCE", 1))
+			} else {
+				m.add(phaseSequences, object.Definition)
+			}
+		case model.ObjectKindFunction, model.ObjectKindProcedure:
+			// CREATE OR REPLACE can't change the result, or the names, modes and defaults of the
+			// arguments. Snapshots taken before signatures were recorded have none.
+			if ok && object.Signature != "" && targetObject.Signature != "" && object.Signature != targetObject.Signature {
+				drop := "DROP FUNCTION "
+				if object.Kind == model.ObjectKindProcedure {
+					drop = "DROP PROCEDURE "
+				}
+				m.add(phaseDropFunctions, drop+objectSQLName(*targetObject)+";")
+				diff.Warnings = append(diff.Warnings, fmt.Sprintf("The signature of %s changes, it is dropped and created again. Objects using it have to be recreated.", objectSQLName(*object)))
+			}
+			// pg_get_functiondef renders CREATE OR REPLACE
+			m.create(objectSQLName(*object), object.Dependencies, object.Definition+";", true)
+		default:
+			if ok {
+				rebuildDependents[quoteQualified(object.Schema, object.Name)] = struct{}{}
+			}
+		}
+	}
+
+	for _, key := range targetKeys {
+		object := targetObjects[key]
+		if _, ok := sourceObjects[key]; ok {
+			continue
+		}
+		diff.Objects = append(diff.Objects, model.ObjectDiff{Kind: object.Kind, Schema: object.Schema, Name: object.Name, Arguments: object.Arguments, Change: model.DiffRemoved, TargetDefinition: object.Definition})
+
+		switch object.Kind {
+		case model.ObjectKindSequence:
+			// Sequences owned by a dropped column or table are already gone
+			m.add(phaseDropSequences, "DROP SEQUENCE IF EXISTS "+objectSQLName(*object)+";")
+		case model.ObjectKindFunction:
+			m.add(phaseDropFunctions, "DROP FUNCTION "+objectSQLName(*object)+";")
+		case model.ObjectKindProcedure:
+			m.add(phaseDropFunctions, "DROP PROCEDURE "+objectSQLName(*object)+";")
+		default:
+			rebuildDependents[quoteQualified(object.Schema, object.Name)] = struct{}{}
+		}
+	}
+
+	// Views of the target to drop: removed, changed and the ones selecting from them, transitively
+	var targetViews []string
+	targetDependencies := make(map[string][]string)
+	targetViewByName := make(map[string]*model.ObjectDef)
+	for _, key := range targetKeys {
+		object := targetObjects[key]
+		if isViewKind(object.Kind) {
+			name := quoteQualified(object.Schema, object.Name)
+			targetViews = append(targetViews, name)
+			targetDependencies[name] = object.Dependencies
+			targetViewByName[name] = object
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, view := range targetViews {
+			if _, ok := rebuildDependents[view]; ok {
+				continue
+			}
+			for _, dependency := range targetDependencies[view] {
+				if _, ok := rebuildDependents[dependency]; ok {
+					rebuildDependents[view] = struct{}{}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	// Dependent views are dropped first
+	ordered := orderByDependencies(targetViews, targetDependencies)
+	for i := len(ordered) - 1; i >= 0; i-- {
+		view := ordered[i]
+		if _, ok := rebuildDependents[view]; !ok {
+			continue
+		}
+		keyword := "VIEW"
+		if targetViewByName[view].Kind == model.ObjectKindMaterializedView {
+			keyword = "MATERIALIZED VIEW"
+		}
+		m.add(phaseDropViews, fmt.Sprintf("DROP %s %s;", keyword, view))
+	}
+
+	// Views of the source to create: added and the dropped ones, after the views they select from
+	var sourceViews []string
+	sourceDependencies := make(map[string][]string)
+	sourceViewByName := make(map[string]*model.ObjectDef)
+	for _, key := range sourceKeys {
+		object := sourceObjects[key]
+		if isViewKind(object.Kind) {
+			name := quoteQualified(object.Schema, object.Name)
+			sourceViews = append(sourceViews, name)
+			sourceDependencies[name] = object.Dependencies
+			sourceViewByName[name] = object
+		}
+	}
+	for _, view := range orderByDependencies(sourceViews, sourceDependencies) {
+		_, rebuilt := rebuildDependents[view]
+		_, existed := targetViewByName[view]
+		if existed && !rebuilt {
+			continue
+		}
+		m.add(phaseCreateViews, sourceViewByName[view].Definition)
+	}
+}
+
+// CompareSchemas compares the schemas of two active databases, which can be on different
+// connections. All user schemas are compared when none are given. The SQL of the diff migrates
+// the target to the source.
+func (c *Connections) CompareSchemas(sourcePoolID, targetPoolID uuid.UUID, schemas []string) (*model.SchemaDiff, error) {
+	sourcePool, exists := c.PM.GetPool(sourcePoolID)
+	if !exists {
+		return nil, errors.New("source pool doesn't exist")
+	}
+	targetPool, exists := c.PM.GetPool(targetPoolID)
+	if !exists {
+		return nil, errors.New("target pool doesn't exist")
+	}
+
+	ctx := context.Background()
+
+	source, err := loadSchemaModel(ctx, sourcePool, schemas)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read source schema")
+	}
+	target, err := loadSchemaModel(ctx, targetPool, schemas)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read target schema")
+	}
+
+	return diffSchemaModels(source, target), nil
+}
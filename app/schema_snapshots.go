@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"dbmx/model"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Record the schema of a database into schema_snapshots. Connect snapshots are skipped when the
+// schema didn't change since the latest snapshot of the database.
+func (c *Connections) recordSchemaSnapshot(ctx context.Context, activePoolID uuid.UUID, connectionID int64, dbName, label, trigger string) (*model.SchemaSnapshot, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	schema, err := loadSchemaModel(ctx, pool, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(schemaJSON)
+	hash := hex.EncodeToString(sum[:])
+
+	if trigger == model.SnapshotTriggerConnect {
+		var latestHash string
+		err := c.DB.QueryRow(`SELECT hash FROM schema_snapshots WHERE connection_id = ? AND db_name = ? ORDER BY id DESC LIMIT 1`, connectionID, dbName).Scan(&latestHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if latestHash == hash {
+			return nil, nil
+		}
+	}
+
+	snapshot := model.SchemaSnapshot{
+		ConnectionID: connectionID,
+		DBName:       dbName,
+		Label:        label,
+		Trigger:      trigger,
+		Hash:         hash,
+		TableCount:   len(schema.Tables),
+		ObjectCount:  len(schema.Objects),
+	}
+
+	query := `INSERT INTO schema_snapshots (connection_id, db_name, label, "trigger", hash, table_count, object_count, schema) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at`
+	err = c.DB.QueryRow(query, connectionID, dbName, label, trigger, hash, snapshot.TableCount, snapshot.ObjectCount, string(schemaJSON)).Scan(&snapshot.ID, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to save schema snapshot")
+	}
+
+	return &snapshot, nil
+}
+
+// TakeSchemaSnapshot records the current schema of an active database
+func (c *Connections) TakeSchemaSnapshot(activePoolID uuid.UUID, connectionID int64, dbName, label string) (*model.SchemaSnapshot, error) {
+	return c.recordSchemaSnapshot(context.Background(), activePoolID, connectionID, dbName, label, model.SnapshotTriggerManual)
+}
+
+// Take a snapshot in the background after connecting, if enabled for the connection
+func (c *Connections) snapshotOnConnect(activePoolID uuid.UUID, connectionID int64, dbName string) {
+	enabled, err := c.GetSnapshotOnConnect(connectionID)
+	if err != nil {
+		log.Printf("failed to read schema snapshot settings: %v", err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	go func() {
+		_, err := c.recordSchemaSnapshot(context.Background(), activePoolID, connectionID, dbName, "", model.SnapshotTriggerConnect)
+		if err != nil {
+			log.Printf("failed to take schema snapshot on connect: %v", err)
+		}
+	}()
+}
+
+// SetSnapshotOnConnect enables or disables schema snapshots whenever a database of the connection is connected
+func (c *Connections) SetSnapshotOnConnect(connectionID int64, enabled bool) error {
+	query := `INSERT INTO schema_snapshot_settings (connection_id, on_connect) VALUES (?, ?) ON CONFLICT (connection_id) DO UPDATE SET on_connect = excluded.on_connect`
+	_, err := c.DB.Exec(query, connectionID, enabled)
+	return err
+}
+
+func (c *Connections) GetSnapshotOnConnect(connectionID int64) (bool, error) {
+	var enabled bool
+	err := c.DB.QueryRow(`SELECT on_connect FROM schema_snapshot_settings WHERE connection_id = ?`, connectionID).Scan(&enabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// GetSchemaSnapshots lists the snapshots of a database, newest first
+func (c *Connections) GetSchemaSnapshots(connectionID int64, dbName string) ([]model.SchemaSnapshot, error) {
+	query := `SELECT id, connection_id, db_name, label, "trigger", hash, table_count, object_count, created_at FROM schema_snapshots WHERE connection_id = ? AND db_name = ? ORDER BY id DESC`
+	rows, err := c.DB.Query(query, connectionID, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []model.SchemaSnapshot
+	for rows.Next() {
+		var s model.SchemaSnapshot
+		err := rows.Scan(&s.ID, &s.ConnectionID, &s.DBName, &s.Label, &s.Trigger, &s.Hash, &s.TableCount, &s.ObjectCount, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+func (c *Connections) DeleteSchemaSnapshot(id int64) error {
+	_, err := c.DB.Exec(`DELETE FROM schema_snapshots WHERE id = ?`, id)
+	return err
+}
+
+// Load the schema recorded by a snapshot
+func (c *Connections) loadSnapshotSchema(id int64) (*model.SchemaModel, error) {
+	var schemaJSON string
+	err := c.DB.QueryRow(`SELECT schema FROM schema_snapshots WHERE id = ?`, id).Scan(&schemaJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Errorf("schema snapshot %d does not exist", id)
+		}
+		return nil, err
+	}
+
+	var schema model.SchemaModel
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+// DiffSchemaSnapshots reports what changed from one snapshot to another. Added means added since
+// the first snapshot and the SQL migrates the first schema to the second.
+func (c *Connections) DiffSchemaSnapshots(fromID, toID int64) (*model.SchemaDiff, error) {
+	from, err := c.loadSnapshotSchema(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := c.loadSnapshotSchema(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSchemaModels(to, from), nil
+}
+
+// DiffSchemaSnapshotWithDatabase reports what changed in an active database since a snapshot
+func (c *Connections) DiffSchemaSnapshotWithDatabase(snapshotID int64, activePoolID uuid.UUID) (*model.SchemaDiff, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	from, err := c.loadSnapshotSchema(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := loadSchemaModel(context.Background(), pool, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSchemaModels(current, from), nil
+}
@@ -0,0 +1,754 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"dbmx/model"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Rows of a subset when no maximum is given
+	defaultSubsetMaxRows = 10000
+	// Values matched per query when following foreign keys
+	subsetLookupBatch = 500
+	// Rows per INSERT statement of a subset
+	subsetInsertBatch = 100
+)
+
+type subsetRow struct {
+	values map[string]*string
+	// Lowest depth the rows referencing this row were followed from, -1 when they weren't
+	childDepth int
+}
+
+// subsetTable holds the rows of a table collected into a subset
+type subsetTable struct {
+	schema string
+	name   string
+	// Columns copied, stored generated columns are left out
+	columns []model.ColumnInfo
+	// Every column, filters can use generated columns too
+	allColumns []model.ColumnInfo
+	primaryKey []string
+	// Primary key, or every column of tables without one, to tell rows apart
+	key []string
+
+	rows  []subsetRow
+	index map[string]int
+
+	// Foreign keys of the table and of the tables referencing it
+	parents  []foreignKeyRef
+	children []foreignKeyRef
+}
+
+// Identity of a tuple of text values, NULL differs from every string
+func valuesKey(values []*string) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		if value == nil {
+			parts[i] = "\x01"
+		} else {
+			parts[i] = *value
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (t *subsetTable) values(row map[string]*string, columns []string) []*string {
+	values := make([]*string, len(columns))
+	for i, column := range columns {
+		values[i] = row[column]
+	}
+	return values
+}
+
+func (t *subsetTable) qualifiedName() string {
+	return quoteQualified(t.schema, t.name)
+}
+
+// subsetWalker collects the rows of a subset by following foreign keys
+type subsetWalker struct {
+	ctx     context.Context
+	q       querier
+	maxRows int
+
+	tables map[string]*subsetTable
+	// Tables in the order they were reached
+	order     []*subsetTable
+	totalRows int
+}
+
+// Load the columns, key and foreign keys of a table the first time it's reached
+func (w *subsetWalker) table(schema, name string) (*subsetTable, error) {
+	key := quoteQualified(schemaOrDefault(schema), name)
+	if t, ok := w.tables[key]; ok {
+		return t, nil
+	}
+
+	t := &subsetTable{schema: schemaOrDefault(schema), name: name, index: make(map[string]int)}
+	columns, err := getTableColumns(w.ctx, w.q, t.schema, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", key)
+	}
+	t.allColumns = columns
+	for _, column := range columns {
+		if !column.IsGenerated {
+			t.columns = append(t.columns, column)
+		}
+	}
+
+	t.primaryKey, err = getPrimaryKeyColumns(w.ctx, w.q, t.schema, name)
+	if err != nil {
+		return nil, err
+	}
+	t.key = t.primaryKey
+	if len(t.key) == 0 {
+		for _, column := range t.columns {
+			t.key = append(t.key, column.Name)
+		}
+	}
+
+	if t.parents, err = loadForeignKeys(w.ctx, w.q, t.schema, name, false); err != nil {
+		return nil, err
+	}
+	if t.children, err = loadForeignKeys(w.ctx, w.q, t.schema, name, true); err != nil {
+		return nil, err
+	}
+
+	w.tables[key] = t
+	w.order = append(w.order, t)
+	return t, nil
+}
+
+// fetch adds the rows of a table matching a filter. It returns the matched rows and the rows
+// which weren't in the subset yet.
+func (w *subsetWalker) fetch(t *subsetTable, filter model.TableFilter) (matched, added []int, err error) {
+	tq, err := compileTableFilter(t.schema, t.name, t.allColumns, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selectList := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		selectList[i] = quoteIdent(column.Name) + "::text"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectList, ", "), tq.table)
+	if tq.where != "" {
+		query += " WHERE " + tq.where
+	}
+
+	rows, err := w.q.Query(w.ctx, query, tq.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]*string, len(t.columns))
+		dest := make([]any, len(t.columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make(map[string]*string, len(t.columns))
+		for i, column := range t.columns {
+			row[column.Name] = values[i]
+		}
+
+		key := valuesKey(t.values(row, t.key))
+		i, ok := t.index[key]
+		if !ok {
+			w.totalRows++
+			if w.totalRows > w.maxRows {
+				return nil, nil, fmt.Errorf("the subset has more than %d rows, lower the depth or narrow the seed rows", w.maxRows)
+			}
+			i = len(t.rows)
+			t.rows = append(t.rows, subsetRow{values: row, childDepth: -1})
+			t.index[key] = i
+			added = append(added, i)
+		}
+		matched = append(matched, i)
+	}
+
+	return matched, added, rows.Err()
+}
+
+// fetchMatching adds the rows of a table whose columns hold one of the tuples
+func (w *subsetWalker) fetchMatching(t *subsetTable, columns []string, tuples [][]string) (matched, added []int, err error) {
+	for start := 0; start < len(tuples); start += subsetLookupBatch {
+		batch := tuples[start:min(start+subsetLookupBatch, len(tuples))]
+
+		var filter model.TableFilter
+		if len(columns) == 1 {
+			values := make([]string, len(batch))
+			for i, tuple := range batch {
+				values[i] = tuple[0]
+			}
+			filter = model.TableFilter{Mode: model.FilterModeStructured, Where: model.FilterGroup{
+				Op:         "AND",
+				Conditions: []model.FilterCondition{{Column: columns[0], Operator: "in", Values: values}},
+			}}
+		} else {
+			filter = model.TableFilter{Mode: model.FilterModeStructured, Where: model.FilterGroup{Op: "OR"}}
+			for _, tuple := range batch {
+				filter.Where.Groups = append(filter.Where.Groups, equalityFilter(columns, tuple).Where)
+			}
+		}
+
+		batchMatched, batchAdded, err := w.fetch(t, filter)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read rows of %s", t.qualifiedName())
+		}
+		matched = append(matched, batchMatched...)
+		added = append(added, batchAdded...)
+	}
+
+	return matched, added, nil
+}
+
+// Distinct tuples of the values of columns of rows, tuples with a NULL reference nothing
+func distinctTuples(t *subsetTable, rows []int, columns []string) [][]string {
+	seen := make(map[string]bool)
+	var tuples [][]string
+	for _, i := range rows {
+		values := t.values(t.rows[i].values, columns)
+		tuple := make([]string, len(values))
+		complete := true
+		for j, value := range values {
+			if value == nil {
+				complete = false
+				break
+			}
+			tuple[j] = *value
+		}
+		key := valuesKey(values)
+		if complete && !seen[key] {
+			seen[key] = true
+			tuples = append(tuples, tuple)
+		}
+	}
+	return tuples
+}
+
+// walk follows the foreign keys from the seed rows. The rows a row references are always
+// followed, the rows referencing a row only from the seed rows and the rows reached that way,
+// up to depth hops.
+func (w *subsetWalker) walk(seed *subsetTable, seedRows []int, depth int) error {
+	type step struct {
+		table    *subsetTable
+		rows     []int
+		depth    int
+		children bool
+	}
+
+	queue := []step{{table: seed, rows: seedRows, depth: 0, children: true}}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, fk := range s.table.parents {
+			tuples := distinctTuples(s.table, s.rows, fk.columns)
+			if len(tuples) == 0 {
+				continue
+			}
+			parent, err := w.table(fk.referencedSchema, fk.referencedTable)
+			if err != nil {
+				return err
+			}
+			_, added, err := w.fetchMatching(parent, fk.referencedColumns, tuples)
+			if err != nil {
+				return err
+			}
+			if len(added) > 0 {
+				queue = append(queue, step{table: parent, rows: added, depth: s.depth})
+			}
+		}
+
+		if !s.children || s.depth >= depth {
+			continue
+		}
+
+		// Rows already followed from a lower depth reached their children already
+		var rows []int
+		for _, i := range s.rows {
+			row := &s.table.rows[i]
+			if row.childDepth == -1 || row.childDepth > s.depth {
+				row.childDepth = s.depth
+				rows = append(rows, i)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		for _, fk := range s.table.children {
+			tuples := distinctTuples(s.table, rows, fk.referencedColumns)
+			if len(tuples) == 0 {
+				continue
+			}
+			child, err := w.table(fk.schema, fk.table)
+			if err != nil {
+				return err
+			}
+			matched, _, err := w.fetchMatching(child, fk.columns, tuples)
+			if err != nil {
+				return err
+			}
+			if len(matched) > 0 {
+				queue = append(queue, step{table: child, rows: matched, depth: s.depth + 1, children: true})
+			}
+		}
+	}
+
+	return nil
+}
+
+// ordered returns the tables referenced tables first, with the rows of self referencing tables
+// ordered the same way. Rows of tables referencing each other in a cycle may still violate
+// foreign keys which aren't deferred.
+func (w *subsetWalker) ordered() []*subsetTable {
+	keys := make([]string, len(w.order))
+	dependencies := make(map[string][]string, len(w.order))
+	for i, t := range w.order {
+		keys[i] = t.qualifiedName()
+		for _, fk := range t.parents {
+			parent := quoteQualified(fk.referencedSchema, fk.referencedTable)
+			if parent != keys[i] {
+				dependencies[keys[i]] = append(dependencies[keys[i]], parent)
+			}
+		}
+	}
+
+	tables := make([]*subsetTable, 0, len(w.order))
+	for _, key := range orderByDependencies(keys, dependencies) {
+		t := w.tables[key]
+		if len(t.rows) > 0 {
+			t.orderSelfReferences()
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// Order the rows of a table so that rows come after the rows of the table they reference
+func (t *subsetTable) orderSelfReferences() {
+	rowIDs := make([]int, len(t.rows))
+	for i := range t.rows {
+		rowIDs[i] = i
+	}
+
+	dependencies := make(map[int][]int)
+	for _, fk := range t.parents {
+		if fk.referencedSchema != t.schema || fk.referencedTable != t.name {
+			continue
+		}
+		referenced := make(map[string]int, len(t.rows))
+		for i, row := range t.rows {
+			referenced[valuesKey(t.values(row.values, fk.referencedColumns))] = i
+		}
+		for i, row := range t.rows {
+			values := t.values(row.values, fk.columns)
+			if slices.Contains(values, nil) {
+				continue
+			}
+			if j, ok := referenced[valuesKey(values)]; ok && j != i {
+				dependencies[i] = append(dependencies[i], j)
+			}
+		}
+	}
+	if len(dependencies) == 0 {
+		return
+	}
+
+	rows := make([]subsetRow, 0, len(t.rows))
+	for _, i := range orderByDependencies(rowIDs, dependencies) {
+		rows = append(rows, t.rows[i])
+	}
+	t.rows = rows
+}
+
+// maskValue scrubs a value according to a masking rule, NULL stays NULL but with the null strategy
+func maskValue(rule model.MaskRule, value *string) *string {
+	if rule.Strategy == model.MaskNull {
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+
+	switch rule.Strategy {
+	case model.MaskFixed:
+		masked := rule.Value
+		return &masked
+	case model.MaskHash, model.MaskEmail:
+		sum := sha256.Sum256([]byte(*value))
+		masked := hex.EncodeToString(sum[:])[:16]
+		if rule.Strategy == model.MaskEmail {
+			masked = "user_" + masked[:12] + "@example.com"
+		}
+		return &masked
+	}
+	return value
+}
+
+// Check the masking rules and index them by table and column
+func subsetMasks(rules []model.MaskRule) (map[string]map[string]model.MaskRule, error) {
+	masks := make(map[string]map[string]model.MaskRule)
+	for _, rule := range rules {
+		switch rule.Strategy {
+		case model.MaskNull, model.MaskFixed, model.MaskHash, model.MaskEmail:
+		default:
+			return nil, fmt.Errorf("invalid mask strategy %s. Only null, fixed, hash and email are allowed.", rule.Strategy)
+		}
+		table := quoteQualified(schemaOrDefault(rule.Schema), rule.Table)
+		if masks[table] == nil {
+			masks[table] = make(map[string]model.MaskRule)
+		}
+		masks[table][rule.Column] = rule
+	}
+	return masks, nil
+}
+
+// Column types the hash and email masks can write into
+var textMaskTypes = map[string]bool{"text": true, "varchar": true, "bpchar": true, "citext": true, "name": true}
+
+// checkSubsetMasks checks that every rule applies to a column of the subset, that the masked
+// values fit their columns and that masked rows still match the rows they reference. Key columns only take the hash mask, it is spread to the columns
+// on the other side of their foreign keys so that both sides hash to the same values.
+func checkSubsetMasks(tables []*subsetTable, masks map[string]map[string]model.MaskRule) error {
+	byName := make(map[string]*subsetTable, len(tables))
+	for _, t := range tables {
+		byName[t.qualifiedName()] = t
+	}
+
+	// A rule of a table the walk never reached would silently mask nothing
+	for _, table := range slices.Sorted(maps.Keys(masks)) {
+		if _, ok := byName[table]; !ok {
+			return fmt.Errorf("mask rules of table %s don't apply, the table isn't part of the subset", table)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, t := range tables {
+			for _, fk := range t.parents {
+				parent, ok := byName[quoteQualified(fk.referencedSchema, fk.referencedTable)]
+				if !ok {
+					continue
+				}
+				for i, column := range fk.columns {
+					sides := []struct {
+						table  *subsetTable
+						column string
+					}{{t, column}, {parent, fk.referencedColumns[i]}}
+					for j, side := range sides {
+						rule, ok := masks[side.table.qualifiedName()][side.column]
+						if !ok {
+							continue
+						}
+						if rule.Strategy != model.MaskHash {
+							return fmt.Errorf("column %s of %s is part of foreign key %s, only the hash mask keeps it matching the referenced rows", side.column, side.table.qualifiedName(), fk.name)
+						}
+						other := sides[1-j]
+						if _, ok := masks[other.table.qualifiedName()][other.column]; ok {
+							continue
+						}
+						if masks[other.table.qualifiedName()] == nil {
+							masks[other.table.qualifiedName()] = make(map[string]model.MaskRule)
+						}
+						masks[other.table.qualifiedName()][other.column] = model.MaskRule{
+							Schema:   other.table.schema,
+							Table:    other.table.name,
+							Column:   other.column,
+							Strategy: model.MaskHash,
+						}
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, t := range tables {
+		for name, rule := range masks[t.qualifiedName()] {
+			index := slices.IndexFunc(t.columns, func(column model.ColumnInfo) bool { return column.Name == name })
+			if index == -1 {
+				return fmt.Errorf("column %s of mask rule doesn't exist in table %s", name, t.qualifiedName())
+			}
+			column := t.columns[index]
+
+			switch rule.Strategy {
+			case model.MaskHash, model.MaskEmail:
+				if !textMaskTypes[column.UDTName] {
+					return fmt.Errorf("the %s mask only applies to text columns, column %s of %s is %s", rule.Strategy, name, t.qualifiedName(), column.DataType)
+				}
+			case model.MaskFixed:
+				if _, err := coerceValue(column.UDTName, rule.Value); err != nil {
+					return fmt.Errorf("fixed mask of column %s of %s: %w", name, t.qualifiedName(), err)
+				}
+			case model.MaskNull:
+				if !column.IsNullable {
+					return fmt.Errorf("column %s of %s is NOT NULL, it can't be masked with null", name, t.qualifiedName())
+				}
+			}
+			if rule.Strategy != model.MaskHash && slices.Contains(t.primaryKey, name) {
+				return fmt.Errorf("column %s of %s is part of the primary key, only the hash mask keeps its values unique", name, t.qualifiedName())
+			}
+		}
+	}
+	return nil
+}
+
+// maskedRows returns the rows of a table with the masks of its columns applied
+func (t *subsetTable) maskedRows(masks map[string]map[string]model.MaskRule) []map[string]*string {
+	rules := masks[t.qualifiedName()]
+
+	rows := make([]map[string]*string, len(t.rows))
+	for i, row := range t.rows {
+		masked := make(map[string]*string, len(row.values))
+		for column, value := range row.values {
+			if rule, ok := rules[column]; ok {
+				value = maskValue(rule, value)
+			}
+			masked[column] = value
+		}
+		rows[i] = masked
+	}
+	return rows
+}
+
+func (t *subsetTable) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Render the INSERT statements of the rows of a table. Values are text literals the columns
+// read them from, identity columns keep their values.
+func subsetInsertSQL(t *subsetTable, rows []map[string]*string, onConflictDoNothing bool) []string {
+	columns := t.columnNames()
+	var statements []string
+	for start := 0; start < len(rows); start += subsetInsertBatch {
+		batch := rows[start:min(start+subsetInsertBatch, len(rows))]
+
+		values := make([]string, len(batch))
+		for i, row := range batch {
+			literals := make([]string, len(columns))
+			for j, column := range columns {
+				if value := row[column]; value != nil {
+					literals[j] = quoteLiteral(*value)
+				} else {
+					literals[j] = "NULL"
+				}
+			}
+			values[i] = "    (" + strings.Join(literals, ", ") + ")"
+		}
+
+		statement := fmt.Sprintf("INSERT INTO %s (%s) OVERRIDING SYSTEM VALUE VALUES\n%s", t.qualifiedName(), quoteColumns(columns), strings.Join(values, ",\n"))
+		if onConflictDoNothing {
+			statement += "\nON CONFLICT DO NOTHING"
+		}
+		statements = append(statements, statement+";\n")
+	}
+	return statements
+}
+
+// extractSubset collects the seed rows and the rows they need within one snapshot of a pool and
+// returns the tables in load order
+func (c *Connections) extractSubset(ctx context.Context, activePoolID uuid.UUID, opts model.SubsetOptions) ([]*subsetTable, string, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, "", errors.New("pool doesn't exist")
+	}
+	if strings.TrimSpace(opts.Table) == "" {
+		return nil, "", errors.New("table of the seed rows is required")
+	}
+	if opts.Depth < 0 {
+		return nil, "", errors.New("depth can't be negative")
+	}
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = defaultSubsetMaxRows
+	}
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, "", err
+	}
+	// The snapshot is only read
+	defer tx.Rollback(ctx)
+
+	var database string
+	if err := tx.QueryRow(ctx, "SELECT current_database()::text").Scan(&database); err != nil {
+		return nil, "", err
+	}
+
+	w := &subsetWalker{ctx: ctx, q: tx, maxRows: opts.MaxRows, tables: make(map[string]*subsetTable)}
+	seed, err := w.table(opts.Schema, opts.Table)
+	if err != nil {
+		return nil, "", err
+	}
+	seedRows, _, err := w.fetch(seed, opts.Filter)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to read the seed rows")
+	}
+	if len(seedRows) == 0 {
+		return nil, "", errors.New("the filter matches no seed rows")
+	}
+
+	if err := w.walk(seed, seedRows, opts.Depth); err != nil {
+		return nil, "", err
+	}
+
+	return w.ordered(), database, nil
+}
+
+func subsetResult(tables []*subsetTable) *model.SubsetResult {
+	result := &model.SubsetResult{Tables: []model.SubsetTable{}}
+	for _, t := range tables {
+		result.Tables = append(result.Tables, model.SubsetTable{Schema: t.schema, Name: t.name, Rows: len(t.rows)})
+		result.TotalRows += len(t.rows)
+	}
+	result.Message = fmt.Sprintf("%d rows of %d tables", result.TotalRows, len(result.Tables))
+	return result
+}
+
+// PreviewSubset lists the tables and row counts of the subset of a database starting at the seed
+// rows, referenced tables first
+func (c *Connections) PreviewSubset(activePoolID uuid.UUID, opts model.SubsetOptions) (*model.SubsetResult, error) {
+	tables, _, err := c.extractSubset(context.Background(), activePoolID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return subsetResult(tables), nil
+}
+
+// ExportSubset writes the subset starting at the seed rows to a file, as a SQL script of INSERT
+// statements or as JSON fixtures. Masks are applied to the written rows.
+func (c *Connections) ExportSubset(activePoolID uuid.UUID, opts model.SubsetOptions, format, path string) (*model.SubsetResult, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != model.SubsetFormatSQL && format != model.SubsetFormatJSON {
+		return nil, errors.New("invalid subset format. Only sql and json are allowed.")
+	}
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("export path is required")
+	}
+	masks, err := subsetMasks(opts.Masks)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, database, err := c.extractSubset(context.Background(), activePoolID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSubsetMasks(tables, masks); err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if format == model.SubsetFormatJSON {
+		fixtures := model.SubsetFixtures{Database: database, Tables: []model.SubsetFixturesTable{}}
+		for _, t := range tables {
+			rows := t.maskedRows(masks)
+			fixtures.Tables = append(fixtures.Tables, model.SubsetFixturesTable{Schema: t.schema, Name: t.name, Columns: t.columnNames(), Rows: rows})
+		}
+		content, err = json.MarshalIndent(fixtures, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("-- Subset of %s starting at %s\n\n", database, quoteQualified(schemaOrDefault(opts.Schema), opts.Table)))
+		b.WriteString("BEGIN;\nSET CONSTRAINTS ALL DEFERRED;\n")
+		for _, t := range tables {
+			rows := t.maskedRows(masks)
+			b.WriteString("\n-- " + t.qualifiedName() + "\n\n")
+			for _, statement := range subsetInsertSQL(t, rows, opts.OnConflictDoNothing) {
+				b.WriteString(statement)
+			}
+		}
+		b.WriteString("\nCOMMIT;\n")
+		content = []byte(b.String())
+	}
+
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return nil, err
+	}
+
+	result := subsetResult(tables)
+	result.Message = fmt.Sprintf("Exported %s to %s", result.Message, path)
+	return result, nil
+}
+
+// CopySubset inserts the subset starting at the seed rows into the existing tables of a target
+// pool within one transaction, referenced rows first. Masks are applied to the inserted rows. On
+// production the name of the target database has to be passed as confirmation.
+func (c *Connections) CopySubset(sourcePoolID, targetPoolID uuid.UUID, opts model.SubsetOptions, confirmation string) (*model.SubsetResult, error) {
+	target, exists := c.PM.GetPool(targetPoolID)
+	if !exists {
+		return nil, errors.New("target pool doesn't exist")
+	}
+	info, _ := c.PM.GetPoolInfo(targetPoolID)
+	if err := c.checkEnvSafety(targetPoolID, "copying a subset into "+info.DBName, info.DBName, confirmation); err != nil {
+		return nil, err
+	}
+	masks, err := subsetMasks(opts.Masks)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tables, _, err := c.extractSubset(ctx, sourcePoolID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSubsetMasks(tables, masks); err != nil {
+		return nil, err
+	}
+
+	tx, err := target.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SET CONSTRAINTS ALL DEFERRED"); err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		rows := t.maskedRows(masks)
+		for _, statement := range subsetInsertSQL(t, rows, opts.OnConflictDoNothing) {
+			if _, err := tx.Exec(ctx, statement); err != nil {
+				return nil, errors.Wrapf(err, "failed to insert rows of %s", t.qualifiedName())
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	result := subsetResult(tables)
+	result.Message = fmt.Sprintf("Copied %s into %s", result.Message, info.DBName)
+	return result, nil
+}
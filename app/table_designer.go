@@ -0,0 +1,694 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Referential actions of pg_constraint.confupdtype and confdeltype
+var referentialActions = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+// Defaults which are evaluated per row, adding a column with one rewrites the table
+var volatileDefault = regexp.MustCompile(`(?i)\b(nextval|random|clock_timestamp|timeofday|gen_random_uuid|uuid_generate_v[14])\s*\(`)
+
+// GetTableDesign loads an existing table into the table designer
+func (c *Connections) GetTableDesign(activePoolID uuid.UUID, schema, tableName string) (*model.TableDesign, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	design, _, err := loadTableDesign(context.Background(), pool, schema, tableName)
+	return design, err
+}
+
+// PreviewTableDesign renders the DDL which creates the designed table, or migrates the existing
+// table to the design, and flags the statements which rewrite or lock the table
+func (c *Connections) PreviewTableDesign(activePoolID uuid.UUID, design model.TableDesign) (*model.TableDesignPreview, error) {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return nil, errors.New("pool doesn't exist")
+	}
+
+	return previewTableDesign(context.Background(), pool, design)
+}
+
+// ApplyTableDesign runs the DDL of a design in a single transaction. The DDL is rendered again
+// inside the transaction and has to match the reviewed SQL, so a table changed since the preview
+// isn't migrated with statements nobody looked at.
+func (c *Connections) ApplyTableDesign(activePoolID uuid.UUID, design model.TableDesign, reviewedSQL string) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	preview, err := previewTableDesign(ctx, tx, design)
+	if err != nil {
+		return err
+	}
+	if preview.SQL != reviewedSQL {
+		return errors.New("the table changed since the DDL was previewed, review the DDL again")
+	}
+
+	for _, statement := range preview.Statements {
+		if _, err := tx.Exec(ctx, statement.SQL); err != nil {
+			return errors.Wrapf(err, "failed to run %s", statement.SQL)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// loadTableDesign reads a table into a design, it also returns the definition the design was built from
+func loadTableDesign(ctx context.Context, q querier, schema, tableName string) (*model.TableDesign, *model.TableDef, error) {
+	def, err := loadTableDef(ctx, q, schema, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	design := &model.TableDesign{Schema: def.Schema, Name: def.Name, OriginalName: def.Name, Comment: def.Comment}
+	for _, column := range def.Columns {
+		design.Columns = append(design.Columns, model.DesignColumn{
+			Name:         column.Name,
+			OriginalName: column.Name,
+			Type:         column.Type,
+			NotNull:      column.NotNull,
+			Default:      column.Default,
+			Identity:     column.Identity,
+			Generated:    column.Generated,
+			Collation:    column.Collation,
+			Comment:      column.Comment,
+		})
+	}
+
+	// Exclusion constraints aren't designed, they're kept as they are
+	query := `
+		SELECT
+			con.conname::text,
+			con.contype::text,
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			COALESCE(fn.nspname::text, ''),
+			COALESCE(f.relname::text, ''),
+			ARRAY(
+				SELECT a.attname::text
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			),
+			con.confupdtype::text,
+			con.confdeltype::text,
+			COALESCE(pg_get_expr(con.conbin, con.conrelid, true), '')
+		FROM pg_constraint con
+		LEFT JOIN pg_class f      ON f.oid = con.confrelid
+		LEFT JOIN pg_namespace fn ON fn.oid = f.relnamespace
+		WHERE con.conrelid = $1
+		  AND con.conislocal
+		  AND con.contype IN ('p', 'u', 'f', 'c')
+		ORDER BY con.conname;
+	`
+	rows, err := q.Query(ctx, query, def.OID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, contype, refSchema, refTable, onUpdate, onDelete, expression string
+		var columns, refColumns []string
+		err := rows.Scan(&name, &contype, &columns, &refSchema, &refTable, &refColumns, &onUpdate, &onDelete, &expression)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch contype {
+		case model.ConstraintPrimaryKey:
+			design.PrimaryKey = &model.DesignKey{Name: name, Columns: columns}
+		case model.ConstraintUnique:
+			design.UniqueKeys = append(design.UniqueKeys, model.DesignKey{Name: name, Columns: columns})
+		case model.ConstraintForeignKey:
+			design.ForeignKeys = append(design.ForeignKeys, model.DesignForeignKey{
+				Name:              name,
+				Columns:           columns,
+				ReferencedSchema:  refSchema,
+				ReferencedTable:   refTable,
+				ReferencedColumns: refColumns,
+				OnUpdate:          referentialActions[onUpdate],
+				OnDelete:          referentialActions[onDelete],
+			})
+		case model.ConstraintCheck:
+			design.Checks = append(design.Checks, model.DesignCheck{Name: name, Expression: expression})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var indexNames []string
+	for _, index := range def.Indexes {
+		indexNames = append(indexNames, index.Name)
+	}
+
+	// Key columns are returned as plain names, expressions as they're written
+	query = `
+		SELECT
+			i.relname::text,
+			am.amname::text,
+			idx.indisunique,
+			ARRAY(
+				SELECT CASE
+					WHEN idx.indkey[k.ord - 1] <> 0 THEN (
+						SELECT a.attname::text FROM pg_attribute a
+						WHERE a.attrelid = idx.indrelid AND a.attnum = idx.indkey[k.ord - 1]
+					)
+					ELSE pg_get_indexdef(idx.indexrelid, k.ord, true)
+				END
+				FROM generate_series(1, idx.indnkeyatts::int) AS k(ord)
+				ORDER BY k.ord
+			),
+			ARRAY(
+				SELECT a.attname::text
+				FROM generate_series(idx.indnkeyatts::int + 1, idx.indnatts::int) AS k(ord)
+				JOIN pg_attribute a ON a.attrelid = idx.indrelid AND a.attnum = idx.indkey[k.ord - 1]
+				ORDER BY k.ord
+			),
+			COALESCE(pg_get_expr(idx.indpred, idx.indrelid, true), '')
+		FROM pg_index idx
+		JOIN pg_class i ON i.oid = idx.indexrelid
+		JOIN pg_am am   ON am.oid = i.relam
+		WHERE idx.indrelid = $1
+		  AND i.relname = ANY($2)
+		ORDER BY i.relname;
+	`
+	rows, err = q.Query(ctx, query, def.OID, indexNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index model.DesignIndex
+		err := rows.Scan(&index.Name, &index.Method, &index.Unique, &index.Columns, &index.Include, &index.Where)
+		if err != nil {
+			return nil, nil, err
+		}
+		design.Indexes = append(design.Indexes, index)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return design, def, nil
+}
+
+func previewTableDesign(ctx context.Context, q querier, design model.TableDesign) (*model.TableDesignPreview, error) {
+	design.Schema = schemaOrDefault(design.Schema)
+	if err := validateTableDesign(&design); err != nil {
+		return nil, err
+	}
+	nameDesignItems(&design)
+
+	preview := &model.TableDesignPreview{}
+	name := quoteQualified(design.Schema, design.Name)
+	m := &migration{}
+	var renames []string
+
+	if design.OriginalName == "" {
+		if _, err := lookupTableOID(ctx, q, design.Schema, design.Name); err == nil {
+			return nil, errors.Errorf("table %s already exists", name)
+		}
+
+		preview.Create = true
+		def := designTableDef(&design, nil, nil)
+		m.add(phaseCreateTables, createTableSQL(def, true))
+		for _, index := range def.Indexes {
+			m.add(phaseAddConstraints, index.Definition+";")
+		}
+		m.add(phaseComments, commentSQL("TABLE", name, def.Comment))
+		for _, column := range def.Columns {
+			m.add(phaseComments, commentSQL("COLUMN", name+"."+quoteIdent(column.Name), column.Comment))
+		}
+	} else {
+		currentDesign, current, err := loadTableDesign(ctx, q, design.Schema, design.OriginalName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Renames run first, the rest of the DDL is computed against the renamed table
+		oldName := quoteQualified(current.Schema, current.Name)
+		for _, column := range design.Columns {
+			if column.OriginalName == "" || column.OriginalName == column.Name {
+				continue
+			}
+			if !slices.ContainsFunc(current.Columns, func(c model.ColumnDef) bool { return c.Name == column.OriginalName }) {
+				return nil, errors.Errorf("column %s does not exist in %s", column.OriginalName, oldName)
+			}
+			renames = append(renames, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", oldName, quoteIdent(column.OriginalName), quoteIdent(column.Name)))
+			renameDesignColumn(current, currentDesign, column.OriginalName, column.Name)
+		}
+		if design.Name != current.Name {
+			renames = append(renames, fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", oldName, quoteIdent(design.Name)))
+			renameDesignTable(current, currentDesign, design.Name)
+		}
+
+		def := designTableDef(&design, current, currentDesign)
+		diff := &model.SchemaDiff{}
+		preview.Diff, _ = diffTables(def, current, m, diff)
+		preview.Warnings = diff.Warnings
+	}
+
+	statements := renames
+	for _, phase := range m.phases {
+		statements = append(statements, phase...)
+	}
+	for _, statement := range statements {
+		preview.Statements = append(preview.Statements, classifyDesignStatement(name, statement, preview.Create))
+	}
+	preview.SQL = strings.Join(statements, "\n")
+
+	return preview, nil
+}
+
+func validateTableDesign(design *model.TableDesign) error {
+	if design.Name == "" {
+		return errors.New("table name is required")
+	}
+	if len(design.Columns) == 0 {
+		return errors.New("a table needs at least one column")
+	}
+
+	columns := make(map[string]struct{}, len(design.Columns))
+	for _, column := range design.Columns {
+		if column.Name == "" {
+			return errors.New("column name is required")
+		}
+		if column.Type == "" {
+			return errors.Errorf("type of column %s is required", column.Name)
+		}
+		if _, ok := columns[column.Name]; ok {
+			return errors.Errorf("column %s is defined twice", column.Name)
+		}
+		columns[column.Name] = struct{}{}
+	}
+
+	keyColumns := func(kind string, names []string) error {
+		if len(names) == 0 {
+			return errors.Errorf("%s needs at least one column", kind)
+		}
+		for _, name := range names {
+			if _, ok := columns[name]; !ok {
+				return errors.Errorf("%s references unknown column %s", kind, name)
+			}
+		}
+		return nil
+	}
+
+	if design.PrimaryKey != nil {
+		if err := keyColumns("primary key", design.PrimaryKey.Columns); err != nil {
+			return err
+		}
+	}
+	for _, key := range design.UniqueKeys {
+		if err := keyColumns("unique key", key.Columns); err != nil {
+			return err
+		}
+	}
+	for _, fk := range design.ForeignKeys {
+		if err := keyColumns("foreign key", fk.Columns); err != nil {
+			return err
+		}
+		if fk.ReferencedTable == "" {
+			return errors.New("foreign key needs a referenced table")
+		}
+		if len(fk.ReferencedColumns) != len(fk.Columns) {
+			return errors.Errorf("foreign key on %s references %d columns instead of %d", strings.Join(fk.Columns, ", "), len(fk.ReferencedColumns), len(fk.Columns))
+		}
+		for _, action := range []string{fk.OnUpdate, fk.OnDelete} {
+			if !slices.Contains([]string{"", "NO ACTION", "RESTRICT", "CASCADE", "SET NULL", "SET DEFAULT"}, referentialAction(action)) {
+				return errors.Errorf("invalid referential action %s", action)
+			}
+		}
+	}
+	for _, check := range design.Checks {
+		if strings.TrimSpace(check.Expression) == "" {
+			return errors.New("check constraint needs an expression")
+		}
+	}
+	for _, index := range design.Indexes {
+		if len(index.Columns) == 0 {
+			return errors.New("index needs at least one column")
+		}
+		for _, column := range index.Include {
+			if _, ok := columns[column]; !ok {
+				return errors.Errorf("index includes unknown column %s", column)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Give unnamed constraints and indexes the names Postgres would generate
+func nameDesignItems(design *model.TableDesign) {
+	used := make(map[string]struct{})
+	for _, name := range designItemNames(design) {
+		used[name] = struct{}{}
+	}
+
+	name := func(parts ...string) string {
+		base := strings.Join(parts, "_")
+		name := base
+		for i := 1; ; i++ {
+			if _, ok := used[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		used[name] = struct{}{}
+		return name
+	}
+
+	if design.PrimaryKey != nil && design.PrimaryKey.Name == "" {
+		key := *design.PrimaryKey
+		key.Name = name(design.Name, "pkey")
+		design.PrimaryKey = &key
+	}
+	design.UniqueKeys = slices.Clone(design.UniqueKeys)
+	for i := range design.UniqueKeys {
+		if design.UniqueKeys[i].Name == "" {
+			design.UniqueKeys[i].Name = name(design.Name, strings.Join(design.UniqueKeys[i].Columns, "_"), "key")
+		}
+	}
+	design.ForeignKeys = slices.Clone(design.ForeignKeys)
+	for i := range design.ForeignKeys {
+		if design.ForeignKeys[i].Name == "" {
+			design.ForeignKeys[i].Name = name(design.Name, strings.Join(design.ForeignKeys[i].Columns, "_"), "fkey")
+		}
+	}
+	design.Checks = slices.Clone(design.Checks)
+	for i := range design.Checks {
+		if design.Checks[i].Name == "" {
+			design.Checks[i].Name = name(design.Name, "check")
+		}
+	}
+	design.Indexes = slices.Clone(design.Indexes)
+	for i := range design.Indexes {
+		if design.Indexes[i].Name == "" {
+			design.Indexes[i].Name = name(defaultIndexName(design.Name, design.Indexes[i].Columns))
+		}
+	}
+}
+
+func designItemNames(design *model.TableDesign) []string {
+	var names []string
+	if design.PrimaryKey != nil && design.PrimaryKey.Name != "" {
+		names = append(names, design.PrimaryKey.Name)
+	}
+	for _, key := range design.UniqueKeys {
+		names = append(names, key.Name)
+	}
+	for _, fk := range design.ForeignKeys {
+		names = append(names, fk.Name)
+	}
+	for _, check := range design.Checks {
+		names = append(names, check.Name)
+	}
+	for _, index := range design.Indexes {
+		names = append(names, index.Name)
+	}
+	return names
+}
+
+// Rename a column in the loaded table so it can be compared to the design
+func renameDesignColumn(current *model.TableDef, currentDesign *model.TableDesign, from, to string) {
+	rename := func(columns []string) {
+		for i := range columns {
+			if columns[i] == from {
+				columns[i] = to
+			}
+		}
+	}
+
+	for i := range current.Columns {
+		if current.Columns[i].Name == from {
+			current.Columns[i].Name = to
+		}
+	}
+	for i := range currentDesign.Columns {
+		if currentDesign.Columns[i].Name == from {
+			currentDesign.Columns[i].Name = to
+		}
+	}
+	if currentDesign.PrimaryKey != nil {
+		rename(currentDesign.PrimaryKey.Columns)
+	}
+	for _, key := range currentDesign.UniqueKeys {
+		rename(key.Columns)
+	}
+	for _, fk := range currentDesign.ForeignKeys {
+		rename(fk.Columns)
+		if fk.ReferencedSchema == currentDesign.Schema && fk.ReferencedTable == currentDesign.Name {
+			rename(fk.ReferencedColumns)
+		}
+	}
+	for _, index := range currentDesign.Indexes {
+		rename(index.Columns)
+	}
+}
+
+func renameDesignTable(current *model.TableDef, currentDesign *model.TableDesign, name string) {
+	for i, fk := range currentDesign.ForeignKeys {
+		if fk.ReferencedSchema == currentDesign.Schema && fk.ReferencedTable == currentDesign.Name {
+			currentDesign.ForeignKeys[i].ReferencedTable = name
+		}
+	}
+	current.Name = name
+	currentDesign.Name = name
+}
+
+func referentialAction(action string) string {
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "" {
+		return "NO ACTION"
+	}
+	return action
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func foreignKeyDefinition(fk model.DesignForeignKey) string {
+	definition := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", quoteColumns(fk.Columns), quoteQualified(schemaOrDefault(fk.ReferencedSchema), fk.ReferencedTable), quoteColumns(fk.ReferencedColumns))
+	if action := referentialAction(fk.OnUpdate); action != "NO ACTION" {
+		definition += " ON UPDATE " + action
+	}
+	if action := referentialAction(fk.OnDelete); action != "NO ACTION" {
+		definition += " ON DELETE " + action
+	}
+	return definition
+}
+
+func sameForeignKey(a, b model.DesignForeignKey) bool {
+	return slices.Equal(a.Columns, b.Columns) &&
+		schemaOrDefault(a.ReferencedSchema) == schemaOrDefault(b.ReferencedSchema) &&
+		a.ReferencedTable == b.ReferencedTable &&
+		slices.Equal(a.ReferencedColumns, b.ReferencedColumns) &&
+		referentialAction(a.OnUpdate) == referentialAction(b.OnUpdate) &&
+		referentialAction(a.OnDelete) == referentialAction(b.OnDelete)
+}
+
+func sameIndex(a, b model.DesignIndex) bool {
+	methodA, methodB := a.Method, b.Method
+	if methodA == "" {
+		methodA = "btree"
+	}
+	if methodB == "" {
+		methodB = "btree"
+	}
+	return slices.Equal(a.Columns, b.Columns) && slices.Equal(a.Include, b.Include) && a.Unique == b.Unique && methodA == methodB && a.Where == b.Where
+}
+
+// designTableDef turns a design into a table definition. Constraints and indexes which are the
+// same as in the current table keep their catalog definition, so the diff only touches what the
+// design changed. Settings the designer doesn't edit are taken from the current table.
+func designTableDef(design *model.TableDesign, current *model.TableDef, currentDesign *model.TableDesign) *model.TableDef {
+	def := &model.TableDef{Schema: design.Schema, Name: design.Name, Comment: design.Comment}
+	if currentDesign == nil {
+		currentDesign = &model.TableDesign{}
+	}
+
+	currentColumns := make(map[string]model.ColumnDef)
+	currentConstraints := make(map[string]model.ConstraintDef)
+	currentIndexes := make(map[string]model.IndexDef)
+	if current != nil {
+		def.OID = current.OID
+		def.Unlogged = current.Unlogged
+		def.PartitionBy = current.PartitionBy
+		def.PartitionOf = current.PartitionOf
+		def.PartitionBound = current.PartitionBound
+		def.Inherits = current.Inherits
+		def.Options = current.Options
+
+		for _, column := range current.Columns {
+			currentColumns[column.Name] = column
+		}
+		for _, constraint := range current.Constraints {
+			currentConstraints[constraint.Name] = constraint
+		}
+		for _, index := range current.Indexes {
+			currentIndexes[index.Name] = index
+		}
+	}
+
+	for _, column := range design.Columns {
+		def.Columns = append(def.Columns, model.ColumnDef{
+			Name:      column.Name,
+			Type:      column.Type,
+			NotNull:   column.NotNull,
+			Default:   column.Default,
+			Identity:  column.Identity,
+			Generated: column.Generated,
+			Collation: column.Collation,
+			Comment:   column.Comment,
+			Inherited: currentColumns[column.Name].Inherited,
+		})
+	}
+
+	addConstraint := func(name, contype, definition string, same bool, columns []string, references string) {
+		constraint := model.ConstraintDef{Name: name, Type: contype, Definition: definition, Columns: columns, References: references}
+		if currentConstraint, ok := currentConstraints[name]; ok {
+			constraint.Comment = currentConstraint.Comment
+			if same && currentConstraint.Type == contype {
+				constraint.Definition = currentConstraint.Definition
+			}
+		}
+		def.Constraints = append(def.Constraints, constraint)
+	}
+
+	if key := design.PrimaryKey; key != nil {
+		same := currentDesign.PrimaryKey != nil && currentDesign.PrimaryKey.Name == key.Name && slices.Equal(currentDesign.PrimaryKey.Columns, key.Columns)
+		addConstraint(key.Name, model.ConstraintPrimaryKey, "PRIMARY KEY ("+quoteColumns(key.Columns)+")", same, key.Columns, "")
+	}
+	for _, key := range design.UniqueKeys {
+		same := slices.ContainsFunc(currentDesign.UniqueKeys, func(k model.DesignKey) bool {
+			return k.Name == key.Name && slices.Equal(k.Columns, key.Columns)
+		})
+		addConstraint(key.Name, model.ConstraintUnique, "UNIQUE ("+quoteColumns(key.Columns)+")", same, key.Columns, "")
+	}
+	for _, check := range design.Checks {
+		same := slices.ContainsFunc(currentDesign.Checks, func(c model.DesignCheck) bool {
+			return c.Name == check.Name && c.Expression == check.Expression
+		})
+		addConstraint(check.Name, model.ConstraintCheck, "CHECK ("+check.Expression+")", same, nil, "")
+	}
+	if current != nil {
+		for _, constraint := range current.Constraints {
+			if constraint.Type == model.ConstraintExclusion {
+				def.Constraints = append(def.Constraints, constraint)
+			}
+		}
+	}
+	for _, fk := range design.ForeignKeys {
+		same := slices.ContainsFunc(currentDesign.ForeignKeys, func(f model.DesignForeignKey) bool {
+			return f.Name == fk.Name && sameForeignKey(f, fk)
+		})
+		references := quoteQualified(schemaOrDefault(fk.ReferencedSchema), fk.ReferencedTable)
+		addConstraint(fk.Name, model.ConstraintForeignKey, foreignKeyDefinition(fk), same, fk.Columns, references)
+	}
+
+	var columnNames []string
+	for _, column := range design.Columns {
+		columnNames = append(columnNames, column.Name)
+	}
+	for _, index := range design.Indexes {
+		indexDef := model.IndexDef{Name: index.Name, Definition: createIndexSQL(design.Schema, design.Name, columnNames, index, false), Method: index.Method, IsUnique: index.Unique, Columns: index.Columns}
+		if currentIndex, ok := currentIndexes[index.Name]; ok {
+			indexDef.Comment = currentIndex.Comment
+			if slices.ContainsFunc(currentDesign.Indexes, func(i model.DesignIndex) bool { return i.Name == index.Name && sameIndex(i, index) }) {
+				indexDef.Definition = currentIndex.Definition
+			}
+		}
+		def.Indexes = append(def.Indexes, indexDef)
+	}
+
+	return def
+}
+
+// Describe the lock a statement takes on the table and flag statements which rewrite the table
+// or hold a strong lock while scanning it. Statements creating a new table block nobody.
+func classifyDesignStatement(table, statement string, create bool) model.DesignStatement {
+	s := model.DesignStatement{SQL: statement, Lock: "ACCESS EXCLUSIVE"}
+	if create {
+		return s
+	}
+
+	switch {
+	case strings.HasPrefix(statement, "COMMENT ON "):
+		s.Lock = "SHARE UPDATE EXCLUSIVE"
+		return s
+	case strings.HasPrefix(statement, "CREATE INDEX "), strings.HasPrefix(statement, "CREATE UNIQUE INDEX "):
+		s.Lock = "SHARE"
+		s.Scan = true
+		s.Warning = "Builds the index under a SHARE lock, writes to the table are blocked until it finishes"
+		return s
+	case strings.HasPrefix(statement, "DROP INDEX "):
+		return s
+	}
+
+	action := strings.TrimPrefix(statement, "ALTER TABLE "+table+" ")
+	switch {
+	case strings.HasPrefix(action, "SET LOGGED"), strings.HasPrefix(action, "SET UNLOGGED"):
+		s.Rewrite = true
+		s.Warning = "Rewrites the table under an ACCESS EXCLUSIVE lock, reads and writes are blocked until it finishes"
+	case strings.HasPrefix(action, "ALTER COLUMN ") && strings.Contains(action, " TYPE "):
+		s.Rewrite = true
+		s.Warning = "Rewrites the table and its indexes under an ACCESS EXCLUSIVE lock unless the types are binary compatible, reads and writes are blocked until it finishes"
+	case strings.HasPrefix(action, "ALTER COLUMN ") && strings.HasSuffix(action, " SET NOT NULL;"):
+		s.Scan = true
+		s.Warning = "Scans the table under an ACCESS EXCLUSIVE lock, reads and writes are blocked until it finishes"
+	case strings.HasPrefix(action, "ADD COLUMN "):
+		if strings.Contains(action, " GENERATED ALWAYS AS (") || strings.Contains(action, " AS IDENTITY") || volatileDefault.MatchString(action) {
+			s.Rewrite = true
+			s.Warning = "Fills the column for every row by rewriting the table under an ACCESS EXCLUSIVE lock, reads and writes are blocked until it finishes"
+		}
+	case strings.HasPrefix(action, "ADD CONSTRAINT ") && strings.Contains(action, " FOREIGN KEY "):
+		s.Lock = "SHARE ROW EXCLUSIVE"
+		s.Scan = true
+		s.Warning = "Validates every row under a SHARE ROW EXCLUSIVE lock on both tables, writes are blocked until it finishes"
+	case strings.HasPrefix(action, "ADD CONSTRAINT "):
+		s.Scan = true
+		s.Warning = "Validates every row under an ACCESS EXCLUSIVE lock, reads and writes are blocked until it finishes"
+	}
+
+	return s
+}
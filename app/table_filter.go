@@ -0,0 +1,235 @@
+package app
+
+import (
+	"dbmx/model"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// Comparison operators of a filter condition and their SQL
+var filterOperators = map[string]string{
+	"=":         "=",
+	"!=":        "<>",
+	"<>":        "<>",
+	"<":         "<",
+	"<=":        "<=",
+	">":         ">",
+	">=":        ">=",
+	"like":      "LIKE",
+	"not like":  "NOT LIKE",
+	"ilike":     "ILIKE",
+	"not ilike": "NOT ILIKE",
+}
+
+// tableQuery holds the clauses of a table tab query. Structured filters only contain quoted
+// identifiers and placeholders, their values are in args.
+type tableQuery struct {
+	table      string
+	selectList string
+	where      string
+	groupBy    string
+	orderBy    string
+	args       []any
+}
+
+func (q *tableQuery) rowsSQL(limit, offset int) string {
+	query := fmt.Sprintf("SELECT %s FROM %s", q.selectList, q.table)
+	if q.where != "" {
+		query += " WHERE " + q.where
+	}
+	if q.groupBy != "" {
+		query += " GROUP BY " + q.groupBy
+	}
+	if q.orderBy != "" {
+		query += " ORDER BY " + q.orderBy
+	} else {
+		query += " ORDER BY 1"
+	}
+	query += fmt.Sprintf(" LIMIT %d", limit)
+	if offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return query
+}
+
+func (q *tableQuery) countSQL() string {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", q.table)
+	if q.where != "" {
+		query += " WHERE " + q.where
+	}
+	if q.groupBy != "" {
+		query += " GROUP BY " + q.groupBy
+	}
+	return query
+}
+
+// compileTableFilter builds the query of a table tab. Columns are only needed for structured filters.
+func compileTableFilter(schema, tableName string, columns []model.ColumnInfo, filter model.TableFilter) (*tableQuery, error) {
+	q := &tableQuery{table: qualifiedTableName(schema, tableName)}
+
+	if filter.Mode == model.FilterModeRaw {
+		q.selectList = strings.TrimSpace(filter.RawSelect)
+		if q.selectList == "" {
+			q.selectList = "*"
+		}
+		q.where = strings.TrimSpace(filter.RawWhere)
+		q.orderBy = strings.TrimSpace(filter.RawOrderBy)
+		q.groupBy = strings.TrimSpace(filter.RawGroupBy)
+		return q, nil
+	}
+
+	if filter.Mode != model.FilterModeStructured && filter.Mode != "" {
+		return nil, fmt.Errorf("invalid filter mode %s. Only structured and raw are allowed.", filter.Mode)
+	}
+
+	columnsByName := make(map[string]model.ColumnInfo, len(columns))
+	for _, column := range columns {
+		columnsByName[column.Name] = column
+	}
+
+	q.selectList = "*"
+	if len(filter.Columns) > 0 {
+		selected := make([]string, len(filter.Columns))
+		for i, column := range filter.Columns {
+			if _, ok := columnsByName[column]; !ok {
+				return nil, fmt.Errorf("column %s does not exist in table %s", column, tableName)
+			}
+			selected[i] = pgx.Identifier{column}.Sanitize()
+		}
+		q.selectList = strings.Join(selected, ", ")
+	}
+
+	where, err := q.compileGroup(filter.Where, columnsByName)
+	if err != nil {
+		return nil, err
+	}
+	q.where = where
+
+	var orderBy []string
+	for _, sort := range filter.Sort {
+		if _, ok := columnsByName[sort.Column]; !ok {
+			return nil, fmt.Errorf("column %s does not exist in table %s", sort.Column, tableName)
+		}
+		direction := "ASC"
+		if sort.Descending {
+			direction = "DESC"
+		}
+		orderBy = append(orderBy, pgx.Identifier{sort.Column}.Sanitize()+" "+direction)
+	}
+	q.orderBy = strings.Join(orderBy, ", ")
+
+	return q, nil
+}
+
+// Add a bind parameter and return its placeholder
+func (q *tableQuery) bind(value any) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *tableQuery) compileGroup(group model.FilterGroup, columns map[string]model.ColumnInfo) (string, error) {
+	op := strings.ToUpper(strings.TrimSpace(group.Op))
+	if op == "" {
+		op = "AND"
+	}
+	if op != "AND" && op != "OR" {
+		return "", fmt.Errorf("invalid filter group operator %s. Only AND and OR are allowed.", group.Op)
+	}
+
+	var parts []string
+	for _, condition := range group.Conditions {
+		part, err := q.compileCondition(condition, columns)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	for _, nested := range group.Groups {
+		part, err := q.compileGroup(nested, columns)
+		if err != nil {
+			return "", err
+		}
+		if part != "" {
+			parts = append(parts, "("+part+")")
+		}
+	}
+
+	return strings.Join(parts, " "+op+" "), nil
+}
+
+func (q *tableQuery) compileCondition(condition model.FilterCondition, columns map[string]model.ColumnInfo) (string, error) {
+	column, ok := columns[condition.Column]
+	if !ok {
+		return "", fmt.Errorf("column %s does not exist", condition.Column)
+	}
+	safeColumn := pgx.Identifier{column.Name}.Sanitize()
+
+	udtName := column.UDTName
+	if condition.Type != "" {
+		udtName = strings.ToLower(condition.Type)
+		if name, ok := paramTypeUDTNames[udtName]; ok {
+			udtName = name
+		}
+	}
+
+	value := func(raw string) (string, error) {
+		v, err := coerceValue(udtName, raw)
+		if err != nil {
+			return "", errors.Wrapf(err, "filter on %s", column.Name)
+		}
+		return q.bind(v), nil
+	}
+
+	operator := strings.ToLower(strings.TrimSpace(condition.Operator))
+	switch operator {
+	case "is null":
+		return safeColumn + " IS NULL", nil
+	case "is not null":
+		return safeColumn + " IS NOT NULL", nil
+	case "in", "not in":
+		if len(condition.Values) == 0 {
+			return "", fmt.Errorf("filter on %s: %s requires at least one value", column.Name, operator)
+		}
+		placeholders := make([]string, len(condition.Values))
+		for i, raw := range condition.Values {
+			placeholder, err := value(raw)
+			if err != nil {
+				return "", err
+			}
+			placeholders[i] = placeholder
+		}
+		return fmt.Sprintf("%s %s (%s)", safeColumn, strings.ToUpper(operator), strings.Join(placeholders, ", ")), nil
+	case "between":
+		if len(condition.Values) != 2 {
+			return "", fmt.Errorf("filter on %s: between requires two values", column.Name)
+		}
+		from, err := value(condition.Values[0])
+		if err != nil {
+			return "", err
+		}
+		to, err := value(condition.Values[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", safeColumn, from, to), nil
+	}
+
+	sqlOperator, ok := filterOperators[operator]
+	if !ok {
+		return "", fmt.Errorf("invalid filter operator %s", condition.Operator)
+	}
+
+	// Pattern matching works on the text representation of any column
+	if strings.Contains(sqlOperator, "LIKE") {
+		return fmt.Sprintf("%s::text %s %s", safeColumn, sqlOperator, q.bind(condition.Value)), nil
+	}
+
+	placeholder, err := value(condition.Value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", safeColumn, sqlOperator, placeholder), nil
+}
@@ -0,0 +1,539 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// Largest page of a keyset paginated table
+	maxKeysetPageSize = 1000
+
+	// Tables estimated below this many rows are counted exactly
+	exactCountThreshold = 50000
+)
+
+// keyColumn is a column of the keyset pagination key
+type keyColumn struct {
+	name       string
+	descending bool
+}
+
+// Get the keyset key of a table: the sort columns followed by the primary key columns.
+// Tables without primary key use ctid to tell rows with equal sort values apart.
+func getKeysetColumns(ctx context.Context, q querier, schema, tableName string, sort []model.SortColumn) ([]keyColumn, error) {
+	var keys []keyColumn
+	seen := make(map[string]struct{})
+	for _, s := range sort {
+		keys = append(keys, keyColumn{name: s.Column, descending: s.Descending})
+		seen[s.Column] = struct{}{}
+	}
+
+	pkColumns, err := getPrimaryKeyColumns(ctx, q, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkColumns) == 0 {
+		return append(keys, keyColumn{name: "ctid"}), nil
+	}
+
+	for _, column := range pkColumns {
+		if _, ok := seen[column]; !ok {
+			keys = append(keys, keyColumn{name: column})
+		}
+	}
+
+	return keys, nil
+}
+
+// Build the predicate selecting the rows after the cursor in key order, or before it when paging backward.
+// Columns sort with postgres defaults: ascending puts NULLs last, descending puts them first.
+func (q *tableQuery) keysetPredicate(keys []keyColumn, values []*string, backward bool) string {
+	var ors []string
+	for i, key := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			column := pgx.Identifier{keys[j].name}.Sanitize()
+			if values[j] == nil {
+				ands = append(ands, column+" IS NULL")
+			} else {
+				ands = append(ands, column+" = "+q.bind(*values[j]))
+			}
+		}
+
+		column := pgx.Identifier{key.name}.Sanitize()
+		descending := key.descending != backward
+		switch {
+		case !descending && values[i] == nil:
+			// Nothing sorts after a NULL in ascending order
+			continue
+		case !descending:
+			ands = append(ands, fmt.Sprintf("(%s > %s OR %s IS NULL)", column, q.bind(*values[i]), column))
+		case values[i] == nil:
+			ands = append(ands, column+" IS NOT NULL")
+		default:
+			ands = append(ands, column+" < "+q.bind(*values[i]))
+		}
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	if len(ors) == 0 {
+		return "false"
+	}
+	return strings.Join(ors, " OR ")
+}
+
+// countTableRows estimates the rows of a table query from the planner statistics.
+// Small tables are counted exactly since that is cheap.
+func countTableRows(ctx context.Context, pool *pgxpool.Pool, tq *tableQuery) (int64, bool, error) {
+	estimate := int64(-1)
+	if tq.where == "" && tq.groupBy == "" {
+		// reltuples is unknown for tables which were never vacuumed or analyzed: -1 since PG14 and
+		// 0 before. Autovacuum doesn't analyze partitioned tables, so their reltuples is unknown
+		// or stale. The planner estimate is used for all of them.
+		query := `
+			SELECT CASE WHEN relkind = 'p' OR reltuples <= 0 THEN -1 ELSE reltuples::bigint END
+			FROM pg_class
+			WHERE oid = $1::regclass
+		`
+		if err := pool.QueryRow(ctx, query, tq.table).Scan(&estimate); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if estimate < 0 {
+		query := fmt.Sprintf("EXPLAIN (FORMAT JSON) SELECT 1 FROM %s", tq.table)
+		if tq.where != "" {
+			query += " WHERE " + tq.where
+		}
+		if tq.groupBy != "" {
+			query += " GROUP BY " + tq.groupBy
+		}
+
+		var raw []byte
+		if err := pool.QueryRow(ctx, query, tq.args...).Scan(&raw); err != nil {
+			return 0, false, err
+		}
+		plan, err := parseExplainJSON(raw)
+		if err != nil {
+			return 0, false, err
+		}
+		estimate = int64(plan.Plan.EstimatedRows)
+	}
+
+	if estimate >= exactCountThreshold {
+		return estimate, true, nil
+	}
+
+	var totalRows int64
+	if err := pool.QueryRow(ctx, tq.countSQL(), tq.args...).Scan(&totalRows); err != nil {
+		return 0, false, err
+	}
+
+	return totalRows, false, nil
+}
+
+// GetTablePage returns a page of table rows using keyset pagination on the sort columns and the primary key.
+// A nil cursor returns the first page. The total row count is only returned for the first page.
+func (c *Connections) GetTablePage(activePoolID uuid.UUID, tabID int64, schema, tableName string, filter model.TableFilter, limit int, cursor *model.PageCursor) model.QueryResult {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return model.QueryResult{OK: false, Message: "pool doesn't exist"}
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > maxKeysetPageSize {
+		return model.QueryResult{OK: false, Message: fmt.Sprintf("limit cannot be greater than %d", maxKeysetPageSize)}
+	}
+
+	if filter.Mode == model.FilterModeRaw && (strings.TrimSpace(filter.RawOrderBy) != "" || strings.TrimSpace(filter.RawGroupBy) != "") {
+		return model.QueryResult{OK: false, Message: "keyset pagination is not available with a raw ORDER BY or GROUP BY"}
+	}
+
+	ctx := context.Background()
+	response := model.QueryResult{OK: true}
+
+	var tableColumns []model.ColumnInfo
+	if filter.Mode != model.FilterModeRaw {
+		var err error
+		tableColumns, err = getTableColumns(ctx, pool, schema, tableName)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
+	}
+
+	tq, err := compileTableFilter(schema, tableName, tableColumns, filter)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
+	}
+
+	var sort []model.SortColumn
+	if filter.Mode != model.FilterModeRaw {
+		sort = filter.Sort
+	}
+	keys, err := getKeysetColumns(ctx, pool, schema, tableName, sort)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
+	}
+	keyNames := make([]string, len(keys))
+	for i, key := range keys {
+		keyNames[i] = key.name
+	}
+
+	if cursor == nil {
+		totalRows, estimated, err := countTableRows(ctx, pool, tq)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
+		response.TotalRows = totalRows
+		response.TotalRowsEstimated = estimated
+		response.CurrentPage = 1
+	} else {
+		response.CurrentPage, response.CurrentPageEstimated, err = pageOfCursor(ctx, pool, tq, keys, cursor, limit)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
+	}
+
+	// The key values of every row are needed for the cursors
+	if tq.selectList != "*" || keyNames[len(keyNames)-1] == "ctid" {
+		selected := strings.Split(tq.selectList, ", ")
+		for _, key := range keyNames {
+			quoted := pgx.Identifier{key}.Sanitize()
+			if !containsString(selected, quoted) {
+				tq.selectList += ", " + quoted
+			}
+		}
+	}
+
+	// xmin of the rows guards their edits against concurrent changes
+	versioned := false
+	if filter.Mode != model.FilterModeRaw {
+		versioned, err = tq.withRowVersion(ctx, pool)
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
+	}
+
+	backward := false
+	if cursor != nil {
+		if strings.Join(cursor.Columns, ",") != strings.Join(keyNames, ",") || len(cursor.Values) != len(keys) {
+			return model.QueryResult{OK: false, Message: "the sort order has changed, please reload the first page"}
+		}
+		backward = cursor.Backward
+
+		predicate := tq.keysetPredicate(keys, cursor.Values, backward)
+		if tq.where != "" {
+			tq.where = "(" + tq.where + ") AND (" + predicate + ")"
+		} else {
+			tq.where = predicate
+		}
+	}
+
+	orderBy := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.descending != backward {
+			direction = "DESC"
+		}
+		orderBy[i] = pgx.Identifier{key.name}.Sanitize() + " " + direction
+	}
+	tq.orderBy = strings.Join(orderBy, ", ")
+
+	start := time.Now()
+
+	// One extra row tells whether there is another page
+	resultRows, err := pool.Query(ctx, tq.rowsSQL(limit+1, 0), tq.args...)
+	if err != nil {
+		return model.QueryResult{
+			OK:           true,
+			Message:      err.Error(),
+			RowsAffected: int64(0),
+			Columns:      []string{"Error"},
+			Failed:       true,
+			Rows:         [][]model.Cell{{model.Cell{Column: "Error", Value: err.Error()}}},
+		}
+	}
+	defer resultRows.Close()
+
+	fieldDescriptions := resultRows.FieldDescriptions()
+	columnNames := make([]string, len(fieldDescriptions))
+	for i, column := range fieldDescriptions {
+		columnNames[i] = string(column.Name)
+	}
+	if versioned {
+		columnNames = columnNames[:len(columnNames)-1]
+	}
+	response.Columns = columnNames
+
+	// Index of each key column in the result
+	keyIndexes := make([]int, len(keyNames))
+	for i, key := range keyNames {
+		keyIndexes[i] = -1
+		for j, column := range columnNames {
+			if column == key {
+				keyIndexes[i] = j
+			}
+		}
+		if keyIndexes[i] == -1 {
+			return model.QueryResult{OK: false, Message: fmt.Sprintf("key column %s is missing from the result", key)}
+		}
+	}
+
+	rowKeyReader, reason, err := newRowKeys(ctx, pool, schema, tableName, resultRows)
+	if err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
+	}
+	if rowKeyReader != nil {
+		response.TableSchema = schemaOrDefault(schema)
+		response.TableName = tableName
+		response.KeyColumns = rowKeyReader.columns
+	}
+	response.ReadOnlyReason = reason
+
+	typeMap := resultRows.Conn().TypeMap()
+
+	var rows [][]model.Cell
+	var keyValues [][]*string
+	var rowKeys []model.RowKey
+	var rowVersions []string
+
+	for resultRows.Next() {
+		row, err := resultRows.Values()
+		if err != nil {
+			return model.QueryResult{OK: false, Message: err.Error()}
+		}
+
+		var version string
+		if versioned {
+			row, version = splitRowVersion(row)
+		}
+
+		cells := make([]model.Cell, len(row))
+		for i, cell := range row {
+			cells[i] = model.Cell{Column: columnNames[i], Value: formatCellValue(cell)}
+		}
+
+		values := make([]*string, len(keyIndexes))
+		for i, index := range keyIndexes {
+			if row[index] == nil {
+				continue
+			}
+			text, err := typeMap.Encode(fieldDescriptions[index].DataTypeOID, pgtype.TextFormatCode, row[index], nil)
+			if err != nil {
+				return model.QueryResult{OK: false, Message: err.Error()}
+			}
+			value := string(text)
+			values[i] = &value
+		}
+
+		if rowKeyReader != nil {
+			key, err := rowKeyReader.key(row)
+			if err != nil {
+				return model.QueryResult{OK: false, Message: err.Error()}
+			}
+			rowKeys = append(rowKeys, key)
+		}
+
+		if versioned {
+			rowVersions = append(rowVersions, version)
+		}
+
+		rows = append(rows, cells)
+		keyValues = append(keyValues, values)
+	}
+
+	if err := resultRows.Err(); err != nil {
+		return model.QueryResult{OK: false, Message: err.Error()}
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+		keyValues = keyValues[:limit]
+		if rowKeys != nil {
+			rowKeys = rowKeys[:limit]
+		}
+		if rowVersions != nil {
+			rowVersions = rowVersions[:limit]
+		}
+	}
+
+	// A backward page is fetched in reverse order
+	if backward {
+		slices.Reverse(rowKeys)
+		slices.Reverse(rowVersions)
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+			keyValues[i], keyValues[j] = keyValues[j], keyValues[i]
+		}
+		response.HasPrevPage = hasMore
+		response.HasNextPage = true
+	} else {
+		response.HasNextPage = hasMore
+		response.HasPrevPage = cursor != nil
+	}
+
+	if len(rows) > 0 {
+		response.PrevCursor = &model.PageCursor{Columns: keyNames, Values: keyValues[0], Backward: true, Page: response.CurrentPage}
+		response.NextCursor = &model.PageCursor{Columns: keyNames, Values: keyValues[len(keyValues)-1], Page: response.CurrentPage}
+	}
+
+	response.Rows = rows
+	response.RowKeys = rowKeys
+	response.RowVersions = rowVersions
+	response.ExecutionTime = time.Since(start).Milliseconds()
+
+	c.saveTabPagination(tabID, response, cursor == nil)
+
+	return response
+}
+
+// pageOfCursor returns the page a cursor leads to. Cursors carry the page of their row, else the
+// page is derived from the rows before the row, which are estimated on big tables.
+func pageOfCursor(ctx context.Context, pool *pgxpool.Pool, tq *tableQuery, keys []keyColumn, cursor *model.PageCursor, limit int) (int64, bool, error) {
+	page, estimated := cursor.Page, false
+	if page <= 0 {
+		before := *tq
+		before.args = slices.Clone(tq.args)
+		predicate := before.keysetPredicate(keys, cursor.Values, true)
+		if before.where != "" {
+			before.where = "(" + before.where + ") AND (" + predicate + ")"
+		} else {
+			before.where = predicate
+		}
+
+		rows, rowsEstimated, err := countTableRows(ctx, pool, &before)
+		if err != nil {
+			return 0, false, err
+		}
+		page, estimated = rows/int64(limit)+1, rowsEstimated
+	}
+
+	if cursor.Backward {
+		return max(page-1, 1), estimated, nil
+	}
+	return page + 1, estimated, nil
+}
+
+// saveTabPagination saves the page and, when it was counted, the row count of a table read with
+// its tab so that a restored tab shows whether they are estimated
+func (c *Connections) saveTabPagination(tabID int64, result model.QueryResult, counted bool) {
+	var err error
+	if counted {
+		_, err = c.DB.Exec(
+			`UPDATE tabs SET total_rows = ?, total_rows_estimated = ?, current_page = ?, current_page_estimated = ? WHERE id = ?`,
+			result.TotalRows, result.TotalRowsEstimated, result.CurrentPage, result.CurrentPageEstimated, tabID,
+		)
+	} else {
+		_, err = c.DB.Exec(
+			`UPDATE tabs SET current_page = ?, current_page_estimated = ? WHERE id = ?`,
+			result.CurrentPage, result.CurrentPageEstimated, tabID,
+		)
+	}
+	if err != nil {
+		log.Printf("failed to save the page of tab %d: %v", tabID, err)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StartExactCount counts the rows of a table tab with COUNT(*) in the background.
+// The result is emitted as a tableRowCount event, a running count can be stopped with CancelExactCount.
+func (c *Connections) StartExactCount(activePoolID uuid.UUID, tabID int64, schema, tableName string, filter model.TableFilter) error {
+	pool, exists := c.PM.GetPool(activePoolID)
+	if !exists {
+		return errors.New("pool doesn't exist")
+	}
+
+	var tableColumns []model.ColumnInfo
+	if filter.Mode != model.FilterModeRaw {
+		var err error
+		tableColumns, err = getTableColumns(context.Background(), pool, schema, tableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	tq, err := compileTableFilter(schema, tableName, tableColumns, filter)
+	if err != nil {
+		return err
+	}
+
+	c.countMu.Lock()
+	if _, isRunning := c.exactCounts[tabID]; isRunning {
+		c.countMu.Unlock()
+		return errors.New("rows are already being counted for this tab")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.exactCounts[tabID] = cancel
+	c.countMu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			c.countMu.Lock()
+			delete(c.exactCounts, tabID)
+			c.countMu.Unlock()
+		}()
+
+		count := model.TableRowCount{TabID: tabID}
+		err := pool.QueryRow(ctx, tq.countSQL(), tq.args...).Scan(&count.TotalRows)
+		if errors.Is(err, context.Canceled) {
+			count.Canceled = true
+		} else if err != nil {
+			count.Error = err.Error()
+		}
+
+		if count.Error == "" && !count.Canceled {
+			_, err := c.DB.Exec(`UPDATE tabs SET total_rows = ?, total_rows_estimated = false WHERE id = ?`, count.TotalRows, tabID)
+			if err != nil {
+				log.Printf("failed to save the row count of tab %d: %v", tabID, err)
+			}
+		}
+
+		c.emit("tableRowCount", count)
+	}()
+
+	return nil
+}
+
+// CancelExactCount stops the background row count of a tab
+func (c *Connections) CancelExactCount(tabID int64) {
+	c.countMu.Lock()
+	defer c.countMu.Unlock()
+
+	if cancel, isRunning := c.exactCounts[tabID]; isRunning {
+		cancel()
+	}
+}
+
+// Emit an event to the frontend, events are dropped until the app has started
+func (c *Connections) emit(name string, data ...any) {
+	if c.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(c.ctx, name, data...)
+}
@@ -5,11 +5,53 @@ import (
 	"database/sql"
 	"dbmx/model"
 	"encoding/json"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+// Columns of the tabs table read by scanTab
+const tabColumns = `id, name, editor, output, is_active, active_db_id, active_db, active_db_color, type, connection_id, db_name, connection_name, "select", "limit", "offset", "where", "order_by", "group_by", table_columns, ai_chat, query_params, filter, schema, total_rows, total_rows_estimated, current_page, current_page_estimated`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Scan a row of tabColumns into a tab and decode its json columns
+func scanTab(row rowScanner) (model.Tab, error) {
+	var tab model.Tab
+	var aiChatJSON []byte
+	var queryParamsJSON, filterJSON string
+	err := row.Scan(&tab.ID, &tab.Name, &tab.Editor, &tab.Output, &tab.IsActive, &tab.ActiveDBID, &tab.ActiveDB, &tab.ActiveDBColor, &tab.Type, &tab.ConnectionID, &tab.DBName, &tab.ConnectionName, &tab.Select, &tab.Limit, &tab.Offset, &tab.Where, &tab.OrderBy, &tab.GroupBy, &tab.TableColumns, &aiChatJSON, &queryParamsJSON, &filterJSON, &tab.Schema, &tab.TotalRows, &tab.TotalRowsEstimated, &tab.CurrentPage, &tab.CurrentPageEstimated)
+	if err != nil {
+		return tab, err
+	}
+
+	if len(aiChatJSON) > 0 {
+		err = json.Unmarshal(aiChatJSON, &tab.AIChat)
+		if err != nil {
+			return tab, err
+		}
+	}
+
+	if len(queryParamsJSON) > 0 {
+		err = json.Unmarshal([]byte(queryParamsJSON), &tab.QueryParams)
+		if err != nil {
+			return tab, err
+		}
+	}
+
+	if len(filterJSON) > 0 {
+		err = json.Unmarshal([]byte(filterJSON), &tab.Filter)
+		if err != nil {
+			return tab, err
+		}
+	}
+
+	return tab, nil
+}
+
 type Tabs struct {
 	DB *sql.DB
 	PM *PoolManager
@@ -23,6 +65,11 @@ func NewTabs(db *sql.DB, pm *PoolManager) *Tabs {
 }
 
 func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType string, connID int64, dbName, connName string) (*model.Tab, error) {
+	return t.AddSchemaTab(activeDBID, activeDB, activeDBColor, defaultSchema, tableName, tabType, connID, dbName, connName)
+}
+
+// AddSchemaTab adds a tab, table tabs are identified by the schema and name of the table
+func (t *Tabs) AddSchemaTab(activeDBID, activeDB, activeDBColor, schema, tableName, tabType string, connID int64, dbName, connName string) (*model.Tab, error) {
 	var active_db_id, active_db, active_db_color *string
 
 	// Required for tab type table
@@ -33,6 +80,7 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 	var tableColumns []string
 
 	name := "Editor"
+	schema = schemaOrDefault(schema)
 
 	if tabType == "table" {
 		if connID == 0 {
@@ -51,6 +99,9 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 		conn_id = &connID
 		db_name = &dbName
 		name = tableName
+		if schema != defaultSchema {
+			name = schema + "." + tableName
+		}
 
 		// Get the columns of the table
 
@@ -69,9 +120,10 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 			SELECT column_name
 			FROM information_schema.columns
 			WHERE table_name = $1
-			  AND table_schema = 'public';
+			  AND table_schema = $2
+			ORDER BY ordinal_position;
 		`
-		rows, err := pool.Query(context.Background(), query, tableName)
+		rows, err := pool.Query(context.Background(), query, tableName, schema)
 		if err != nil {
 			return nil, err
 		}
@@ -87,6 +139,10 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 			tableColumns = append(tableColumns, column)
 		}
 
+		if len(tableColumns) == 0 {
+			return nil, fmt.Errorf("table %s.%s does not exist", schema, tableName)
+		}
+
 		// marshal the table columns into json
 		tableColumnsJSON, err := json.Marshal(tableColumns)
 		if err != nil {
@@ -96,6 +152,20 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 		tableColumnsString = string(tableColumnsJSON)
 	}
 
+	// ER diagrams belong to a database, their layout is saved per database
+	if tabType == "erd" {
+		if connID == 0 {
+			return nil, errors.New("connection id is required for tab type erd")
+		}
+		if dbName == "" {
+			return nil, errors.New("database name is required for tab type erd")
+		}
+
+		conn_id = &connID
+		db_name = &dbName
+		name = "ER Diagram - " + dbName
+	}
+
 	if activeDBID != "" {
 		active_db_id = &activeDBID
 	}
@@ -108,12 +178,12 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 	}
 
 	if !model.IsValidTabType(tabType) {
-		return nil, errors.New("invalid tab type. Only editor and table are allowed.")
+		return nil, errors.New("invalid tab type. Only editor, table and erd are allowed.")
 	}
 
 	// Insert a new active tab
-	query := `INSERT INTO tabs (name, editor, output, is_active, active_db_id, active_db, active_db_color, type, connection_id, db_name, connection_name, "select", "limit", "offset", "where", "order_by", "group_by", table_columns) VALUES (?, '', '', true, ?, ?, ?, ?, ?, ?, ?, '', '', '', '', '', '', ?);`
-	result, err := t.DB.Exec(query, name, active_db_id, active_db, active_db_color, tabType, conn_id, db_name, connName, tableColumnsString)
+	query := `INSERT INTO tabs (name, editor, output, is_active, active_db_id, active_db, active_db_color, type, connection_id, db_name, connection_name, "select", "limit", "offset", "where", "order_by", "group_by", table_columns, schema) VALUES (?, '', '', true, ?, ?, ?, ?, ?, ?, ?, '', '', '', '', '', '', ?, ?);`
+	result, err := t.DB.Exec(query, name, active_db_id, active_db, active_db_color, tabType, conn_id, db_name, connName, tableColumnsString, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +207,7 @@ func (t *Tabs) AddTab(activeDBID, activeDB, activeDBColor, tableName, tabType st
 		ActiveDB:         active_db,
 		ActiveDBColor:    active_db_color,
 		Type:             tabType,
+		Schema:           schema,
 		ConnectionID:     conn_id,
 		DBName:           db_name,
 		ConnectionName:   connName,
@@ -153,22 +224,13 @@ func (t *Tabs) SetActiveTab(id int64) (*model.Tab, error) {
 	}
 
 	// Write an update query to set is_active to true for the given tab
-	updateQuery = `UPDATE tabs SET is_active = true WHERE id = ? RETURNING *`
+	updateQuery = `UPDATE tabs SET is_active = true WHERE id = ? RETURNING ` + tabColumns
 
-	var tab model.Tab
-	var aiChatJSON []byte
-	err = t.DB.QueryRow(updateQuery, id).Scan(&tab.ID, &tab.Name, &tab.Editor, &tab.Output, &tab.IsActive, &tab.ActiveDBID, &tab.ActiveDB, &tab.ActiveDBColor, &tab.Type, &tab.ConnectionID, &tab.DBName, &tab.ConnectionName, &tab.Select, &tab.Limit, &tab.Offset, &tab.Where, &tab.OrderBy, &tab.GroupBy, &tab.TableColumns, &aiChatJSON)
+	tab, err := scanTab(t.DB.QueryRow(updateQuery, id))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(aiChatJSON) > 0 {
-		err = json.Unmarshal(aiChatJSON, &tab.AIChat)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	if len(tab.TableColumns) > 0 {
 		err = json.Unmarshal([]byte(tab.TableColumns), &tab.TableColumnsList)
 		if err != nil {
@@ -185,7 +247,7 @@ func (t *Tabs) SetActiveTab(id int64) (*model.Tab, error) {
 
 func (t *Tabs) GetAllTabs() ([]model.Tab, error) {
 	// Query for all tabs
-	query := `SELECT id, name, editor, output, is_active, active_db_id, active_db, active_db_color, type, connection_id, db_name, connection_name, "select", "limit", "offset", "where", "order_by", "group_by", table_columns, ai_chat FROM tabs`
+	query := `SELECT ` + tabColumns + ` FROM tabs`
 	rows, err := t.DB.Query(query)
 	if err != nil {
 		return nil, err
@@ -194,20 +256,11 @@ func (t *Tabs) GetAllTabs() ([]model.Tab, error) {
 
 	var tabs []model.Tab
 	for rows.Next() {
-		var tab model.Tab
-		var aiChatJSON []byte
-		err := rows.Scan(&tab.ID, &tab.Name, &tab.Editor, &tab.Output, &tab.IsActive, &tab.ActiveDBID, &tab.ActiveDB, &tab.ActiveDBColor, &tab.Type, &tab.ConnectionID, &tab.DBName, &tab.ConnectionName, &tab.Select, &tab.Limit, &tab.Offset, &tab.Where, &tab.OrderBy, &tab.GroupBy, &tab.TableColumns, &aiChatJSON)
+		tab, err := scanTab(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if len(aiChatJSON) > 0 {
-			err = json.Unmarshal(aiChatJSON, &tab.AIChat)
-			if err != nil {
-				return nil, err
-			}
-		}
-
 		if tab.IsActive {
 			if len(tab.TableColumns) > 0 {
 				err = json.Unmarshal([]byte(tab.TableColumns), &tab.TableColumnsList)
@@ -252,6 +305,57 @@ func (t *Tabs) UpdateTabEditorContent(id int64, editor string, selectQuery, limi
 	return nil
 }
 
+// Remember the parameter values of the editor query of a tab
+func (t *Tabs) UpdateTabQueryParams(id int64, params map[string]model.QueryParam) error {
+	paramsJSON := ""
+	if len(params) > 0 {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		paramsJSON = string(b)
+	}
+
+	query := `UPDATE tabs SET query_params = ? WHERE id = ?`
+	_, err := t.DB.Exec(query, paramsJSON, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Persist the structured filter of a table tab
+func (t *Tabs) UpdateTabFilter(id int64, filter model.TableFilter) error {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE tabs SET filter = ? WHERE id = ? AND type = 'table'`
+	_, err = t.DB.Exec(query, string(filterJSON), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// OpenFilteredTableTab adds a table tab with a filter already applied, e.g. to show the rows
+// found by following a foreign key
+func (t *Tabs) OpenFilteredTableTab(activeDBID, activeDB, activeDBColor, schema, tableName string, connID int64, dbName, connName string, filter model.TableFilter) (*model.Tab, error) {
+	tab, err := t.AddSchemaTab(activeDBID, activeDB, activeDBColor, schema, tableName, "table", connID, dbName, connName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.UpdateTabFilter(tab.ID, filter); err != nil {
+		return nil, err
+	}
+	tab.Filter = &filter
+
+	return tab, nil
+}
+
 func (t *Tabs) SaveActiveDBProps(id int64, activeDBID, activeDB, activeDBColor string) error {
 	var active_db_id, active_db, active_db_color *string
 	if activeDBID != "" {
@@ -0,0 +1,390 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"dbmx/model"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// Rows per COPY into the target table when no batch size is given
+const defaultTransferBatchSize = 10000
+
+// transferColumn is a column of a source table with what mapping its type needs
+type transferColumn struct {
+	name    string
+	typ     string
+	notNull bool
+	// pg_type.typtype of the type: b base, d domain, e enum, c composite, r range, m multirange
+	kind string
+	// Types of pg_catalog exist on every server
+	builtin bool
+	// Base type of a domain
+	baseType string
+	// Array of a type which isn't builtin
+	isUserArray bool
+}
+
+// typeMapper maps the column types of the source engine of a transfer to types of the target
+// engine. typeExists tells whether a type exists on the target.
+type typeMapper interface {
+	mapType(column transferColumn, typeExists func(string) (bool, error)) (string, error)
+}
+
+// Type mappers by source and target engine
+var typeMappers = map[[2]string]typeMapper{
+	{"postgresql", "postgresql"}: postgresTypeMapper{},
+}
+
+// postgresTypeMapper keeps the types which exist on the target. Missing domains become their
+// base type and other missing types text, rows are copied in COPY text format which every
+// type can be read from.
+type postgresTypeMapper struct{}
+
+func (postgresTypeMapper) mapType(column transferColumn, typeExists func(string) (bool, error)) (string, error) {
+	if column.builtin {
+		return column.typ, nil
+	}
+	exists, err := typeExists(column.typ)
+	if err != nil || exists {
+		return column.typ, err
+	}
+
+	if column.kind == "d" {
+		exists, err := typeExists(column.baseType)
+		if err != nil || exists {
+			return column.baseType, err
+		}
+	}
+	if column.isUserArray {
+		return "text[]", nil
+	}
+	return "text", nil
+}
+
+// Engine of the saved connection a pool belongs to
+func (c *Connections) poolEngine(activePoolID uuid.UUID) (string, error) {
+	info, exists := c.PM.GetPoolInfo(activePoolID)
+	if !exists {
+		return "", errors.New("pool doesn't exist")
+	}
+
+	var engine sql.NullString
+	err := c.DB.QueryRow(`SELECT engine FROM connections WHERE id = ?`, info.ConnectionID).Scan(&engine)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(engine.String)), nil
+}
+
+// Read the columns of a table, stored generated columns are left out since they can't be copied
+func loadTransferColumns(ctx context.Context, q querier, schema, tableName string) ([]transferColumn, error) {
+	oid, err := lookupTableOID(ctx, q, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			a.attname::text,
+			format_type(a.atttypid, a.atttypmod),
+			a.attnotnull,
+			t.typtype::text,
+			t.typnamespace = 'pg_catalog'::regnamespace,
+			CASE WHEN t.typtype = 'd' THEN format_type(t.typbasetype, t.typtypmod) ELSE '' END,
+			COALESCE(e.typnamespace <> 'pg_catalog'::regnamespace, false)
+		FROM pg_attribute a
+		JOIN pg_type t      ON t.oid = a.atttypid
+		LEFT JOIN pg_type e ON e.oid = t.typelem AND t.typcategory = 'A'
+		WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+		ORDER BY a.attnum;
+	`
+	rows, err := q.Query(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []transferColumn
+	for rows.Next() {
+		var column transferColumn
+		err := rows.Scan(&column.name, &column.typ, &column.notNull, &column.kind, &column.builtin, &column.baseType, &column.isUserArray)
+		if err != nil {
+			return nil, err
+		}
+		// The element type decides for arrays
+		if column.isUserArray {
+			column.builtin = false
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// createTransferTableSQL renders the CREATE TABLE statement of a missing target table with the
+// mapped column types and the primary key of the source. Defaults aren't copied, the sequences
+// and functions they use may not exist on the target.
+func createTransferTableSQL(mapper typeMapper, target model.TableRef, columns []transferColumn, primaryKey []string, typeExists func(string) (bool, error)) (string, error) {
+	lines := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		typ, err := mapper.mapType(column, typeExists)
+		if err != nil {
+			return "", err
+		}
+		line := "    " + quoteIdent(column.name) + " " + typ
+		if column.notNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	if len(primaryKey) > 0 {
+		lines = append(lines, "    PRIMARY KEY ("+quoteColumns(primaryKey)+")")
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n);", qualifiedTableName(target.Schema, target.Name), strings.Join(lines, ",\n")), nil
+}
+
+// copyBatchReader passes the rows of a COPY text stream through until a batch is full. Rows end
+// with a newline, newlines within values are escaped.
+type copyBatchReader struct {
+	src     *bufio.Reader
+	rows    int
+	limit   int
+	pending []byte
+}
+
+func (r *copyBatchReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.rows >= r.limit {
+			return 0, io.EOF
+		}
+		line, err := r.src.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return 0, err
+		}
+		r.pending = line
+		r.rows++
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// StartTableTransfer copies tables from the database of a source pool into the database of a
+// target pool, each table within its own target transaction. Missing target tables are created
+// with mapped types. Rows stream from COPY TO on the source into batches of COPY FROM on the
+// target, the source is read within one snapshot. The transfer runs as a background job which
+// is returned right away.
+func (c *Connections) StartTableTransfer(sourcePoolID, targetPoolID uuid.UUID, opts model.TransferOptions) (*model.Job, error) {
+	source, exists := c.PM.GetPool(sourcePoolID)
+	if !exists {
+		return nil, errors.New("source pool doesn't exist")
+	}
+	target, exists := c.PM.GetPool(targetPoolID)
+	if !exists {
+		return nil, errors.New("target pool doesn't exist")
+	}
+	if len(opts.Tables) == 0 {
+		return nil, errors.New("at least one table is required")
+	}
+
+	sourceEngine, err := c.poolEngine(sourcePoolID)
+	if err != nil {
+		return nil, err
+	}
+	targetEngine, err := c.poolEngine(targetPoolID)
+	if err != nil {
+		return nil, err
+	}
+	mapper, ok := typeMappers[[2]string{sourceEngine, targetEngine}]
+	if !ok {
+		return nil, fmt.Errorf("copying tables from %s to %s isn't supported", sourceEngine, targetEngine)
+	}
+
+	for i, table := range opts.Tables {
+		if strings.TrimSpace(table.Source.Name) == "" {
+			return nil, errors.New("source table name is required")
+		}
+		if table.Target.Name == "" {
+			opts.Tables[i].Target = table.Source
+		}
+		if table.Limit < 0 {
+			return nil, errors.New("limit can't be negative")
+		}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultTransferBatchSize
+	}
+
+	info, _ := c.PM.GetPoolInfo(targetPoolID)
+	if err := c.checkEnvSafety(targetPoolID, "copying tables into "+info.DBName, info.DBName, opts.Confirmation); err != nil {
+		return nil, err
+	}
+
+	j, ctx := c.startJob(model.JobKindTransfer, fmt.Sprintf("Copy of %d tables into %s", len(opts.Tables), info.DBName), sourcePoolID, targetPoolID)
+	jobInfo := j.info
+
+	go func() {
+		message, err := c.transferTables(ctx, j, mapper, source, target, opts)
+		c.finishJob(ctx, j, message, err)
+	}()
+
+	return &jobInfo, nil
+}
+
+func (c *Connections) transferTables(ctx context.Context, j *job, mapper typeMapper, source, target *pgxpool.Pool, opts model.TransferOptions) (string, error) {
+	sourceTx, err := source.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", err
+	}
+	// The snapshot is only read, the context may be cancelled already
+	defer sourceTx.Rollback(context.Background())
+
+	var rows int64
+	var done []string
+	for i, table := range opts.Tables {
+		name := schemaOrDefault(table.Source.Schema) + "." + table.Source.Name
+		j.step(name, i, len(opts.Tables))
+
+		copied, err := c.transferTable(ctx, j, mapper, sourceTx, target, table, opts)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to copy %s", name)
+			if len(done) > 0 {
+				err = errors.Wrapf(err, "%s were copied before", strings.Join(done, ", "))
+			}
+			return "", err
+		}
+		rows += copied
+		done = append(done, name)
+	}
+
+	j.step("Done", len(opts.Tables), len(opts.Tables))
+	return fmt.Sprintf("Copied %d rows of %d tables", rows, len(opts.Tables)), nil
+}
+
+func (c *Connections) transferTable(ctx context.Context, j *job, mapper typeMapper, sourceTx pgx.Tx, target *pgxpool.Pool, table model.TransferTable, opts model.TransferOptions) (int64, error) {
+	columns, err := loadTransferColumns(ctx, sourceTx, table.Source.Schema, table.Source.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := target.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback(context.Background())
+
+	// Copy the columns the target has, all of them when it's created
+	targetColumns, err := getTableColumns(ctx, tx, table.Target.Schema, table.Target.Name)
+	if err != nil {
+		return 0, err
+	}
+	if len(targetColumns) == 0 {
+		primaryKey, err := getPrimaryKeyColumns(ctx, sourceTx, table.Source.Schema, table.Source.Name)
+		if err != nil {
+			return 0, err
+		}
+		typeExists := func(name string) (bool, error) {
+			var exists bool
+			err := tx.QueryRow(ctx, "SELECT to_regtype($1) IS NOT NULL", name).Scan(&exists)
+			return exists, err
+		}
+		create, err := createTransferTableSQL(mapper, table.Target, columns, primaryKey, typeExists)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+quoteIdent(schemaOrDefault(table.Target.Schema))); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, create); err != nil {
+			return 0, err
+		}
+	} else {
+		writable := make(map[string]bool, len(targetColumns))
+		for _, column := range targetColumns {
+			writable[column.Name] = !column.IsGenerated
+		}
+		kept := columns[:0]
+		for _, column := range columns {
+			if writable[column.name] {
+				kept = append(kept, column)
+			}
+		}
+		columns = kept
+		if len(columns) == 0 {
+			return 0, errors.New("the target table has none of the source columns")
+		}
+
+		if opts.Truncate {
+			if _, err := tx.Exec(ctx, "TRUNCATE "+qualifiedTableName(table.Target.Schema, table.Target.Name)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", quoteColumns(names), qualifiedTableName(table.Source.Schema, table.Source.Name))
+	if strings.TrimSpace(table.Where) != "" {
+		query += " WHERE " + table.Where
+	}
+	if table.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", table.Limit)
+	}
+
+	// COPY TO writes into the pipe while the batches read from it
+	reader, writer := io.Pipe()
+	copyCtx, cancelCopy := context.WithCancel(ctx)
+	defer cancelCopy()
+	sourceDone := make(chan error, 1)
+	go func() {
+		_, err := sourceTx.Conn().PgConn().CopyTo(copyCtx, writer, "COPY ("+query+") TO STDOUT")
+		writer.CloseWithError(err)
+		sourceDone <- err
+	}()
+
+	src := bufio.NewReaderSize(&progressReader{r: reader, job: j}, 64*1024)
+	copyTarget := fmt.Sprintf("COPY %s (%s) FROM STDIN", qualifiedTableName(table.Target.Schema, table.Target.Name), quoteColumns(names))
+	var copied int64
+	for {
+		if _, err := src.Peek(1); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+
+		tag, err := tx.Conn().PgConn().CopyFrom(ctx, &copyBatchReader{src: src, limit: opts.BatchSize}, copyTarget)
+		if err != nil {
+			// Stop the source before the pipe is left unread
+			cancelCopy()
+			reader.Close()
+			<-sourceDone
+			return 0, err
+		}
+		copied += tag.RowsAffected()
+		j.addProgress(tag.RowsAffected(), 0)
+	}
+	if err := <-sourceDone; err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
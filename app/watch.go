@@ -0,0 +1,261 @@
+package app
+
+import (
+	"context"
+	"dbmx/model"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// tabWatch re-runs the query of a tab until it's cancelled
+type tabWatch struct {
+	cancel context.CancelFunc
+}
+
+// StartWatch re-runs the query of a tab every interval seconds and emits each result with its
+// changes since the previous run as a watchResult event. The watch stops on the first failed,
+// timed out or partial run or once the tab is closed and emits a watchStopped event with the tab
+// id and the reason.
+// Only the first run is saved to the query history. A running watch of the tab is replaced.
+func (c *Connections) StartWatch(activePoolID uuid.UUID, tabID int64, query string, intervalSeconds int, params map[string]model.QueryParam) error {
+	if _, exists := c.PM.GetPool(activePoolID); !exists {
+		return errors.New("pool doesn't exist")
+	}
+	if intervalSeconds < 1 {
+		return errors.New("interval must be at least 1 second")
+	}
+	if strings.TrimSpace(query) == "" {
+		return errors.New("query is required")
+	}
+	if isWriteOperation(query) {
+		return errors.New("only read queries can be watched")
+	}
+
+	boundQuery, args, err := bindQueryParams(query, params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &tabWatch{cancel: cancel}
+	c.watchMu.Lock()
+	if running, isWatching := c.watches[tabID]; isWatching {
+		running.cancel()
+	}
+	c.watches[tabID] = w
+	c.watchMu.Unlock()
+
+	go c.runWatch(ctx, w, activePoolID, tabID, boundQuery, args, time.Duration(intervalSeconds)*time.Second)
+
+	return nil
+}
+
+// StopWatch stops re-running the query of a tab
+func (c *Connections) StopWatch(tabID int64) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	if w, isWatching := c.watches[tabID]; isWatching {
+		w.cancel()
+		delete(c.watches, tabID)
+	}
+}
+
+// IsWatching reports whether the query of a tab is re-run on an interval
+func (c *Connections) IsWatching(tabID int64) bool {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	_, isWatching := c.watches[tabID]
+	return isWatching
+}
+
+func (c *Connections) runWatch(ctx context.Context, w *tabWatch, activePoolID uuid.UUID, tabID int64, query string, args []any, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *model.QueryResult
+	iteration := 0
+	for {
+		var tabExists bool
+		if err := c.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM tabs WHERE id = ?)", tabID).Scan(&tabExists); err != nil {
+			c.stopWatch(w, tabID, err.Error())
+			return
+		}
+		if !tabExists {
+			c.stopWatch(w, tabID, "the tab was closed")
+			return
+		}
+
+		// A query the user runs on the tab goes first, the watch runs again on the next tick. The
+		// watch doesn't take the query slot of the tab, cancelling the user's query leaves it running.
+		if !c.isTabQueryRunning(tabID) {
+			queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+			result := c.runQuery(queryCtx, cancel, activePoolID, query, false, args, iteration == 0)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			// Failed and partial results would be diffed as if rows changed, the watch stops
+			// with the error instead
+			if !result.OK || result.Failed || result.Partial {
+				c.stopWatch(w, tabID, result.Message)
+				return
+			}
+
+			iteration++
+			update := model.WatchUpdate{TabID: tabID, Iteration: iteration, RanAt: time.Now(), Result: result}
+			if previous != nil {
+				update.Diff = diffResults(*previous, result)
+			} else {
+				update.Diff = model.ResultDiff{KeyedBy: diffKeyedBy(result, result), Added: []int{}, Removed: []model.RemovedRow{}, Changed: []model.ChangedRow{}}
+			}
+			previous = &result
+			c.emit("watchResult", tabID, update)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Remove a watch which stopped by itself unless it was replaced meanwhile
+func (c *Connections) stopWatch(w *tabWatch, tabID int64, reason string) {
+	c.watchMu.Lock()
+	if c.watches[tabID] == w {
+		delete(c.watches, tabID)
+	}
+	c.watchMu.Unlock()
+	w.cancel()
+
+	c.emit("watchStopped", tabID, reason)
+}
+
+func (c *Connections) isTabQueryRunning(tabID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, isRunning := c.activeQueries[tabID]
+	return isRunning
+}
+
+// Rows are matched by key when both results have the same key columns and a unique key for
+// every row, else by their whole content
+func diffKeyedBy(previous, next model.QueryResult) string {
+	if len(previous.KeyColumns) == 0 || !slices.Equal(previous.KeyColumns, next.KeyColumns) {
+		return "content"
+	}
+	for _, result := range []model.QueryResult{previous, next} {
+		if len(result.RowKeys) != len(result.Rows) {
+			return "content"
+		}
+		seen := make(map[string]bool, len(result.RowKeys))
+		for _, key := range result.RowKeys {
+			k := rowKeyString(result.KeyColumns, key)
+			if seen[k] {
+				return "content"
+			}
+			seen[k] = true
+		}
+	}
+	return "key"
+}
+
+// diffResults lists the rows added, removed and changed from the previous result of a query to
+// the next one
+func diffResults(previous, next model.QueryResult) model.ResultDiff {
+	diff := model.ResultDiff{
+		KeyedBy: diffKeyedBy(previous, next),
+		Added:   []int{},
+		Removed: []model.RemovedRow{},
+		Changed: []model.ChangedRow{},
+	}
+
+	if diff.KeyedBy == "key" {
+		previousRows := make(map[string]int, len(previous.Rows))
+		for i, key := range previous.RowKeys {
+			previousRows[rowKeyString(previous.KeyColumns, key)] = i
+		}
+
+		matched := make(map[int]bool, len(next.Rows))
+		for i, key := range next.RowKeys {
+			p, found := previousRows[rowKeyString(next.KeyColumns, key)]
+			if !found {
+				diff.Added = append(diff.Added, i)
+				continue
+			}
+			matched[p] = true
+			if cells := changedCells(previous.Rows[p], next.Rows[i]); len(cells) > 0 {
+				diff.Changed = append(diff.Changed, model.ChangedRow{Row: i, Key: key, Cells: cells})
+			}
+		}
+		for i, row := range previous.Rows {
+			if !matched[i] {
+				diff.Removed = append(diff.Removed, model.RemovedRow{Row: i, Key: previous.RowKeys[i], Cells: row})
+			}
+		}
+		return diff
+	}
+
+	// Identical rows may repeat, each previous row matches one next row at most
+	previousRows := make(map[string][]int, len(previous.Rows))
+	for i, row := range previous.Rows {
+		k := rowContentString(row)
+		previousRows[k] = append(previousRows[k], i)
+	}
+	for i, row := range next.Rows {
+		k := rowContentString(row)
+		if matches := previousRows[k]; len(matches) > 0 {
+			previousRows[k] = matches[1:]
+			continue
+		}
+		diff.Added = append(diff.Added, i)
+	}
+	for _, unmatched := range previousRows {
+		for _, i := range unmatched {
+			diff.Removed = append(diff.Removed, model.RemovedRow{Row: i, Cells: previous.Rows[i]})
+		}
+	}
+	slices.SortFunc(diff.Removed, func(a, b model.RemovedRow) int { return a.Row - b.Row })
+
+	return diff
+}
+
+// Cells of a row whose value differs between the results, compared by column name
+func changedCells(previous, next []model.Cell) []model.ChangedCell {
+	previousValues := make(map[string]string, len(previous))
+	for _, cell := range previous {
+		previousValues[cell.Column] = cell.Value
+	}
+
+	changed := []model.ChangedCell{}
+	for _, cell := range next {
+		if value, found := previousValues[cell.Column]; !found || value != cell.Value {
+			changed = append(changed, model.ChangedCell{Column: cell.Column, Previous: value, Value: cell.Value})
+		}
+	}
+	return changed
+}
+
+func rowKeyString(columns []string, key model.RowKey) string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = key[column]
+	}
+	return strings.Join(values, "\x00")
+}
+
+func rowContentString(row []model.Cell) string {
+	values := make([]string, 0, len(row)*2)
+	for _, cell := range row {
+		values = append(values, cell.Column, cell.Value)
+	}
+	return strings.Join(values, "\x00")
+}
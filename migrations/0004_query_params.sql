@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE "tabs" ADD COLUMN "query_params" TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE "saved_queries" ADD COLUMN "params" TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE "saved_queries" DROP COLUMN "params";
+
+ALTER TABLE "tabs" DROP COLUMN "query_params";
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE "tabs" ADD COLUMN "filter" TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE "tabs" DROP COLUMN "filter";
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE "tabs" ADD COLUMN "schema" TEXT NOT NULL DEFAULT 'public';
+
+-- +goose Down
+ALTER TABLE "tabs" DROP COLUMN "schema";
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS "schema_snapshots" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  "connection_id" INTEGER NOT NULL,
+  "db_name" TEXT NOT NULL,
+  "label" TEXT NOT NULL DEFAULT '',
+  "trigger" TEXT NOT NULL,
+  "hash" TEXT NOT NULL,
+  "table_count" INTEGER NOT NULL DEFAULT 0,
+  "object_count" INTEGER NOT NULL DEFAULT 0,
+  "schema" TEXT NOT NULL,
+  "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_schema_snapshots_connection_db ON "schema_snapshots" ("connection_id", "db_name", "created_at");
+
+CREATE TABLE IF NOT EXISTS "schema_snapshot_settings" (
+  "connection_id" INTEGER PRIMARY KEY NOT NULL,
+  "on_connect" BOOLEAN NOT NULL DEFAULT false
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS "schema_snapshot_settings";
+DROP TABLE IF EXISTS "schema_snapshots";
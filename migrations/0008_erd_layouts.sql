@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS "erd_layouts" (
+  "connection_id" INTEGER NOT NULL,
+  "db_name" TEXT NOT NULL,
+  "layout" TEXT NOT NULL,
+  "updated_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("connection_id", "db_name")
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS "erd_layouts";
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS "edit_batches" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  "connection_id" INTEGER NOT NULL,
+  "db_name" TEXT NOT NULL,
+  "undone" BOOLEAN NOT NULL DEFAULT false,
+  "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_edit_batches_connection_db ON "edit_batches" ("connection_id", "db_name", "id");
+
+CREATE TABLE IF NOT EXISTS "edit_journal" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  "batch_id" INTEGER NOT NULL,
+  "position" INTEGER NOT NULL,
+  "kind" TEXT NOT NULL,
+  "schema_name" TEXT NOT NULL,
+  "table_name" TEXT NOT NULL,
+  "row_key" TEXT NOT NULL,
+  "new_row_key" TEXT NOT NULL,
+  "before" TEXT NOT NULL,
+  "after" TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_edit_journal_batch ON "edit_journal" ("batch_id", "position");
+CREATE INDEX IF NOT EXISTS idx_edit_journal_row ON "edit_journal" ("schema_name", "table_name", "row_key");
+
+-- +goose Down
+DROP TABLE IF EXISTS "edit_journal";
+DROP TABLE IF EXISTS "edit_batches";
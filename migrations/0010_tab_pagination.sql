@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE "tabs" ADD COLUMN "total_rows" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "tabs" ADD COLUMN "total_rows_estimated" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "tabs" ADD COLUMN "current_page" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "tabs" ADD COLUMN "current_page_estimated" INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE "tabs" DROP COLUMN "current_page_estimated";
+ALTER TABLE "tabs" DROP COLUMN "current_page";
+ALTER TABLE "tabs" DROP COLUMN "total_rows_estimated";
+ALTER TABLE "tabs" DROP COLUMN "total_rows";
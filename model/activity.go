@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// ActivitySession is a backend of the server from pg_stat_activity
+type ActivitySession struct {
+	PID             int32  `json:"pid"`
+	Database        string `json:"database"`
+	User            string `json:"user"`
+	ApplicationName string `json:"applicationName"`
+	ClientAddr      string `json:"clientAddr"`
+	ClientPort      *int32 `json:"clientPort"`
+	BackendType     string `json:"backendType"`
+	// active, idle, idle in transaction, ... empty for background workers
+	State         string `json:"state"`
+	WaitEventType string `json:"waitEventType"`
+	WaitEvent     string `json:"waitEvent"`
+	Query         string `json:"query"`
+
+	BackendStart *time.Time `json:"backendStart"`
+	XactStart    *time.Time `json:"xactStart"`
+	QueryStart   *time.Time `json:"queryStart"`
+	StateChange  *time.Time `json:"stateChange"`
+	// Milliseconds since the query and the transaction started, nil when there is none
+	QueryDuration *int64 `json:"queryDuration"`
+	XactDuration  *int64 `json:"xactDuration"`
+
+	// Backends holding the locks this backend waits for
+	BlockedBy []int32 `json:"blockedBy"`
+	// Lock the backend waits for, e.g. relation, RowExclusiveLock on public.orders
+	LockType     string `json:"lockType"`
+	LockMode     string `json:"lockMode"`
+	LockRelation string `json:"lockRelation"`
+}
+
+// LockNode is a backend in a blocking chain with the backends it blocks
+type LockNode struct {
+	Session  ActivitySession `json:"session"`
+	Blocking []LockNode      `json:"blocking"`
+	// Number of backends blocked directly or indirectly
+	BlockedCount int `json:"blockedCount"`
+}
+
+// ActivitySnapshot is the activity of a server at one point in time
+type ActivitySnapshot struct {
+	Sessions []ActivitySession `json:"sessions"`
+	// Blocking chains, rooted at the backends which block others without waiting themselves
+	LockTree []LockNode `json:"lockTree"`
+	TakenAt  time.Time  `json:"takenAt"`
+}
@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// Sections of a backup, restored in this order
+const (
+	BackupSectionPreData  = "pre-data"
+	BackupSectionData     = "data"
+	BackupSectionPostData = "post-data"
+)
+
+// Kinds of backup entries besides the object kinds
+const (
+	BackupEntrySchema        = "schema"
+	BackupEntryData          = "data"
+	BackupEntryTableDetails  = "table_details"
+	BackupEntryForeignKeys   = "foreign_keys"
+	BackupEntrySequenceOwner = "sequence_owned_by"
+	BackupEntrySequenceValue = "sequence_value"
+	BackupEntryOwnership     = "ownership"
+)
+
+type BackupOptions struct {
+	// Absolute path of the backup file to write
+	Path string `json:"path"`
+	// Schemas dumped with all of their objects
+	Schemas []string `json:"schemas"`
+	// Tables dumped with their indexes, triggers and owned sequences. Partitions of a
+	// partitioned table are dumped with it.
+	Tables []TableRef `json:"tables"`
+	// Dump the DDL only
+	SchemaOnly bool `json:"schemaOnly"`
+}
+
+type RestoreOptions struct {
+	// Absolute path of the backup file to restore
+	Path string `json:"path"`
+	// Load the data into existing tables without running the DDL
+	DataOnly   bool `json:"dataOnly"`
+	SchemaOnly bool `json:"schemaOnly"`
+	// Skip owners and grants, e.g. when the roles don't exist on the target server
+	SkipOwnership bool `json:"skipOwnership"`
+	// Name of the target database, required on production connections
+	Confirmation string `json:"confirmation"`
+}
+
+// BackupManifest describes the content of a backup file
+type BackupManifest struct {
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Database      string    `json:"database"`
+	ServerVersion string    `json:"serverVersion"`
+
+	Schemas    []string   `json:"schemas"`
+	Tables     []TableRef `json:"tables"`
+	SchemaOnly bool       `json:"schemaOnly"`
+
+	Entries []BackupEntry `json:"entries"`
+}
+
+// BackupEntry is a statement or the data of a table in a backup
+type BackupEntry struct {
+	ID int `json:"id"`
+	// One of the object kinds or BackupEntry* kinds
+	Kind    string `json:"kind"`
+	Section string `json:"section"`
+	Schema  string `json:"schema"`
+	Name    string `json:"name"`
+
+	// Statements of DDL entries
+	SQL string `json:"sql"`
+
+	// File in the backup with the rows of a data entry in COPY text format
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	Bytes   int64    `json:"bytes"`
+
+	// Entries restored before this one
+	DependsOn []int `json:"dependsOn"`
+}
@@ -54,9 +54,24 @@ type Database struct {
 	PoolID   string
 	IsActive bool
 
-	// Tables and columns are set for the active database
+	// Tables and columns are set for the active database. Tables only holds the tables of the public schema.
 	Tables  []string
 	Columns []string
+
+	// Schemas of the active database with their tables
+	Schemas []Schema
+
+	// Effective search_path of the active database
+	SearchPath []string
+
+	// Table names for editor suggestions. Tables of schemas in the search_path are unqualified,
+	// the first schema wins for duplicate names. Tables of other schemas are schema qualified.
+	SuggestionTables []string
+}
+
+type Schema struct {
+	Name   string
+	Tables []string
 }
 
 type Cell struct {
@@ -71,10 +86,35 @@ type QueryResult struct {
 	TotalRows    int64    `json:"totalRows"`
 	RowsAffected int64    `json:"rowsAffected"`
 	Message      string   `json:"message"`
-
-	// If query output contains data of only one table and output also contains id primary key, its name will be stored here
+	// Failed is set when the query failed, the error is then the only row. Partial is set when the
+	// rows were cut short by a timeout or the size limit.
+	Failed  bool `json:"failed"`
+	Partial bool `json:"partial"`
+
+	// TotalRowsEstimated is set when TotalRows comes from the planner statistics instead of COUNT(*)
+	TotalRowsEstimated bool `json:"totalRowsEstimated"`
+	// Page of a table read, estimated when it was derived from an estimated number of rows before it
+	CurrentPage          int64 `json:"currentPage"`
+	CurrentPageEstimated bool  `json:"currentPageEstimated"`
+
+	// Keyset pagination cursors of table pages
+	NextCursor  *PageCursor `json:"nextCursor"`
+	PrevCursor  *PageCursor `json:"prevCursor"`
+	HasNextPage bool        `json:"hasNextPage"`
+	HasPrevPage bool        `json:"hasPrevPage"`
+
+	// If query output contains data of only one table and output also contains the key columns of the table, its name will be stored here
 	// Else it will be empty
-	TableName string `json:"tableName"`
+	TableName   string `json:"tableName"`
+	TableSchema string `json:"tableSchema"`
+
+	// Key columns of TableName and the key of every row, edits identify rows by their key
+	KeyColumns []string `json:"keyColumns"`
+	RowKeys    []RowKey `json:"rowKeys"`
+	// xmin of every row of a table read, sent back with edits of the row to detect concurrent changes
+	RowVersions []string `json:"rowVersions"`
+	// Why the rows of a single table can't be edited, e.g. the table has no primary key
+	ReadOnlyReason string `json:"readOnlyReason"`
 
 	// ExecutionTime is the time taken to execute the query in milliseconds
 	ExecutionTime int64 `json:"executionTime"`
@@ -106,10 +146,20 @@ type TableInfo struct {
 	Rules     Rules     `json:"rules"`
 }
 
+// RowKey maps the key columns of a row to the text representation of their values
+type RowKey map[string]string
+
 type UpdateCell struct {
 	CellID     string
+	SchemaName string
 	TableName  string
+	// Key of the edited row. RowID is only used when the key is empty and the table is keyed by id.
+	Key        RowKey
 	RowID      int64
 	ColumnName string
 	Value      any
+	// xmin of the row as it was read and the values of the row as they were read. The edit
+	// conflicts when the row changed since then, both are optional.
+	XMin     string
+	Original map[string]*string
 }
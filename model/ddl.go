@@ -0,0 +1,85 @@
+package model
+
+// Kind of ordinary and partitioned tables, DDL of other kinds is generated from DatabaseObject
+const ObjectKindTable = "table"
+
+// Constraint types, same as pg_constraint.contype
+const (
+	ConstraintPrimaryKey = "p"
+	ConstraintUnique     = "u"
+	ConstraintForeignKey = "f"
+	ConstraintCheck      = "c"
+	ConstraintExclusion  = "x"
+)
+
+// TableDef is the definition of a table as read from the catalogs
+type TableDef struct {
+	OID    uint32 `json:"oid"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+
+	Unlogged bool `json:"unlogged"`
+	// Partition key of a partitioned table, e.g. RANGE (created_at)
+	PartitionBy string `json:"partitionBy"`
+	// Parent and bound of a partition, e.g. FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')
+	PartitionOf    string `json:"partitionOf"`
+	PartitionBound string `json:"partitionBound"`
+	// Schema qualified parents of a table using inheritance
+	Inherits []string `json:"inherits"`
+	// Storage parameters, e.g. fillfactor=70
+	Options []string `json:"options"`
+
+	Columns     []ColumnDef     `json:"columns"`
+	Constraints []ConstraintDef `json:"constraints"`
+	// Indexes which don't back a constraint
+	Indexes []IndexDef `json:"indexes"`
+
+	Owner   string           `json:"owner"`
+	Comment string           `json:"comment"`
+	Grants  []PrivilegeGrant `json:"grants"`
+}
+
+type ColumnDef struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"notNull"`
+	Default string `json:"default"`
+	// ALWAYS or BY DEFAULT for identity columns
+	Identity string `json:"identity"`
+	// Expression of a stored generated column
+	Generated string `json:"generated"`
+	// Only set when it differs from the default collation of the type
+	Collation string `json:"collation"`
+	Comment   string `json:"comment"`
+	// Inherited from a parent table, partitions inherit all of their columns
+	Inherited bool `json:"inherited"`
+}
+
+type ConstraintDef struct {
+	Name string `json:"name"`
+	// One of the Constraint* types
+	Type       string   `json:"type"`
+	Definition string   `json:"definition"`
+	Columns    []string `json:"columns"`
+	// Schema qualified table referenced by a foreign key
+	References string `json:"references"`
+	Comment    string `json:"comment"`
+}
+
+type IndexDef struct {
+	Name string `json:"name"`
+	// Full CREATE INDEX statement
+	Definition string   `json:"definition"`
+	Method     string   `json:"method"`
+	IsUnique   bool     `json:"isUnique"`
+	Columns    []string `json:"columns"`
+	Comment    string   `json:"comment"`
+}
+
+// PrivilegeGrant holds the privileges granted to a role on an object
+type PrivilegeGrant struct {
+	// Role name or PUBLIC
+	Grantee         string   `json:"grantee"`
+	Privileges      []string `json:"privileges"`
+	WithGrantOption bool     `json:"withGrantOption"`
+}
@@ -0,0 +1,30 @@
+package model
+
+// EditBatch is a committed batch of row edits journaled so that it can be undone and redone
+type EditBatch struct {
+	ID           int64  `json:"id"`
+	ConnectionID int64  `json:"connectionId"`
+	DBName       string `json:"dbName"`
+	// An undone batch can be redone, any other can be undone
+	Undone    bool               `json:"undone"`
+	Entries   []EditJournalEntry `json:"entries"`
+	CreatedAt string             `json:"createdAt"`
+	UpdatedAt string             `json:"updatedAt"`
+}
+
+// EditJournalEntry records one row of a batch as it was before and after the edit. Values are
+// text representations, nil is NULL.
+type EditJournalEntry struct {
+	// One of the RowEdit* kinds
+	Kind   string `json:"kind"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Key of the row before the edit, empty for inserts
+	Key RowKey `json:"key"`
+	// Key of the row after the edit, empty for deletes
+	NewKey RowKey `json:"newKey"`
+	// Edited columns before the edit, every column for deletes
+	Before map[string]*string `json:"before"`
+	// Edited columns after the edit, every column for inserts
+	After map[string]*string `json:"after"`
+}
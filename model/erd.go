@@ -0,0 +1,60 @@
+package model
+
+// Cardinality hints of an ER diagram edge, seen from the referencing table
+const (
+	CardinalityManyToOne = "many-to-one"
+	CardinalityOneToOne  = "one-to-one"
+)
+
+// ERDOptions filters the tables of an ER diagram
+type ERDOptions struct {
+	// Schemas to include, all user schemas when empty
+	Schemas []string `json:"schemas"`
+	// Only include tables within Hops foreign keys of the focus table, in either direction
+	FocusSchema string `json:"focusSchema"`
+	FocusTable  string `json:"focusTable"`
+	Hops        int    `json:"hops"`
+}
+
+type ERDGraph struct {
+	Nodes []ERDNode `json:"nodes"`
+	Edges []ERDEdge `json:"edges"`
+}
+
+type ERDNode struct {
+	// Schema qualified table name
+	ID      string      `json:"id"`
+	Schema  string      `json:"schema"`
+	Name    string      `json:"name"`
+	Columns []ERDColumn `json:"columns"`
+	// Saved position of the node, nil until the layout is saved
+	Position *ERDPosition `json:"position"`
+}
+
+type ERDColumn struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	NotNull      bool   `json:"notNull"`
+	IsPrimaryKey bool   `json:"isPrimaryKey"`
+	IsForeignKey bool   `json:"isForeignKey"`
+	IsUnique     bool   `json:"isUnique"`
+}
+
+// ERDEdge is a foreign key from the source table to the target table
+type ERDEdge struct {
+	Name          string   `json:"name"`
+	Source        string   `json:"source"`
+	Target        string   `json:"target"`
+	SourceColumns []string `json:"sourceColumns"`
+	TargetColumns []string `json:"targetColumns"`
+	Cardinality   string   `json:"cardinality"`
+	// Optional when a referencing column is nullable
+	Optional bool `json:"optional"`
+}
+
+type ERDPosition struct {
+	// Node id
+	ID string  `json:"id"`
+	X  float64 `json:"x"`
+	Y  float64 `json:"y"`
+}
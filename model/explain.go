@@ -0,0 +1,78 @@
+package model
+
+type ExplainOptions struct {
+	// Analyze executes the query. Write statements are rolled back.
+	Analyze bool `json:"analyze"`
+	Buffers bool `json:"buffers"`
+	Verbose bool `json:"verbose"`
+}
+
+// PlanNode is a node of a parsed EXPLAIN (FORMAT JSON) plan
+type PlanNode struct {
+	NodeType           string   `json:"nodeType"`
+	ParentRelationship string   `json:"parentRelationship"`
+	SubplanName        string   `json:"subplanName"`
+	RelationName       string   `json:"relationName"`
+	Schema             string   `json:"schema"`
+	Alias              string   `json:"alias"`
+	IndexName          string   `json:"indexName"`
+	JoinType           string   `json:"joinType"`
+	Strategy           string   `json:"strategy"`
+	ParallelAware      bool     `json:"parallelAware"`
+	Filter             string   `json:"filter"`
+	IndexCond          string   `json:"indexCond"`
+	JoinFilter         string   `json:"joinFilter"`
+	HashCond           string   `json:"hashCond"`
+	MergeCond          string   `json:"mergeCond"`
+	RecheckCond        string   `json:"recheckCond"`
+	Output             []string `json:"output"`
+
+	StartupCost float64 `json:"startupCost"`
+	TotalCost   float64 `json:"totalCost"`
+	// EstimatedRows is the planner estimate of rows per loop
+	EstimatedRows float64 `json:"estimatedRows"`
+	PlanWidth     int64   `json:"planWidth"`
+
+	// Only set with ANALYZE
+
+	// ActualRows is the average number of rows per loop
+	ActualRows        float64 `json:"actualRows"`
+	ActualLoops       float64 `json:"actualLoops"`
+	ActualStartupTime float64 `json:"actualStartupTime"`
+	ActualTotalTime   float64 `json:"actualTotalTime"`
+	// ExclusiveTime is the time in milliseconds spent in this node across all loops, excluding its children
+	ExclusiveTime       float64 `json:"exclusiveTime"`
+	RowsRemovedByFilter float64 `json:"rowsRemovedByFilter"`
+	// MisestimateFactor is how many times the estimate is off from the actual rows, in either direction
+	MisestimateFactor  float64 `json:"misestimateFactor"`
+	IsWorstMisestimate bool    `json:"isWorstMisestimate"`
+
+	// Only set with BUFFERS. Block counts include the children of the node.
+
+	SharedHitBlocks     int64 `json:"sharedHitBlocks"`
+	SharedReadBlocks    int64 `json:"sharedReadBlocks"`
+	SharedDirtiedBlocks int64 `json:"sharedDirtiedBlocks"`
+	SharedWrittenBlocks int64 `json:"sharedWrittenBlocks"`
+	TempReadBlocks      int64 `json:"tempReadBlocks"`
+	TempWrittenBlocks   int64 `json:"tempWrittenBlocks"`
+
+	IsSeqScan bool `json:"isSeqScan"`
+
+	Children []PlanNode `json:"children"`
+}
+
+type ExplainResult struct {
+	OK      bool      `json:"ok"`
+	Message string    `json:"message"`
+	Plan    *PlanNode `json:"plan"`
+
+	// Planning and execution time in milliseconds as reported by postgres
+	PlanningTime  float64 `json:"planningTime"`
+	ExecutionTime float64 `json:"executionTime"`
+
+	// RolledBack is set when the analyzed statement writes and its changes were rolled back
+	RolledBack bool `json:"rolledBack"`
+
+	// Raw EXPLAIN output
+	RawJSON string `json:"rawJson"`
+}
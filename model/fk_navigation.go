@@ -0,0 +1,36 @@
+package model
+
+// ForeignKeyLookup is a value of a result row to follow to the row it references
+type ForeignKeyLookup struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	// Values of the other columns of a composite foreign key
+	Values map[string]string `json:"values"`
+}
+
+// ForeignKeyTarget is the row referenced through a foreign key
+type ForeignKeyTarget struct {
+	Constraint string   `json:"constraint"`
+	Schema     string   `json:"schema"`
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	// Filter of a table tab showing the referenced row
+	Filter TableFilter `json:"filter"`
+	// The referenced row, without rows when it doesn't exist
+	Result QueryResult `json:"result"`
+}
+
+// ReferencingTable counts the rows of a table which reference a row through a foreign key
+type ReferencingTable struct {
+	Constraint        string   `json:"constraint"`
+	Schema            string   `json:"schema"`
+	Table             string   `json:"table"`
+	Columns           []string `json:"columns"`
+	ReferencedColumns []string `json:"referencedColumns"`
+	// Exact number of referencing rows
+	Count int64 `json:"count"`
+	// Filter of a table tab showing the referencing rows
+	Filter TableFilter `json:"filter"`
+}
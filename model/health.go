@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+// DatabaseHealth reports the size, cache efficiency, vacuum status and transaction ID age of a
+// database with its tables and indexes
+type DatabaseHealth struct {
+	Database string `json:"database"`
+	// Size of the database in bytes
+	Size int64 `json:"size"`
+	// Share of block reads served from shared buffers, nil before any block was read
+	CacheHitRatio *float64 `json:"cacheHitRatio"`
+	XactCommit    int64    `json:"xactCommit"`
+	XactRollback  int64    `json:"xactRollback"`
+	Deadlocks     int64    `json:"deadlocks"`
+	// Bytes written to temporary files by queries which ran out of work_mem
+	TempBytes int64 `json:"tempBytes"`
+
+	// Transactions since the oldest unfrozen transaction ID of the database
+	WraparoundAge int64 `json:"wraparoundAge"`
+	// Age at which autovacuum forces a freeze, autovacuum_freeze_max_age
+	FreezeMaxAge int64 `json:"freezeMaxAge"`
+	// Wraparound age as a percentage of the 2^31 transaction IDs available
+	WraparoundPercent float64 `json:"wraparoundPercent"`
+
+	// Counters are collected since this time, nil when they were never reset
+	StatsResetAt *time.Time    `json:"statsResetAt"`
+	Tables       []TableHealth `json:"tables"`
+	Indexes      []IndexHealth `json:"indexes"`
+}
+
+type TableHealth struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	// Sizes in bytes, the total includes indexes and TOAST
+	TotalSize   int64 `json:"totalSize"`
+	TableSize   int64 `json:"tableSize"`
+	IndexesSize int64 `json:"indexesSize"`
+	ToastSize   int64 `json:"toastSize"`
+	// Bytes the table takes beyond what its rows need, estimated from the planner statistics.
+	// Nil when the table was never analyzed.
+	EstimatedBloat *int64   `json:"estimatedBloat"`
+	BloatRatio     *float64 `json:"bloatRatio"`
+
+	LiveTuples int64 `json:"liveTuples"`
+	DeadTuples int64 `json:"deadTuples"`
+	// Share of dead tuples among all tuples, nil for empty tables
+	DeadTupleRatio   *float64 `json:"deadTupleRatio"`
+	ModsSinceAnalyze int64    `json:"modsSinceAnalyze"`
+
+	SeqScans      int64 `json:"seqScans"`
+	SeqTuplesRead int64 `json:"seqTuplesRead"`
+	IndexScans    int64 `json:"indexScans"`
+	// Share of scans which used an index, nil before the table was scanned
+	IndexScanRatio *float64 `json:"indexScanRatio"`
+	CacheHitRatio  *float64 `json:"cacheHitRatio"`
+
+	LastVacuum       *time.Time `json:"lastVacuum"`
+	LastAutovacuum   *time.Time `json:"lastAutovacuum"`
+	LastAnalyze      *time.Time `json:"lastAnalyze"`
+	LastAutoanalyze  *time.Time `json:"lastAutoanalyze"`
+	VacuumCount      int64      `json:"vacuumCount"`
+	AutovacuumCount  int64      `json:"autovacuumCount"`
+	AnalyzeCount     int64      `json:"analyzeCount"`
+	AutoanalyzeCount int64      `json:"autoanalyzeCount"`
+
+	// Transactions since the oldest unfrozen transaction ID of the table, nil for partitioned
+	// tables whose partitions are reported on their own
+	WraparoundAge *int64 `json:"wraparoundAge"`
+}
+
+type IndexHealth struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	// Size in bytes
+	Size          int64    `json:"size"`
+	Scans         int64    `json:"scans"`
+	TuplesRead    int64    `json:"tuplesRead"`
+	CacheHitRatio *float64 `json:"cacheHitRatio"`
+	Unique        bool     `json:"unique"`
+	Primary       bool     `json:"primary"`
+	Valid         bool     `json:"valid"`
+}
@@ -0,0 +1,77 @@
+package model
+
+// ColumnInfo describes a table column as reported by information_schema.columns
+type ColumnInfo struct {
+	Name       string `json:"name"`
+	DataType   string `json:"dataType"`
+	UDTName    string `json:"udtName"`
+	IsNullable bool   `json:"isNullable"`
+	Default    string `json:"default"`
+	Position   int    `json:"position"`
+	// Stored generated columns can't be written
+	IsGenerated bool `json:"isGenerated"`
+}
+
+type ImportOptions struct {
+	// Absolute path of the file to import
+	Path string `json:"path"`
+	// Format is either csv or ndjson
+	Format string `json:"format"`
+	// Delimiter is only used for csv files, defaults to a comma
+	Delimiter string `json:"delimiter"`
+	// HasHeader tells whether the first line of a csv file holds the column names
+	HasHeader bool `json:"hasHeader"`
+	// NullString is the csv value which is imported as NULL, empty values are always NULL
+	NullString string `json:"nullString"`
+
+	// Schema of the table, defaults to public
+	Schema    string                `json:"schema"`
+	TableName string                `json:"tableName"`
+	Mapping   []ImportColumnMapping `json:"mapping"`
+
+	// Truncate the table before loading the rows
+	Truncate bool `json:"truncate"`
+	// Upsert on conflict of ConflictColumns (primary key when empty) instead of a plain insert
+	Upsert          bool     `json:"upsert"`
+	ConflictColumns []string `json:"conflictColumns"`
+	// SkipInvalidRows skips rows whose values can't be coerced instead of aborting the import
+	SkipInvalidRows bool `json:"skipInvalidRows"`
+}
+
+// ImportColumnMapping maps a column of the file to a column of the table
+// An empty TableColumn means the file column is ignored
+type ImportColumnMapping struct {
+	FileColumn  string `json:"fileColumn"`
+	TableColumn string `json:"tableColumn"`
+	DataType    string `json:"dataType"`
+	UDTName     string `json:"udtName"`
+	IsNullable  bool   `json:"isNullable"`
+}
+
+type ImportPreview struct {
+	Format       string                `json:"format"`
+	FileColumns  []string              `json:"fileColumns"`
+	Rows         [][]string            `json:"rows"`
+	TableColumns []ColumnInfo          `json:"tableColumns"`
+	Mapping      []ImportColumnMapping `json:"mapping"`
+}
+
+type ImportRowError struct {
+	// Line is the line number in the file, starting at 1
+	Line    int64  `json:"line"`
+	Column  string `json:"column"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+type ImportResult struct {
+	OK           bool             `json:"ok"`
+	RowsRead     int64            `json:"rowsRead"`
+	RowsImported int64            `json:"rowsImported"`
+	RowsSkipped  int64            `json:"rowsSkipped"`
+	Errors       []ImportRowError `json:"errors"`
+	Message      string           `json:"message"`
+
+	// ExecutionTime is the time taken to import the file in milliseconds
+	ExecutionTime int64 `json:"executionTime"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// CreateIndexOptions describes an index to create on a table
+type CreateIndexOptions struct {
+	Schema string      `json:"schema"`
+	Table  string      `json:"table"`
+	Index  DesignIndex `json:"index"`
+	// Build the index without blocking writes, it can't run inside a transaction
+	Concurrently bool `json:"concurrently"`
+}
+
+// Kinds of index advice
+const (
+	IndexAdviceUnused      = "unused"
+	IndexAdviceDuplicate   = "duplicate"
+	IndexAdviceOverlapping = "overlapping"
+	IndexAdviceInvalid     = "invalid"
+	IndexAdviceMissingFK   = "missing_fk_index"
+)
+
+// IndexAdvice is a finding of the index advisor
+type IndexAdvice struct {
+	// One of the IndexAdvice* kinds
+	Kind   string `json:"kind"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Index the advice is about, empty for a missing foreign key index
+	Index string `json:"index"`
+	// Index which makes a duplicate or overlapping index redundant
+	CoveredBy string `json:"coveredBy"`
+	// Foreign key and its columns lacking an index
+	ForeignKey string   `json:"foreignKey"`
+	Columns    []string `json:"columns"`
+	// Size of the index in bytes
+	Size    int64  `json:"size"`
+	Scans   int64  `json:"scans"`
+	Message string `json:"message"`
+	// Statement which resolves the finding, empty when it has to be resolved by hand
+	SQL string `json:"sql"`
+}
+
+type IndexAdvisorReport struct {
+	// Usage counters are collected since this time, nil when they were never reset
+	StatsResetAt *time.Time    `json:"statsResetAt"`
+	Advice       []IndexAdvice `json:"advice"`
+}
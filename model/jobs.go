@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// Kinds of background jobs
+const (
+	JobKindBackup   = "backup"
+	JobKindRestore  = "restore"
+	JobKindTransfer = "transfer"
+)
+
+// Job is a long running operation in the background, e.g. a backup. Its progress is emitted as
+// jobProgress events and its result as a jobFinished event.
+type Job struct {
+	ID          string      `json:"id"`
+	Kind        string      `json:"kind"`
+	Description string      `json:"description"`
+	StartedAt   time.Time   `json:"startedAt"`
+	Progress    JobProgress `json:"progress"`
+}
+
+type JobProgress struct {
+	// Current step, e.g. the object being dumped
+	Step string `json:"step"`
+	// Steps done out of the total steps of the job
+	Done  int `json:"done"`
+	Total int `json:"total"`
+	// Rows and bytes processed so far
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+	// Throughput since the job started
+	RowsPerSecond  float64 `json:"rowsPerSecond"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+}
+
+type JobResult struct {
+	JobID     string `json:"jobId"`
+	Kind      string `json:"kind"`
+	OK        bool   `json:"ok"`
+	Cancelled bool   `json:"cancelled"`
+	Message   string `json:"message"`
+	Rows      int64  `json:"rows"`
+	Bytes     int64  `json:"bytes"`
+
+	// ExecutionTime is the time taken by the job in milliseconds
+	ExecutionTime int64 `json:"executionTime"`
+}
+
+// TableRef names a table by its schema, an empty schema is public
+type TableRef struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+}
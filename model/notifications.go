@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Notification is a message received on a channel the database is listened to on
+type Notification struct {
+	Channel string `json:"channel"`
+	Payload string `json:"payload"`
+	// Backend which sent the notification
+	PID        uint32    `json:"pid"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
@@ -0,0 +1,33 @@
+package model
+
+// Kinds of database objects listed by the object browser
+const (
+	ObjectKindView             = "view"
+	ObjectKindMaterializedView = "materialized_view"
+	ObjectKindForeignTable     = "foreign_table"
+	ObjectKindSequence         = "sequence"
+	ObjectKindFunction         = "function"
+	ObjectKindProcedure        = "procedure"
+	ObjectKindEnum             = "enum"
+	ObjectKindDomain           = "domain"
+	ObjectKindTrigger          = "trigger"
+	ObjectKindExtension        = "extension"
+)
+
+// DatabaseObject is a catalog object other than a table. OID identifies it within its database.
+type DatabaseObject struct {
+	OID    uint32 `json:"oid"`
+	Kind   string `json:"kind"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+
+	// Identity arguments of functions and procedures, overloads share a name
+	Arguments string `json:"arguments"`
+	// Table a trigger fires on
+	TableName string `json:"tableName"`
+	// Installed version of an extension
+	Version string `json:"version"`
+
+	Owner   string `json:"owner"`
+	Comment string `json:"comment"`
+}
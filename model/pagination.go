@@ -0,0 +1,21 @@
+package model
+
+// PageCursor marks a row of a table for keyset pagination
+type PageCursor struct {
+	// Key columns the values belong to, the sort columns followed by the primary key
+	Columns []string `json:"columns"`
+	// Text values of the key columns, nil for NULL
+	Values []*string `json:"values"`
+	// Backward fetches the page before the row instead of the page after it
+	Backward bool `json:"backward"`
+	// Page of the row, 0 when unknown
+	Page int64 `json:"page"`
+}
+
+// TableRowCount is the payload of the tableRowCount event emitted by a background exact count
+type TableRowCount struct {
+	TabID     int64  `json:"tabId"`
+	TotalRows int64  `json:"totalRows"`
+	Canceled  bool   `json:"canceled"`
+	Error     string `json:"error"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// QueryParam is the typed value of a query parameter
+// Parameters are keyed by their position ("1" for $1) or by their name ("customer_id" for :customer_id)
+type QueryParam struct {
+	// Type is the postgres type the value is sent as e.g. text, int, numeric, bool, timestamptz, uuid, jsonb
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	IsNull bool   `json:"isNull"`
+}
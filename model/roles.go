@@ -0,0 +1,108 @@
+package model
+
+import "time"
+
+// Role is a database role with its attributes and memberships
+type Role struct {
+	Name        string `json:"name"`
+	Superuser   bool   `json:"superuser"`
+	Inherit     bool   `json:"inherit"`
+	CreateRole  bool   `json:"createRole"`
+	CreateDB    bool   `json:"createDb"`
+	CanLogin    bool   `json:"canLogin"`
+	Replication bool   `json:"replication"`
+	BypassRLS   bool   `json:"bypassRls"`
+	// -1 is no limit
+	ConnectionLimit int        `json:"connectionLimit"`
+	ValidUntil      *time.Time `json:"validUntil"`
+	// Predefined pg_ roles
+	System bool `json:"system"`
+	// Roles this role is a member of, and the members of this role
+	MemberOf []RoleMembership `json:"memberOf"`
+	Members  []RoleMembership `json:"members"`
+}
+
+type RoleMembership struct {
+	Role    string `json:"role"`
+	Member  string `json:"member"`
+	Grantor string `json:"grantor"`
+	// The member can grant the role to others
+	AdminOption bool `json:"adminOption"`
+}
+
+// Object types of privileges
+const (
+	PrivilegeObjectTable    = "table"
+	PrivilegeObjectColumn   = "column"
+	PrivilegeObjectSequence = "sequence"
+	PrivilegeObjectSchema   = "schema"
+	PrivilegeObjectFunction = "function"
+	PrivilegeObjectDatabase = "database"
+	// Membership in another role
+	PrivilegeObjectRole = "role"
+)
+
+// ObjectPrivileges holds the effective privileges of a role on an object, including the ones it
+// inherits from the roles it is a member of and the ones granted to PUBLIC
+type ObjectPrivileges struct {
+	// One of the PrivilegeObject* types
+	ObjectType string `json:"objectType"`
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	// Column of a column privilege, or argument types of a function
+	Detail string `json:"detail"`
+	// Privilege names mapped to whether the role has them
+	Privileges map[string]bool `json:"privileges"`
+}
+
+// RolePrivileges holds the effective privileges of a role on a database and the objects of a schema
+type RolePrivileges struct {
+	Role      string             `json:"role"`
+	Database  ObjectPrivileges   `json:"database"`
+	Schema    ObjectPrivileges   `json:"schema"`
+	Tables    []ObjectPrivileges `json:"tables"`
+	Sequences []ObjectPrivileges `json:"sequences"`
+	Functions []ObjectPrivileges `json:"functions"`
+}
+
+// PrivilegeChange grants or revokes privileges, or membership in a role, to roles
+type PrivilegeChange struct {
+	Revoke bool `json:"revoke"`
+	// One of the PrivilegeObject* types, column privileges are table privileges with columns
+	ObjectType string `json:"objectType"`
+	Schema     string `json:"schema"`
+	// Name of the object, empty with AllInSchema
+	Name string `json:"name"`
+	// Argument types of a function, e.g. integer, text
+	Arguments string `json:"arguments"`
+	// Grant on every table, sequence or function of the schema
+	AllInSchema bool `json:"allInSchema"`
+	// Columns of column privileges on a table
+	Columns    []string `json:"columns"`
+	Privileges []string `json:"privileges"`
+	// Role names or PUBLIC
+	Grantees []string `json:"grantees"`
+	// WITH GRANT OPTION, or WITH ADMIN OPTION for role membership
+	WithGrantOption bool `json:"withGrantOption"`
+	// Also revoke from the roles the grantees granted the privileges to
+	Cascade bool `json:"cascade"`
+}
+
+// AccessCheck is one step of explaining whether a role can access an object
+type AccessCheck struct {
+	Check  string `json:"check"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// AccessExplanation explains why a role can or can't use a privilege on a table
+type AccessExplanation struct {
+	Role      string        `json:"role"`
+	Schema    string        `json:"schema"`
+	Table     string        `json:"table"`
+	Privilege string        `json:"privilege"`
+	Allowed   bool          `json:"allowed"`
+	Checks    []AccessCheck `json:"checks"`
+	// Statements which would grant the missing privileges
+	FixSQL string `json:"fixSql"`
+}
@@ -0,0 +1,55 @@
+package model
+
+// Kinds of row edits
+const (
+	RowEditInsert = "insert"
+	RowEditUpdate = "update"
+	RowEditDelete = "delete"
+)
+
+// RowEdit inserts, updates or deletes one row. Values are text representations, nil is NULL.
+type RowEdit struct {
+	// One of the RowEdit* kinds
+	Kind   string `json:"kind"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Key of the updated or deleted row
+	Key RowKey `json:"key"`
+	// Columns set by an insert or update
+	Values map[string]*string `json:"values"`
+	// Column values as they were read, an update or delete conflicts when one of them changed
+	Original map[string]*string `json:"original"`
+	// xmin of the row as it was read, any change to the row since then is a conflict
+	XMin string `json:"xmin"`
+	// Let an insert set GENERATED ALWAYS identity columns, e.g. to restore a deleted row as it was
+	OverridingSystemValue bool `json:"overridingSystemValue"`
+}
+
+// RowEditResult reports the statements of a batch of row edits and whether they were committed.
+// Nothing is committed in a dry run or when an edit conflicts.
+type RowEditResult struct {
+	// Statements with their values inlined, for review
+	SQL        string             `json:"sql"`
+	Statements []RowEditStatement `json:"statements"`
+	Applied    bool               `json:"applied"`
+	DryRun     bool               `json:"dryRun"`
+	Conflicts  []RowEditConflict  `json:"conflicts"`
+	// Journaled batch of applied edits, 0 when nothing was journaled
+	BatchID int64 `json:"batchId"`
+}
+
+type RowEditStatement struct {
+	SQL          string `json:"sql"`
+	RowsAffected int64  `json:"rowsAffected"`
+	// Key of the row, returned by the database for inserts
+	Key RowKey `json:"key"`
+}
+
+// RowEditConflict is an update or delete whose row was changed or deleted by someone else
+type RowEditConflict struct {
+	// Position of the edit in the batch
+	Edit    int    `json:"edit"`
+	Key     RowKey `json:"key"`
+	Deleted bool   `json:"deleted"`
+	Message string `json:"message"`
+}
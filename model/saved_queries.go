@@ -5,4 +5,7 @@ type SavedQuery struct {
 	Title   string `json:"title"`
 	Query   string `json:"query"`
 	SavedAt string `json:"savedAt"`
+
+	// Parameter values saved with the query, keyed by position or name
+	Params map[string]QueryParam `json:"params"`
 }
@@ -0,0 +1,85 @@
+package model
+
+// SchemaModel is the introspected schema of a database, it's compared by the schema diff and
+// stored by schema snapshots
+type SchemaModel struct {
+	Schemas []string    `json:"schemas"`
+	Tables  []TableDef  `json:"tables"`
+	Objects []ObjectDef `json:"objects"`
+	// Functions called by the defaults and checks of each table, by schema qualified table name
+	TableDependencies map[string][]string `json:"tableDependencies"`
+}
+
+// ObjectDef is a view, materialized view, function, procedure or sequence with its full definition
+type ObjectDef struct {
+	Kind   string `json:"kind"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	// Identity arguments of functions and procedures
+	Arguments string `json:"arguments"`
+	// Arguments with their names, modes and defaults and the result of functions and procedures
+	Signature  string `json:"signature"`
+	Definition string `json:"definition"`
+	// Schema qualified relations a view selects from, and relations and functions a function uses.
+	// Functions are named with their identity arguments, e.g. public.f(integer).
+	Dependencies []string `json:"dependencies"`
+}
+
+// Changes of a schema diff, relative to the target
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// SchemaDiff lists what differs between a source and a target schema. SQL migrates the target to
+// the source.
+type SchemaDiff struct {
+	// Schemas only in the source (added) or only in the target (removed)
+	Schemas []ItemDiff   `json:"schemas"`
+	Tables  []TableDiff  `json:"tables"`
+	Objects []ObjectDiff `json:"objects"`
+
+	SQL string `json:"sql"`
+	// Changes the SQL can't migrate safely, e.g. a changed partition key
+	Warnings []string `json:"warnings"`
+}
+
+type TableDiff struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+
+	// Only set for changed tables
+	Columns        []ColumnDiff `json:"columns"`
+	Constraints    []ItemDiff   `json:"constraints"`
+	Indexes        []ItemDiff   `json:"indexes"`
+	CommentChanged bool         `json:"commentChanged"`
+}
+
+type ColumnDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	// Changed attributes: type, default, not null, identity, generated, collation, comment
+	Attributes []string   `json:"attributes"`
+	Source     *ColumnDef `json:"source"`
+	Target     *ColumnDef `json:"target"`
+}
+
+// ItemDiff is a difference of a named item compared by its definition
+type ItemDiff struct {
+	Name             string `json:"name"`
+	Change           string `json:"change"`
+	SourceDefinition string `json:"sourceDefinition"`
+	TargetDefinition string `json:"targetDefinition"`
+}
+
+type ObjectDiff struct {
+	Kind             string `json:"kind"`
+	Schema           string `json:"schema"`
+	Name             string `json:"name"`
+	Arguments        string `json:"arguments"`
+	Change           string `json:"change"`
+	SourceDefinition string `json:"sourceDefinition"`
+	TargetDefinition string `json:"targetDefinition"`
+}
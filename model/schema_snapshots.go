@@ -0,0 +1,21 @@
+package model
+
+// Triggers of a schema snapshot
+const (
+	SnapshotTriggerManual  = "manual"
+	SnapshotTriggerConnect = "connect"
+)
+
+// SchemaSnapshot is a recorded schema of a database, the schema itself is only loaded to diff snapshots
+type SchemaSnapshot struct {
+	ID           int64  `json:"id"`
+	ConnectionID int64  `json:"connectionId"`
+	DBName       string `json:"dbName"`
+	Label        string `json:"label"`
+	Trigger      string `json:"trigger"`
+	// Hash of the schema, equal hashes mean nothing changed
+	Hash        string `json:"hash"`
+	TableCount  int    `json:"tableCount"`
+	ObjectCount int    `json:"objectCount"`
+	CreatedAt   string `json:"createdAt"`
+}
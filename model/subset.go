@@ -0,0 +1,70 @@
+package model
+
+// Masking strategies of a column
+const (
+	MaskNull  = "null"
+	MaskFixed = "fixed"
+	// Replaces a value with a hash of it. It's the only mask of key columns, it spreads to the
+	// other side of their foreign keys so that masked rows still match.
+	MaskHash  = "hash"
+	MaskEmail = "email"
+)
+
+// Formats of a subset export
+const (
+	SubsetFormatSQL  = "sql"
+	SubsetFormatJSON = "json"
+)
+
+type SubsetOptions struct {
+	// Table of the seed rows and the filter selecting them
+	Schema string      `json:"schema"`
+	Table  string      `json:"table"`
+	Filter TableFilter `json:"filter"`
+	// Hops followed from a row to the rows referencing it, 0 follows none. The rows a row
+	// references are always followed, the subset can't be loaded without them.
+	Depth int `json:"depth"`
+	// The extraction fails beyond this number of rows, defaults to 10000
+	MaxRows int `json:"maxRows"`
+	// Masks applied to the exported or copied rows
+	Masks []MaskRule `json:"masks"`
+	// Skip rows which already exist on insert
+	OnConflictDoNothing bool `json:"onConflictDoNothing"`
+}
+
+// MaskRule scrubs a column of the rows leaving dbmx
+type MaskRule struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	// One of the Mask* strategies
+	Strategy string `json:"strategy"`
+	// Value of the fixed strategy
+	Value string `json:"value"`
+}
+
+type SubsetTable struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Rows   int    `json:"rows"`
+}
+
+// SubsetResult lists the tables of a subset in the order they are loaded in
+type SubsetResult struct {
+	Tables    []SubsetTable `json:"tables"`
+	TotalRows int           `json:"totalRows"`
+	Message   string        `json:"message"`
+}
+
+// SubsetFixtures is the JSON export of a subset, tables in the order they are loaded in
+type SubsetFixtures struct {
+	Database string                `json:"database"`
+	Tables   []SubsetFixturesTable `json:"tables"`
+}
+
+type SubsetFixturesTable struct {
+	Schema  string               `json:"schema"`
+	Name    string               `json:"name"`
+	Columns []string             `json:"columns"`
+	Rows    []map[string]*string `json:"rows"`
+}
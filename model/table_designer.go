@@ -0,0 +1,94 @@
+package model
+
+// TableDesign is the editable definition of a table in the table designer. It's either built
+// from scratch or loaded from an existing table.
+type TableDesign struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	// Name of the table being altered, empty for a new table
+	OriginalName string `json:"originalName"`
+
+	Columns     []DesignColumn     `json:"columns"`
+	PrimaryKey  *DesignKey         `json:"primaryKey"`
+	UniqueKeys  []DesignKey        `json:"uniqueKeys"`
+	ForeignKeys []DesignForeignKey `json:"foreignKeys"`
+	Checks      []DesignCheck      `json:"checks"`
+	Indexes     []DesignIndex      `json:"indexes"`
+	Comment     string             `json:"comment"`
+}
+
+type DesignColumn struct {
+	Name string `json:"name"`
+	// Name of the column in the existing table, empty for a new column. A different name renames
+	// the column.
+	OriginalName string `json:"originalName"`
+	Type         string `json:"type"`
+	NotNull      bool   `json:"notNull"`
+	Default      string `json:"default"`
+	// ALWAYS or BY DEFAULT for identity columns
+	Identity string `json:"identity"`
+	// Expression of a stored generated column
+	Generated string `json:"generated"`
+	Collation string `json:"collation"`
+	Comment   string `json:"comment"`
+}
+
+// DesignKey is a primary key or unique constraint, a generated name is used when Name is empty
+type DesignKey struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+type DesignForeignKey struct {
+	Name              string   `json:"name"`
+	Columns           []string `json:"columns"`
+	ReferencedSchema  string   `json:"referencedSchema"`
+	ReferencedTable   string   `json:"referencedTable"`
+	ReferencedColumns []string `json:"referencedColumns"`
+	// NO ACTION, RESTRICT, CASCADE, SET NULL or SET DEFAULT, empty means NO ACTION
+	OnUpdate string `json:"onUpdate"`
+	OnDelete string `json:"onDelete"`
+}
+
+type DesignCheck struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+type DesignIndex struct {
+	Name string `json:"name"`
+	// Column names or expressions
+	Columns []string `json:"columns"`
+	// Non-key columns stored in the index
+	Include []string `json:"include"`
+	Unique  bool     `json:"unique"`
+	// Access method, btree when empty
+	Method string `json:"method"`
+	// Predicate of a partial index
+	Where string `json:"where"`
+}
+
+// TableDesignPreview is the DDL which turns the current table into the design
+type TableDesignPreview struct {
+	// The table doesn't exist yet
+	Create bool `json:"create"`
+	// Changes to the existing table, nil when creating or when nothing changed
+	Diff       *TableDiff        `json:"diff"`
+	Statements []DesignStatement `json:"statements"`
+	SQL        string            `json:"sql"`
+	// Changes the designer can't migrate, flagged statements carry their own warning
+	Warnings []string `json:"warnings"`
+}
+
+// DesignStatement is a statement of the DDL preview with the lock it takes on the table
+type DesignStatement struct {
+	SQL string `json:"sql"`
+	// Lock mode, e.g. ACCESS EXCLUSIVE
+	Lock string `json:"lock"`
+	// The table is rewritten
+	Rewrite bool `json:"rewrite"`
+	// The table is read in full while the lock is held
+	Scan bool `json:"scan"`
+	// Set when the statement is flagged
+	Warning string `json:"warning"`
+}
@@ -0,0 +1,50 @@
+package model
+
+const (
+	// Filters compiled from columns, conditions and sort columns
+	FilterModeStructured = "structured"
+	// Free text select, where, order by and group by clauses
+	FilterModeRaw = "raw"
+)
+
+// TableFilter filters and sorts the rows of a table tab
+type TableFilter struct {
+	Mode string `json:"mode"`
+
+	// Structured mode
+
+	// Columns to select, all columns when empty
+	Columns []string     `json:"columns"`
+	Where   FilterGroup  `json:"where"`
+	Sort    []SortColumn `json:"sort"`
+
+	// Raw mode
+
+	RawSelect  string `json:"rawSelect"`
+	RawWhere   string `json:"rawWhere"`
+	RawOrderBy string `json:"rawOrderBy"`
+	RawGroupBy string `json:"rawGroupBy"`
+}
+
+// FilterGroup joins its conditions and nested groups with AND or OR
+type FilterGroup struct {
+	Op         string            `json:"op"`
+	Conditions []FilterCondition `json:"conditions"`
+	Groups     []FilterGroup     `json:"groups"`
+}
+
+type FilterCondition struct {
+	Column string `json:"column"`
+	// Operator is one of =, !=, <, <=, >, >=, like, not like, ilike, not ilike, in, not in, between, is null, is not null
+	Operator string `json:"operator"`
+	// Type the value is coerced to, the column type when empty
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// Values of the in, not in and between operators
+	Values []string `json:"values"`
+}
+
+type SortColumn struct {
+	Column     string `json:"column"`
+	Descending bool   `json:"descending"`
+}
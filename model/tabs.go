@@ -23,7 +23,13 @@ type Tab struct {
 	TotalRows   int64    `json:"totalRows"`
 	CurrentPage int64    `json:"currentPage"`
 
+	// Set when TotalRows comes from the planner statistics, and when the current page was
+	// derived from an estimated number of rows before it
+	TotalRowsEstimated   bool `json:"totalRowsEstimated"`
+	CurrentPageEstimated bool `json:"currentPageEstimated"`
+
 	// Required if type is table
+	Schema         string
 	ConnectionID   *int64
 	ConnectionName string
 	DBName         *string
@@ -35,9 +41,15 @@ type Tab struct {
 	GroupBy        string
 	TableColumns   string
 
+	// Structured filter of a table tab, nil until the tab is filtered
+	Filter *TableFilter
+
 	// To be passed to frontend
 	TableColumnsList []string
 
+	// Parameter values of the editor query, keyed by position or name
+	QueryParams map[string]QueryParam
+
 	// AI chat
 	AIChat []AIMsg
 
@@ -55,6 +67,7 @@ type AIMsg struct {
 var validTypes = map[string]struct{}{
 	"editor": {},
 	"table":  {},
+	"erd":    {},
 }
 
 func IsValidTabType(t string) bool {
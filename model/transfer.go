@@ -0,0 +1,22 @@
+package model
+
+type TransferOptions struct {
+	Tables []TransferTable `json:"tables"`
+	// Empty the target tables before copying
+	Truncate bool `json:"truncate"`
+	// Rows per COPY into the target, defaults to 10000
+	BatchSize int `json:"batchSize"`
+	// Name of the target database, required when the target is a production connection
+	Confirmation string `json:"confirmation"`
+}
+
+// TransferTable copies the rows of a source table into a target table, which is created when missing
+type TransferTable struct {
+	Source TableRef `json:"source"`
+	// Defaults to the schema and name of the source
+	Target TableRef `json:"target"`
+	// SQL condition selecting the source rows, e.g. created_at > now() - interval '1 day'
+	Where string `json:"where"`
+	// Maximum number of rows to copy, 0 copies all of them
+	Limit int64 `json:"limit"`
+}
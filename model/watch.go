@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// WatchUpdate is the result of a run of a watched query and its changes since the previous run
+type WatchUpdate struct {
+	TabID int64 `json:"tabId"`
+	// Runs since the watch started, the first one has nothing to compare with
+	Iteration int         `json:"iteration"`
+	RanAt     time.Time   `json:"ranAt"`
+	Result    QueryResult `json:"result"`
+	Diff      ResultDiff  `json:"diff"`
+}
+
+// ResultDiff lists the rows added, removed and changed between two results of a query
+type ResultDiff struct {
+	// key when rows are matched by their key columns, content when whole rows are compared and
+	// changes show up as a removed and an added row
+	KeyedBy string `json:"keyedBy"`
+	// Indexes of the added rows in the new result
+	Added   []int        `json:"added"`
+	Removed []RemovedRow `json:"removed"`
+	Changed []ChangedRow `json:"changed"`
+}
+
+// RemovedRow is a row of the previous result missing from the new one
+type RemovedRow struct {
+	// Index of the row in the previous result
+	Row   int    `json:"row"`
+	Key   RowKey `json:"key"`
+	Cells []Cell `json:"cells"`
+}
+
+// ChangedRow is a row found in both results by its key with different cells
+type ChangedRow struct {
+	// Index of the row in the new result
+	Row   int           `json:"row"`
+	Key   RowKey        `json:"key"`
+	Cells []ChangedCell `json:"cells"`
+}
+
+type ChangedCell struct {
+	Column   string `json:"column"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+}